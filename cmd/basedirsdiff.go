@@ -0,0 +1,151 @@
+/*******************************************************************************
+ * Copyright (c) 2024 Genome Research Ltd.
+ *
+ * Authors:
+ *	- Sendu Bala <sb10@sanger.ac.uk>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining
+ * a copy of this software and associated documentation files (the
+ * "Software"), to deal in the Software without restriction, including
+ * without limitation the rights to use, copy, modify, merge, publish,
+ * distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so, subject to
+ * the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included
+ * in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+ * CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+ * TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ ******************************************************************************/
+
+package cmd
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"code.cloudfoundry.org/bytefmt"
+	"github.com/spf13/cobra"
+	"github.com/wtsi-hgi/wrstat-ui/server"
+)
+
+const (
+	diffFormatTSV  = "tsv"
+	diffFormatJSON = "json"
+)
+
+// options for this cmd.
+var (
+	diffOwnersPath string
+	diffFormat     string
+	diffMinDelta   string
+)
+
+// basedirsDiffCmd represents the basedirs-diff command.
+var basedirsDiffCmd = &cobra.Command{
+	Use:   "basedirs-diff old.db new.db",
+	Short: "Report usage changes between two basedirs databases",
+	Long: `Report usage changes between two basedirs databases.
+
+Provide the paths to an older and a newer basedirs.db file (as found in your
+'wrstat multi -f' output directories) to find out which groups and users grew
+or shrank the most in each of their base directories, and which base
+directories appeared or disappeared.
+
+Only usage of files of all ages is compared. Entries whose usage didn't change
+are not reported.
+
+--owners gid,owner csv file is required, as for the server sub-command.
+
+--format tsv (the default) outputs one line per changed entry, with columns:
+kind (group or user), change (added, removed or changed), name, base directory,
+old size, new size, size delta, old inodes, new inodes and inodes delta. Sizes
+are in bytes. Lines are sorted by the absolute size delta, largest first.
+
+--format json outputs an object with Groups and Users keys, each a list of the
+changed entries in the same order.
+
+--min_delta (specify your own units, eg. 50M for 50 megabytes) can be used to
+not report entries whose size changed by less than that. Defaults to 0, showing
+all changes.
+`,
+	Run: func(_ *cobra.Command, args []string) {
+		if len(args) != 2 { //nolint:mnd
+			die("you must supply the paths to an old and a new basedirs.db")
+		}
+
+		if diffOwnersPath == "" {
+			die("you must supply --owners")
+		}
+
+		if diffFormat != diffFormatTSV && diffFormat != diffFormatJSON {
+			die("--format must be 'tsv' or 'json'")
+		}
+
+		minDelta, err := bytefmt.ToBytes(diffMinDelta)
+		if err != nil {
+			die("bad --min_delta: %s", err)
+		}
+
+		groups, users, err := server.DiffBasedirsDBs(args[0], args[1], diffOwnersPath, minDelta)
+		if err != nil {
+			die("failed to diff basedirs databases: %s", err)
+		}
+
+		if diffFormat == diffFormatJSON {
+			printUsageDiffsJSON(groups, users)
+
+			return
+		}
+
+		printUsageDiffsTSV("group", groups)
+		printUsageDiffsTSV("user", users)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(basedirsDiffCmd)
+
+	// flags specific to this sub-command
+	basedirsDiffCmd.Flags().StringVarP(&diffOwnersPath, "owners", "o", "", "gid,owner csv file")
+	basedirsDiffCmd.Flags().StringVarP(&diffFormat, "format", "f", diffFormatTSV,
+		"output format; tsv or json")
+	basedirsDiffCmd.Flags().StringVar(&diffMinDelta, "min_delta", "0",
+		"minimum size change (specify the unit) for an entry to be reported on")
+}
+
+// printUsageDiffsJSON prints the given group and user diffs as a JSON object.
+func printUsageDiffsJSON(groups, users []*server.UsageDiff) {
+	b, err := json.MarshalIndent(struct {
+		Groups []*server.UsageDiff
+		Users  []*server.UsageDiff
+	}{groups, users}, "", "  ")
+	if err != nil {
+		die("failed to encode diff: %s", err)
+	}
+
+	cliPrint("%s\n", b)
+}
+
+// printUsageDiffsTSV prints the given diffs one per line, with the given kind
+// in the first column.
+func printUsageDiffsTSV(kind string, diffs []*server.UsageDiff) {
+	for _, d := range diffs {
+		cliPrint("%s\n", strings.Join([]string{
+			kind, string(d.Change), d.Name, d.BaseDir,
+			strconv.FormatUint(d.OldUsageSize, 10),
+			strconv.FormatUint(d.NewUsageSize, 10),
+			strconv.FormatInt(d.SizeDelta, 10),
+			strconv.FormatUint(d.OldUsageInodes, 10),
+			strconv.FormatUint(d.NewUsageInodes, 10),
+			strconv.FormatInt(d.InodesDelta, 10),
+		}, "\t"))
+	}
+}
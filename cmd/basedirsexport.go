@@ -0,0 +1,101 @@
+/*******************************************************************************
+ * Copyright (c) 2024 Genome Research Ltd.
+ *
+ * Author: Sendu Bala <sb10@sanger.ac.uk>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining
+ * a copy of this software and associated documentation files (the
+ * "Software"), to deal in the Software without restriction, including
+ * without limitation the rights to use, copy, modify, merge, publish,
+ * distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so, subject to
+ * the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included
+ * in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+ * CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+ * TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ ******************************************************************************/
+
+package cmd
+
+import (
+	"bufio"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/wtsi-hgi/wrstat-ui/server"
+	"github.com/wtsi-ssg/wrstat/v5/basedirs"
+)
+
+// options for this cmd.
+var (
+	exportOwnersPath string
+	exportFormat     string
+)
+
+// basedirsExportCmd represents the basedirs-export command.
+var basedirsExportCmd = &cobra.Command{
+	Use:   "basedirs-export basedirs.db",
+	Short: "Export all usage in a basedirs database",
+	Long: `Export all usage in a basedirs database.
+
+Provide the path to a basedirs.db file (as found in your 'wrstat multi -f'
+output directory) to write all of its group and user usage, for all ages, to
+STDOUT, for archival or offline analysis.
+
+--owners gid,owner csv file is required, as for the server sub-command.
+
+--format json (the default) outputs one JSON object per line, each with a Kind
+(group or user) and the usage fields.
+
+--format csv outputs a header line followed by one line per usage, with the same
+fields. GIDs and UIDs columns are semicolon separated, and dates are RFC3339.
+`,
+	Run: func(_ *cobra.Command, args []string) {
+		if len(args) != 1 {
+			die("you must supply the path to a basedirs.db")
+		}
+
+		if exportOwnersPath == "" {
+			die("you must supply --owners")
+		}
+
+		if exportFormat != server.ExportFormatJSON && exportFormat != server.ExportFormatCSV {
+			die("--format must be 'json' or 'csv'")
+		}
+
+		bd, err := basedirs.NewReader(args[0], exportOwnersPath)
+		if err != nil {
+			die("failed to open basedirs database: %s", err)
+		}
+
+		defer bd.Close()
+
+		w := bufio.NewWriter(os.Stdout)
+
+		err = server.ExportBasedirs(w, bd, exportFormat)
+		if err == nil {
+			err = w.Flush()
+		}
+
+		if err != nil {
+			die("failed to export: %s", err)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(basedirsExportCmd)
+
+	// flags specific to this sub-command
+	basedirsExportCmd.Flags().StringVarP(&exportOwnersPath, "owners", "o", "", "gid,owner csv file")
+	basedirsExportCmd.Flags().StringVarP(&exportFormat, "format", "f", server.ExportFormatJSON,
+		"output format; json or csv")
+}
@@ -0,0 +1,117 @@
+/*******************************************************************************
+ * Copyright (c) 2024 Genome Research Ltd.
+ *
+ * Author: Sendu Bala <sb10@sanger.ac.uk>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining
+ * a copy of this software and associated documentation files (the
+ * "Software"), to deal in the Software without restriction, including
+ * without limitation the rights to use, copy, modify, merge, publish,
+ * distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so, subject to
+ * the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included
+ * in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+ * CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+ * TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ ******************************************************************************/
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/bytefmt"
+	"github.com/spf13/cobra"
+	"github.com/wtsi-hgi/wrstat-ui/server"
+)
+
+const compactDirPerms = 0755
+
+// compactCmd represents the compact command.
+var compactCmd = &cobra.Command{
+	Use:   "compact source destination",
+	Short: "Defragment database files",
+	Long: `Defragment database files.
+
+The bolt database files that 'wrstat multi' creates don't shrink when data is
+deleted from them. This command writes a defragmented copy of a database, which
+will have identical contents but may be much smaller.
+
+Provide the path to a database file (eg. a basedirs.db) and the path to write
+the compacted copy to, which must not already exist.
+
+Alternatively, provide the path to a directory containing database files, such
+as one of the numbered directories in a *.dguta.dbs directory, and the path of a
+new directory to write compacted copies of each of those files to.
+
+The source databases are only read, so this is safe to run on databases a
+server is currently using. To start using the compacted copies, replace the
+originals with them while the server isn't running.
+`,
+	Run: func(_ *cobra.Command, args []string) {
+		if len(args) != 2 { //nolint:mnd
+			die("you must supply a source and destination path")
+		}
+
+		src, dst := args[0], args[1]
+
+		fi, err := os.Stat(src)
+		if err != nil {
+			die("could not access source: %s", err)
+		}
+
+		if !fi.IsDir() {
+			compactFile(src, dst)
+
+			return
+		}
+
+		entries, err := os.ReadDir(src)
+		if err != nil {
+			die("could not read source directory: %s", err)
+		}
+
+		if err = os.Mkdir(dst, compactDirPerms); err != nil {
+			die("could not create destination directory: %s", err)
+		}
+
+		for _, entry := range entries {
+			if entry.Type().IsRegular() {
+				compactFile(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name()))
+			}
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(compactCmd)
+}
+
+// compactFile compacts the database at src in to dst, logging the size
+// difference.
+func compactFile(src, dst string) {
+	if err := server.CompactDB(src, dst); err != nil {
+		die("failed to compact %s: %s", src, err)
+	}
+
+	info("compacted %s (%s) to %s (%s)", src, fileSize(src), dst, fileSize(dst))
+}
+
+// fileSize returns the human readable size of the given file.
+func fileSize(path string) string {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "unknown size"
+	}
+
+	return bytefmt.ByteSize(uint64(fi.Size()))
+}
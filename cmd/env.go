@@ -0,0 +1,66 @@
+/*******************************************************************************
+ * Copyright (c) 2024 Genome Research Ltd.
+ *
+ * Author: Sendu Bala <sb10@sanger.ac.uk>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining
+ * a copy of this software and associated documentation files (the
+ * "Software"), to deal in the Software without restriction, including
+ * without limitation the rights to use, copy, modify, merge, publish,
+ * distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so, subject to
+ * the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included
+ * in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+ * CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+ * TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ ******************************************************************************/
+
+package cmd
+
+import (
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// envPrefix is prepended to the upper-cased name of a flag to get the name of
+// the environment variable that can be used to set it, eg. --owners can be set
+// with WRSTAT_UI_OWNERS.
+const envPrefix = "WRSTAT_UI_"
+
+// flagEnvVar returns the environment variable name that can set the given
+// flag.
+func flagEnvVar(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// bindFlagsToEnv sets any of the given command's flags that weren't supplied on
+// the command line to the value of their corresponding environment variable,
+// if set. Dies if an environment variable has a value that isn't valid for its
+// flag.
+func bindFlagsToEnv(cmd *cobra.Command, _ []string) {
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if f.Changed {
+			return
+		}
+
+		val, ok := os.LookupEnv(flagEnvVar(f.Name))
+		if !ok {
+			return
+		}
+
+		if err := cmd.Flags().Set(f.Name, val); err != nil {
+			die("bad value for %s: %s", flagEnvVar(f.Name), err)
+		}
+	})
+}
@@ -0,0 +1,212 @@
+/*******************************************************************************
+ * Copyright (c) 2024 Genome Research Ltd.
+ *
+ * Author: Sendu Bala <sb10@sanger.ac.uk>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining
+ * a copy of this software and associated documentation files (the
+ * "Software"), to deal in the Software without restriction, including
+ * without limitation the rights to use, copy, modify, merge, publish,
+ * distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so, subject to
+ * the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included
+ * in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+ * CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+ * TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ ******************************************************************************/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/wtsi-hgi/wrstat-ui/server"
+	"github.com/wtsi-ssg/wrstat/v5/dguta"
+	"github.com/wtsi-ssg/wrstat/v5/summary"
+)
+
+const (
+	retentionSummaryBasename = "summary.json"
+	reportFilePerms          = 0644
+	reportDirPerms           = 0755
+)
+
+// ageNames are the names accepted by --age, in the same order as
+// summary.DirGUTAges.
+var ageNames = []string{ //nolint:gochecknoglobals
+	"all", "a1m", "a2m", "a6m", "a1y", "a2y", "a3y", "a5y", "a7y",
+	"m1m", "m2m", "m6m", "m1y", "m2y", "m3y", "m5y", "m7y",
+}
+
+// options for this cmd.
+var (
+	retentionAge    string
+	retentionMount  string
+	retentionOutDir string
+)
+
+// reportCmd represents the report command.
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Produce reports from the databases",
+	Long: `Produce reports from the databases.
+
+This command has sub-commands that write reports based on the databases in your
+'wrstat multi -f' output directory.
+`,
+}
+
+// retentionCmd represents the report retention command.
+var retentionCmd = &cobra.Command{
+	Use:   "retention",
+	Short: "Preview what a retention policy would delete",
+	Long: `Preview what a retention policy would delete.
+
+Provide the path to your 'wrstat multi -f' output directory, the --mount (or any
+directory) to consider, and the --age of data that the policy would delete, eg.
+m6m for data not modified in the last 6 months, or a3y for data not accessed in
+the last 3 years. The age names are the same as used in the web interface: a or
+m followed by 1m, 2m, 6m, 1y, 2y, 3y, 5y or 7y.
+
+For each group with files under --mount, a file named after the group is written
+to --out-dir, listing the directories in which all of that group's files are
+at least --age old, and so would be entirely deleted by the policy. Each line
+has the columns: directory, size in bytes and number of files, and lines are
+sorted largest first. Subdirectories of listed directories are not listed
+separately. Groups with nothing to delete get no file.
+
+A summary.json file is also written to --out-dir, containing a list of objects
+with each group's Group, GID, total Size and Count of files that would be
+deleted, the number of Dirs and the File their report was written to.
+
+Ages are evaluated exactly as they are in the server, so previews match what
+users see in the web interface when filtering on the same age.
+`,
+	Run: func(_ *cobra.Command, args []string) {
+		if len(args) != 1 {
+			die("you must supply the path to your 'wrstat multi -f' output directory")
+		}
+
+		if retentionMount == "" || retentionOutDir == "" {
+			die("you must supply --mount and --out-dir")
+		}
+
+		age, err := ageNameToDirGUTAge(retentionAge)
+		if err != nil || age == summary.DGUTAgeAll {
+			die("bad --age '%s'; it must be one of %s", retentionAge, strings.Join(ageNames[1:], ", "))
+		}
+
+		dbPaths, err := server.FindLatestDgutaDirs(args[0], dgutaDBsSuffix)
+		if err != nil {
+			die("failed to find database paths: %s", err)
+		}
+
+		tree, err := dguta.NewTree(dbPaths...)
+		if err != nil {
+			die("failed to open database: %s", err)
+		}
+
+		defer tree.Close()
+
+		previews, err := server.RetentionPreview(tree, retentionMount, age)
+		if err != nil {
+			die("failed to find directories to delete: %s", err)
+		}
+
+		err = writeRetentionReports(retentionOutDir, previews)
+		if err != nil {
+			die("failed to write reports: %s", err)
+		}
+
+		info("wrote reports for %d groups to %s", len(previews), retentionOutDir)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(reportCmd)
+	reportCmd.AddCommand(retentionCmd)
+
+	// flags specific to this sub-command
+	retentionCmd.Flags().StringVarP(&retentionAge, "age", "a", "m6m",
+		"age of data the policy would delete")
+	retentionCmd.Flags().StringVarP(&retentionMount, "mount", "m", "",
+		"mount point (or other directory) to consider")
+	retentionCmd.Flags().StringVarP(&retentionOutDir, "out-dir", "o", "",
+		"directory to write the reports to")
+}
+
+// ageNameToDirGUTAge converts one of our ageNames, or an age number as
+// understood by the server, to a DirGUTAge.
+func ageNameToDirGUTAge(name string) (summary.DirGUTAge, error) {
+	for i, n := range ageNames {
+		if strings.EqualFold(n, name) {
+			return summary.DirGUTAges[i], nil
+		}
+	}
+
+	return summary.AgeStringToDirGUTAge(name)
+}
+
+// retentionSummary is the machine-readable summary of a group's retention
+// report.
+type retentionSummary struct {
+	Group string
+	GID   uint32
+	Size  uint64
+	Count uint64
+	Dirs  int
+	File  string
+}
+
+// writeRetentionReports writes a TSV file per group to outDir, and a JSON
+// summary of them all.
+func writeRetentionReports(outDir string, previews []*server.GroupRetention) error {
+	if err := os.MkdirAll(outDir, reportDirPerms); err != nil {
+		return err
+	}
+
+	summaries := make([]*retentionSummary, len(previews))
+
+	for i, gr := range previews {
+		file := filepath.Join(outDir, gr.Group+".tsv")
+
+		var b strings.Builder
+
+		for _, d := range gr.Dirs {
+			fmt.Fprintf(&b, "%s\t%d\t%d\n", d.Dir, d.Size, d.Count)
+		}
+
+		if err := os.WriteFile(file, []byte(b.String()), reportFilePerms); err != nil {
+			return err
+		}
+
+		summaries[i] = &retentionSummary{
+			Group: gr.Group,
+			GID:   gr.GID,
+			Size:  gr.Size,
+			Count: gr.Count,
+			Dirs:  len(gr.Dirs),
+			File:  file,
+		}
+	}
+
+	j, err := json.MarshalIndent(summaries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(outDir, retentionSummaryBasename), j, reportFilePerms)
+}
@@ -51,7 +51,12 @@ var RootCmd = &cobra.Command{
 
 The 'where' subcommand can be used to find out where data is on disk.
 
-The 'server' subcommand can be used to start the web server.`,
+The 'server' subcommand can be used to start the web server.
+
+Any flag of any subcommand that isn't supplied on the command line can instead
+be set with an environment variable named WRSTAT_UI_ followed by the flag's
+name in upper case, eg. WRSTAT_UI_OWNERS for --owners.`,
+	PersistentPreRun: bindFlagsToEnv,
 }
 
 // Execute adds all child commands to the root command and sets flags
@@ -28,7 +28,6 @@
 package cmd
 
 import (
-	"encoding/csv"
 	"errors"
 	"io"
 	"log/syslog"
@@ -38,6 +37,7 @@ import (
 
 	"github.com/inconshreveable/log15"
 	"github.com/spf13/cobra"
+	ifs "github.com/wtsi-hgi/wrstat-ui/internal/fs"
 	"github.com/wtsi-hgi/wrstat-ui/server"
 )
 
@@ -61,6 +61,17 @@ var (
 	oktaOAuthClientSecret string
 	areasPath             string
 	ownersPath            string
+	queryTimeout          time.Duration
+	noBasedirs            bool
+	overridesPath         string
+	reloadHistorySize     int
+	noTLS                 bool
+	noTLSAcknowledged     bool
+	slowQueryThreshold    time.Duration
+	readinessPath         string
+	detectMounts          bool
+	mountFSTypes          []string
+	topNMaxDirs           int
 )
 
 // serverCmd represents the server command.
@@ -77,6 +88,13 @@ your 'wrstat multi -f' argument as an unamed argument to this command.)
 Your --bind address should include the port, and for it to work with your
 --cert, you probably need to specify it as fqdn:port.
 
+If TLS is terminated by a reverse proxy in front of the server, you can supply
+--no_tls to serve plain HTTP instead. Because this means anyone who can reach
+--bind directly can see users' login tokens, you must also supply
+--tls_terminated_by_proxy to acknowledge that only the proxy can do so. --cert
+and --key are still required, but are then only used to sign login tokens, so
+can be any self-signed certificate and key.
+
 The server authenticates users using Okta. You must specify all of
 --okta_issuer, --okta_id and --okta_secret or env vars OKTA_OAUTH2_ISSUER,
 OKTA_OAUTH2_CLIENT_ID and OKTA_OAUTH2_CLIENT_SECRET. You must also specify
@@ -91,11 +109,43 @@ If --logfile is supplied, logs to that file instaed of syslog.
 
 If --areas is supplied, the group,area csv file pointed to will be used to add
 "areas" to the server, allowing clients to specify an area to filter on all
-groups with that area.
-
---owners gid,owner csv file is required and will be used to associate groups
-with their owners. If your groups don't really have owners, just supply the path
-to a file with a fake entry.
+groups with that area. Changes to this file will be picked up automatically,
+and members of white-listed groups can replace the areas with a PUT to
+/rest/v1/auth/group-areas, which will also rewrite the file.
+
+If there is no basedirs.db in the given directory, or you supply --no_basedirs,
+the server will only serve the tree and where views; its basedirs endpoints will
+respond with a 404 "basedirs database not loaded" error. A basedirs.db that
+appears in a later run will only be used after restarting the server. If a
+later run doesn't produce a basedirs.db, the previous one continues to be used.
+
+--owners gid,owner csv file is required (unless using --no_basedirs) and will be
+used to associate groups with their owners. If your groups don't really have
+owners, just supply the path to a file with a fake entry. Changes to this file
+will be picked up automatically, without needing to restart the server.
+
+By default, the mount points that base directories are on are discovered from
+all of the system's mounts. If that picks up the wrong ones, supply
+--detect_mounts to instead only use mounts from /proc/self/mounts with one of
+the --mount_types file system types.
+
+Members of white-listed groups can override the quotas of a group's base
+directory. These overrides are forgotten when the basedirs database is reloaded,
+unless you supply --overrides_file, a JSON file they will be saved in and
+restored from.
+
+Tree and where queries that take longer than --query_timeout will be abandoned
+and the client will get a 504 "query timeout" response. Set it to 0 to let
+queries run for as long as they take.
+
+Every where, tree and basedirs query is logged with the user, query parameters,
+number of results and duration. Those that take longer than --slow_query are
+logged as "WARN query" instead of "INFO query".
+
+If --sentinel_file is supplied, that file will be created once the databases
+have first been loaded, and removed when the server stops, for use with things
+like Kubernetes readiness probes. If it can't be created, a warning is logged
+and the server carries on regardless.
 
 The server must be running for 'wrstat where' calls to succeed.
 
@@ -125,7 +175,11 @@ creation time in reports.
 			die("you must supply --key")
 		}
 
-		if ownersPath == "" {
+		if noTLS && !noTLSAcknowledged {
+			die("--no_tls requires --tls_terminated_by_proxy")
+		}
+
+		if ownersPath == "" && !noBasedirs {
 			die("you must supply --owners")
 		}
 
@@ -134,6 +188,11 @@ creation time in reports.
 		logWriter := setServerLogger(serverLogPath)
 
 		s := server.New(logWriter)
+		s.SetQueryTimeout(queryTimeout)
+		s.SetReloadHistorySize(reloadHistorySize)
+		s.SetSlowQueryThreshold(slowQueryThreshold)
+		s.SetReadinessFile(readinessPath)
+		s.SetTopNMaxDirs(topNMaxDirs)
 
 		err := s.EnableAuthWithServerToken(serverCert, serverKey, serverTokenBasename, authenticateDeny)
 		if err != nil {
@@ -148,8 +207,15 @@ creation time in reports.
 
 		s.WhiteListGroups(whiteLister)
 
+		if detectMounts {
+			err = s.DetectMountPoints(mountFSTypes)
+			if err != nil {
+				die("failed to detect mount points: %s", err)
+			}
+		}
+
 		if areasPath != "" {
-			s.AddGroupAreas(areasCSVToMap(areasPath))
+			loadGroupAreas(s)
 		}
 
 		info("opening databases, please wait...")
@@ -158,21 +224,11 @@ creation time in reports.
 			die("failed to find database paths: %s", err)
 		}
 
-		basedirsDBPath, err := server.FindLatestBasedirsDB(args[0], basedirBasename)
-		if err != nil {
-			die("failed to find basedirs database path: %s", err)
-		}
-
 		err = s.LoadDGUTADBs(dbPaths...)
 		if err != nil {
 			die("failed to load database: %s", err)
 		}
 
-		err = s.LoadBasedirsDB(basedirsDBPath, ownersPath)
-		if err != nil {
-			die("failed to load database: %s", err)
-		}
-
 		sentinel := filepath.Join(args[0], dgutaDBsSentinelBasename)
 
 		err = s.EnableDGUTADBReloading(sentinel, args[0], dgutaDBsSuffix, sentinelPollFrequencty)
@@ -180,10 +236,7 @@ creation time in reports.
 			die("failed to set up database reloading: %s", err)
 		}
 
-		err = s.EnableBasedirDBReloading(sentinel, args[0], basedirBasename, sentinelPollFrequencty)
-		if err != nil {
-			die("failed to set up database reloading: %s", err)
-		}
+		loadBasedirs(s, args[0], sentinel)
 
 		err = s.AddTreePage()
 		if err != nil {
@@ -194,7 +247,7 @@ creation time in reports.
 
 		sayStarted()
 
-		err = s.Start(serverBind, serverCert, serverKey)
+		err = startServer(s)
 		if err != nil {
 			die("non-graceful stop: %s", err)
 		}
@@ -211,6 +264,10 @@ func init() {
 		"path to certificate file")
 	serverCmd.Flags().StringVarP(&serverKey, "key", "k", "",
 		"path to key file")
+	serverCmd.Flags().BoolVar(&noTLS, "no_tls", false,
+		"serve plain HTTP, for use behind a TLS-terminating reverse proxy")
+	serverCmd.Flags().BoolVar(&noTLSAcknowledged, "tls_terminated_by_proxy", false,
+		"acknowledge that --no_tls is only safe behind a TLS-terminating proxy")
 	serverCmd.Flags().StringVar(&oktaURL, "okta_url", "",
 		"Okta application URL, eg host:port (defaults to --bind)")
 	serverCmd.Flags().StringVar(&oktaOAuthIssuer, "okta_issuer", os.Getenv("OKTA_OAUTH2_ISSUER"),
@@ -223,6 +280,93 @@ func init() {
 	serverCmd.Flags().StringVarP(&ownersPath, "owners", "o", "", "gid,owner csv file")
 	serverCmd.Flags().StringVar(&serverLogPath, "logfile", "",
 		"log to this file instead of syslog")
+	serverCmd.Flags().BoolVar(&noBasedirs, "no_basedirs", false,
+		"don't load a basedirs database, disabling basedirs features")
+	serverCmd.Flags().StringVar(&overridesPath, "overrides_file", "",
+		"JSON file to persist admins' quota overrides in")
+	serverCmd.Flags().DurationVar(&queryTimeout, "query_timeout", server.DefaultQueryTimeout,
+		"maximum time to spend on a tree or where query")
+	serverCmd.Flags().DurationVar(&slowQueryThreshold, "slow_query", server.DefaultSlowQueryThreshold,
+		"log where, tree and basedirs queries taking longer than this as warnings")
+	serverCmd.Flags().IntVar(&reloadHistorySize, "reload_history", server.DefaultReloadHistorySize,
+		"number of recent database reloads admins can see")
+	serverCmd.Flags().StringVar(&readinessPath, "sentinel_file", "",
+		"file to create once the databases have loaded, and remove on stop")
+	serverCmd.Flags().BoolVar(&detectMounts, "detect_mounts", false,
+		"only consider mounts of --mount_types to be where base directories are")
+	serverCmd.Flags().StringSliceVar(&mountFSTypes, "mount_types", server.DefaultMountFSTypes,
+		"file system types to consider with --detect_mounts")
+	serverCmd.Flags().IntVar(&topNMaxDirs, "topn_max_dirs", server.DefaultTopNMaxDirs,
+		"most directories a largest-directories query will look in to")
+}
+
+// startServer starts the given server listening on --bind, using TLS with
+// --cert and --key unless --no_tls was given.
+func startServer(s *server.Server) error {
+	if noTLS {
+		warn("serving plain HTTP; TLS must be terminated by a proxy")
+
+		return s.StartInsecure(serverBind)
+	}
+
+	return s.Start(serverBind, serverCert, serverKey)
+}
+
+// loadBasedirs loads the latest basedirs database in the given directory and
+// sets up its reloading when the sentinel file changes. If --no_basedirs was
+// given, or there is no basedirs database, the basedirs endpoints are disabled
+// instead.
+func loadBasedirs(s *server.Server, dir, sentinel string) {
+	if noBasedirs {
+		s.DisableBasedirs()
+
+		return
+	}
+
+	basedirsDBPath, err := server.FindLatestBasedirsDB(dir, basedirBasename)
+	if errors.Is(err, ifs.ErrNoDirEntryFound) {
+		warn("no %s found; basedirs features will be disabled", basedirBasename)
+		s.DisableBasedirs()
+
+		return
+	} else if err != nil {
+		die("failed to find basedirs database path: %s", err)
+	}
+
+	if overridesPath != "" {
+		if err = s.SetQuotaOverridesFile(overridesPath); err != nil {
+			die("failed to load quota overrides: %s", err)
+		}
+	}
+
+	err = s.LoadBasedirsDB(basedirsDBPath, ownersPath)
+	if err != nil {
+		die("failed to load database: %s", err)
+	}
+
+	err = s.EnableBasedirDBReloading(sentinel, dir, basedirBasename, sentinelPollFrequencty)
+	if err != nil {
+		die("failed to set up database reloading: %s", err)
+	}
+
+	err = s.WatchOwnersFile(ownersPath, sentinelPollFrequencty)
+	if err != nil {
+		die("failed to set up owners file reloading: %s", err)
+	}
+}
+
+// loadGroupAreas loads the --areas file and sets up its reloading when it
+// changes.
+func loadGroupAreas(s *server.Server) {
+	err := s.LoadGroupAreasFile(areasPath)
+	if err != nil {
+		die("could not read areas csv: %s", err)
+	}
+
+	err = s.WatchGroupAreasFile(areasPath, sentinelPollFrequencty)
+	if err != nil {
+		die("failed to set up areas file reloading: %s", err)
+	}
 }
 
 // checkOAuthArgs ensures we have the necessary args/ env vars for Okta auth.
@@ -297,51 +441,6 @@ func whiteLister(gid string) bool {
 	return ok
 }
 
-// areasCSVToMap takes a group,area csv file and converts it in to a map of
-// area -> groups slice.
-func areasCSVToMap(path string) map[string][]string {
-	r, f := makeCSVReader(path)
-	defer f.Close()
-
-	areas := make(map[string][]string)
-
-	for {
-		rec, err := r.Read()
-		if errors.Is(err, io.EOF) {
-			break
-		}
-
-		if err != nil {
-			die("could not read areas csv: %s", err)
-		}
-
-		groups, present := areas[rec[1]]
-		if !present {
-			groups = []string{}
-		}
-
-		areas[rec[1]] = append(groups, rec[0])
-	}
-
-	return areas
-}
-
-// makeCSVReader opens the given path and returns a CSV reader configured for
-// 2 column CSV files. Also returns an *os.File that should you Close() after
-// reading.
-func makeCSVReader(path string) (*csv.Reader, *os.File) {
-	f, err := os.Open(path)
-	if err != nil {
-		die("could not open areas csv: %s", err)
-	}
-
-	r := csv.NewReader(f)
-	r.FieldsPerRecord = 2
-	r.ReuseRecord = true
-
-	return r, f
-}
-
 // sayStarted logs to console that the server stated. It does this a second
 // after being calling in a goroutine, when we can assume the server has
 // actually started; if it failed, we expect it to do so in less than a second
@@ -31,6 +31,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 	"time"
@@ -74,6 +75,7 @@ var (
 	whereShowUG          bool
 	whereUnused          string
 	whereUnchanged       string
+	whereGroupBy         string
 )
 
 // whereCmd represents the where command.
@@ -85,7 +87,8 @@ var whereCmd = &cobra.Command{
 Query the wrstat server by providing its URL in the form domain:port (using the
 WRSTAT_SERVER environment variable, or overriding that with a command line
 argument), and the --dir you wish to know about (defaults to the root
-directory).
+directory). --dir must be an absolute path, since it refers to a location on the
+server's view of the disks, not your current directory.
 
 This tool will show where data really lies: the deepest directory that has all
 filter-passing files nested under it. It reports the count of files nested each
@@ -137,6 +140,10 @@ is in bytes and instead of "age" you get "Atime".
 --show_ug adds columns for the users and groups that own files nested under each
 directory.
 
+--group_by 'group' or 'user' changes the output to instead show how much data
+each group or user has nested under --dir, with one row per group or user.
+--splits is ignored in this mode.
+
 If the wrstat server is using an untrusted certificate, the path to its
 certificate can be provided with --cert, or the WRSTAT_SERVER_CERT environment
 variable, to force trust in it.
@@ -186,6 +193,10 @@ with refreshes possible up to 5 days after expiry.
 			die("you must supply a --dir you wish to query")
 		}
 
+		if !filepath.IsAbs(whereQueryDir) {
+			die("--dir must be an absolute path; '%s' is relative", whereQueryDir)
+		}
+
 		minSizeBytes, err := bytefmt.ToBytes(whereSize)
 		if err != nil {
 			die("bad --size: %s", err)
@@ -202,6 +213,10 @@ with refreshes possible up to 5 days after expiry.
 			age = stringToAge("M" + whereUnchanged)
 		}
 
+		if whereGroupBy != "" && whereGroupBy != server.GroupByGroup && whereGroupBy != server.GroupByUser {
+			die("--group_by must be 'group' or 'user'")
+		}
+
 		minAtime := time.Now().Add(-(time.Duration(whereAccess*hoursPerDay) * time.Hour))
 
 		err = where(c, whereQueryDir, whereGroups, whereSupergroup, whereUsers, whereTypes, age,
@@ -247,6 +262,8 @@ func init() { //nolint:funlen
 		"unused age value to filter on (amongst 1M,2M,6M,1Y,2Y,3Y,5Y,7Y)")
 	whereCmd.Flags().StringVar(&whereUnchanged, "unchanged", "",
 		"unchanged age value to filter on (amongst 1M,2M,6M,1Y,2Y,3Y,5Y,7Y)")
+	whereCmd.Flags().StringVar(&whereGroupBy, "group_by", "",
+		"show usage under --dir per 'group' or 'user' instead of per directory")
 }
 
 // getServerURL gets the wrstat server URL from the commandline arg or
@@ -346,7 +363,7 @@ func where(c *gas.ClientCLI, dir, groups, supergroup, users, types string, age s
 		return err
 	}
 
-	body, dss, err := server.GetWhereDataIs(c, dir, groups, users, types, age, splits)
+	body, dss, err := getWhereDataIs(c, dir, groups, users, types, age, splits)
 	if err != nil {
 		return err
 	}
@@ -364,6 +381,18 @@ func where(c *gas.ClientCLI, dir, groups, supergroup, users, types string, age s
 	return nil
 }
 
+// getWhereDataIs queries the server for where data is, pivoted by group or user
+// if --group_by was supplied.
+func getWhereDataIs(c *gas.ClientCLI, dir, groups, users, types string, age summary.DirGUTAge,
+	splits string,
+) ([]byte, []*server.DirSummary, error) {
+	if whereGroupBy != "" {
+		return server.GetWhereDataIsGroupedBy(c, dir, groups, users, types, age, whereGroupBy)
+	}
+
+	return server.GetWhereDataIs(c, dir, groups, users, types, age, splits)
+}
+
 // mergeGroupsWithAreaGroups will get the groups belonging to the given
 // supergroup "group area", and merge them with the given groups, removing dups.
 func mergeGroupsWithAreaGroups(c *gas.ClientCLI, groups, supergroup string) (string, error) {
@@ -456,10 +485,19 @@ func printWhereDataIs(dss []*server.DirSummary, minSizeBytes uint64, minAtime ti
 func prepareWhereTable() *tablewriter.Table {
 	table := tablewriter.NewWriter(os.Stdout)
 
+	first := "Directory"
+
+	switch whereGroupBy {
+	case server.GroupByGroup:
+		first = "Group"
+	case server.GroupByUser:
+		first = "User"
+	}
+
 	if whereShowUG {
-		table.SetHeader([]string{"Directory", "Users", "Groups", "Count", "Size", "Age", "Modified"})
+		table.SetHeader([]string{first, "Users", "Groups", "Count", "Size", "Age", "Modified"})
 	} else {
-		table.SetHeader([]string{"Directory", "Count", "Size", "Age", "Modified"})
+		table.SetHeader([]string{first, "Count", "Size", "Age", "Modified"})
 	}
 
 	return table
@@ -473,7 +511,7 @@ func skipDS(ds *server.DirSummary, minSizeBytes uint64, minAtime time.Time) bool
 
 // columns returns the column data to display in the table for a given row.
 func columns(ds *server.DirSummary) []string {
-	cols := []string{ds.Dir}
+	cols := []string{firstColumn(ds)}
 
 	if whereShowUG {
 		cols = append(cols, strings.Join(ds.Users, ","), strings.Join(ds.Groups, ","))
@@ -486,6 +524,19 @@ func columns(ds *server.DirSummary) []string {
 		fmt.Sprintf("%d", timeToDaysAgo(ds.Mtime)))
 }
 
+// firstColumn returns the directory of the given ds, or its group or user name
+// if --group_by was supplied.
+func firstColumn(ds *server.DirSummary) string {
+	switch whereGroupBy {
+	case server.GroupByGroup:
+		return strings.Join(ds.Groups, ",")
+	case server.GroupByUser:
+		return strings.Join(ds.Users, ",")
+	}
+
+	return ds.Dir
+}
+
 // timeToDaysAgo returns the given time converted to number of days ago.
 func timeToDaysAgo(t time.Time) int {
 	return int(time.Since(t).Hours() / hoursPerDay)
@@ -0,0 +1,166 @@
+/*******************************************************************************
+ * Copyright (c) 2024 Genome Research Ltd.
+ *
+ * Author: Sendu Bala <sb10@sanger.ac.uk>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining
+ * a copy of this software and associated documentation files (the
+ * "Software"), to deal in the Software without restriction, including
+ * without limitation the rights to use, copy, modify, merge, publish,
+ * distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so, subject to
+ * the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included
+ * in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+ * CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+ * TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ ******************************************************************************/
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	gas "github.com/wtsi-hgi/go-authserver"
+	internaldata "github.com/wtsi-hgi/wrstat-ui/internal/data"
+	internaldb "github.com/wtsi-hgi/wrstat-ui/internal/db"
+	"github.com/wtsi-hgi/wrstat-ui/server"
+)
+
+// whereHelperEnv is set when the test binary is re-run by runWhereCommand() to
+// act as the wrstat-ui command.
+const whereHelperEnv = "WRSTAT_UI_TEST_WHERE_HELPER"
+
+func TestWhereHelperProcess(t *testing.T) {
+	if os.Getenv(whereHelperEnv) == "" {
+		return
+	}
+
+	args := os.Args
+
+	for i, arg := range args {
+		if arg == "--" {
+			args = args[i+1:]
+
+			break
+		}
+	}
+
+	RootCmd.SetArgs(args)
+
+	if err := RootCmd.Execute(); err != nil {
+		os.Exit(1)
+	}
+
+	os.Exit(0)
+}
+
+func TestWhere(t *testing.T) {
+	Convey("Given a server with a dguta database", t, func() {
+		cert, key, err := gas.CreateTestCert(t)
+		So(err, ShouldBeNil)
+
+		tree, path, err := internaldb.CreateDGUTADBFromFakeFiles(t, []internaldata.TestFile{
+			{Path: "/lustre/scratch/dir/a/file.bam", NumFiles: 1, SizeOfEachFile: 10, ATime: 1, MTime: 1},
+			{Path: "/lustre/scratch/dir/b/file.cram", NumFiles: 2, SizeOfEachFile: 20, ATime: 1, MTime: 1},
+		})
+		So(err, ShouldBeNil)
+
+		tree.Close()
+
+		s := server.New(io.Discard)
+
+		err = s.EnableAuth(cert, key, func(_, _ string) (bool, string) {
+			return true, ""
+		})
+		So(err, ShouldBeNil)
+
+		err = s.LoadDGUTADBs(path)
+		So(err, ShouldBeNil)
+
+		addr, dfunc, err := gas.StartTestServer(s, cert, key)
+		So(err, ShouldBeNil)
+
+		defer func() {
+			So(dfunc(), ShouldBeNil)
+		}()
+
+		t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+		c, err := gas.NewClientCLI(jwtBasename, serverTokenBasename, addr, cert, false)
+		So(err, ShouldBeNil)
+
+		err = c.Login("user", "pass")
+		So(err, ShouldBeNil)
+
+		Convey("where reports the data under an absolute --dir", func() {
+			stdout, stderr, err := runWhereCommand(t, addr, cert, "--dir", "/lustre/scratch/dir", "--splits", "1", "--json")
+			So(err, ShouldBeNil)
+			So(stderr, ShouldBeBlank)
+
+			var dss []*server.DirSummary
+
+			err = json.Unmarshal([]byte(stdout), &dss)
+			So(err, ShouldBeNil)
+			So(len(dss), ShouldEqual, 3)
+			So(dss[0].Dir, ShouldEqual, "/lustre/scratch/dir")
+			So(dss[0].Count, ShouldEqual, 3)
+			So(dss[0].Size, ShouldEqual, 50)
+			So(dss[1].Dir, ShouldEqual, "/lustre/scratch/dir/b")
+			So(dss[2].Dir, ShouldEqual, "/lustre/scratch/dir/a")
+
+			stdout, stderr, err = runWhereCommand(t, addr, cert, "--dir", "/lustre/scratch/dir", "--splits", "1",
+				"--size", "1B")
+			So(err, ShouldBeNil)
+			So(stderr, ShouldBeBlank)
+			So(stdout, ShouldContainSubstring, "/lustre/scratch/dir/a")
+			So(stdout, ShouldContainSubstring, "/lustre/scratch/dir/b")
+		})
+
+		Convey("where rejects a relative --dir without querying the server", func() {
+			stdout, stderr, err := runWhereCommand(t, addr, cert, "--dir", "lustre/scratch/dir")
+
+			var exitErr *exec.ExitError
+
+			So(errors.As(err, &exitErr), ShouldBeTrue)
+			So(exitErr.ExitCode(), ShouldEqual, 1)
+			So(stdout, ShouldBeBlank)
+			So(stderr, ShouldContainSubstring, "--dir must be an absolute path; 'lustre/scratch/dir' is relative")
+		})
+	})
+}
+
+// runWhereCommand runs 'wrstat-ui where' with the given args against the server
+// at the given address, by re-running this test binary as
+// TestWhereHelperProcess, since the command exits on failure. It returns what
+// the command wrote to STDOUT and STDERR.
+func runWhereCommand(t *testing.T, addr, cert string, args ...string) (string, string, error) {
+	t.Helper()
+
+	cmd := exec.Command(os.Args[0], append([]string{"-test.run=^TestWhereHelperProcess$", "--", "where"}, //nolint:gosec
+		args...)...)
+	cmd.Env = append(os.Environ(), whereHelperEnv+"=1", "WRSTAT_SERVER="+addr, "WRSTAT_SERVER_CERT="+cert)
+
+	var stdout, stderr strings.Builder
+
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+
+	return stdout.String(), stderr.String(), err
+}
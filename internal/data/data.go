@@ -196,7 +196,7 @@ func CreateDefaultTestData(gidA, gidB, gidC, uidA, uidB, refTime int) []TestFile
 	return files
 }
 
-func TestDGUTAData(t *testing.T, files []TestFile) string {
+func TestDGUTAData(t testing.TB, files []TestFile) string {
 	t.Helper()
 
 	dguta := summary.NewDirGroupUserTypeAge()
@@ -229,7 +229,7 @@ func (f *fakeFileInfo) ModTime() time.Time { return time.Time{} }
 func (f *fakeFileInfo) IsDir() bool        { return f.dir }
 func (f *fakeFileInfo) Sys() any           { return f.stat }
 
-func addTestFileInfo(t *testing.T, dguta *summary.DirGroupUserTypeAge, doneDirs map[string]bool,
+func addTestFileInfo(t testing.TB, dguta *summary.DirGroupUserTypeAge, doneDirs map[string]bool,
 	path string, numFiles, sizeOfEachFile, gid, uid, atime, mtime int,
 ) {
 	t.Helper()
@@ -258,7 +258,7 @@ func addTestFileInfo(t *testing.T, dguta *summary.DirGroupUserTypeAge, doneDirs
 	addTestDirInfo(t, dguta, doneDirs, filepath.Dir(path), gid, uid)
 }
 
-func addTestDirInfo(t *testing.T, dguta *summary.DirGroupUserTypeAge, doneDirs map[string]bool,
+func addTestDirInfo(t testing.TB, dguta *summary.DirGroupUserTypeAge, doneDirs map[string]bool,
 	dir string, gid, uid int,
 ) {
 	t.Helper()
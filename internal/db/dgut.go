@@ -61,7 +61,7 @@ func CreateExampleDGUTADBCustomIDs(t *testing.T, uid, gidA, gidB string, refTime
 
 // CreateCustomDGUTADB creates a dguta database in a temp directory using the
 // given dguta data, and returns the database directory.
-func CreateCustomDGUTADB(t *testing.T, dgutaData string) (string, error) {
+func CreateCustomDGUTADB(t testing.TB, dgutaData string) (string, error) {
 	t.Helper()
 
 	dir, err := createExampleDgutaDir(t)
@@ -79,7 +79,7 @@ func CreateCustomDGUTADB(t *testing.T, dgutaData string) (string, error) {
 
 // createExampleDgutaDir creates a temp directory structure to hold dguta db
 // files in the same way that 'wrstat tidy' organises them.
-func createExampleDgutaDir(t *testing.T) (string, error) {
+func createExampleDgutaDir(t testing.TB) (string, error) {
 	t.Helper()
 
 	tdir := t.TempDir()
@@ -112,7 +112,7 @@ func exampleDGUTAData(t *testing.T, uidStr, gidAStr, gidBStr string, refTime int
 	return internaldata.TestDGUTAData(t, internaldata.CreateDefaultTestData(int(gidA), int(gidB), 0, int(uid), 0, refTime))
 }
 
-func CreateDGUTADBFromFakeFiles(t *testing.T, files []internaldata.TestFile,
+func CreateDGUTADBFromFakeFiles(t testing.TB, files []internaldata.TestFile,
 	modtime ...time.Time,
 ) (*dguta.Tree, string, error) {
 	t.Helper()
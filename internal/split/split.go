@@ -1,9 +1,33 @@
+// Package split provides the functions that tell Tree.Where how deep to look.
+//
+// The contract of splits, as implemented by Tree.Where, is:
+//
+//   - Where first finds the deepest directory under the queried one that has
+//     all the filter-passing files nested under it; a chain of directories
+//     that each have only one (filter-passing) child collapses to its deepest
+//     member. This directory is always the first result, unless no files pass
+//     the filter, in which case there are no results at all.
+//   - With splits of 0, that is the only result.
+//   - With splits of n > 0, the results also include those of recursing with
+//     splits of n-1 on each of that directory's children that have
+//     filter-passing files. Children with no passing files are skipped, so a
+//     directory left with a single child and no passing files of its own
+//     collapses into that child, and its own row does not appear.
+//   - Once a directory has no children, further splits add nothing.
+//   - Results are sorted by size, largest first.
+//
+// The server's where endpoint follows this contract by default. Given a
+// collapse parameter of false, it instead never collapses chains: the queried
+// directory is always the first result (unless no files pass the filter),
+// filtered-out children never remove their parent, and no result is more than
+// splits levels below the queried directory.
 package split
 
 type SplitFn = func(string) int //nolint:revive
 
 // SplitsToSplitFn returns a simple implementation of the function passed to
-// Tree.Where.
+// Tree.Where, which uses the given splits for every directory; see the package
+// documentation.
 func SplitsToSplitFn(splits int) SplitFn {
 	return func(_ string) int {
 		return splits
@@ -0,0 +1,132 @@
+/*******************************************************************************
+ * Copyright (c) 2024 Genome Research Ltd.
+ *
+ * Author: Sendu Bala <sb10@sanger.ac.uk>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining
+ * a copy of this software and associated documentation files (the
+ * "Software"), to deal in the Software without restriction, including
+ * without limitation the rights to use, copy, modify, merge, publish,
+ * distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so, subject to
+ * the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included
+ * in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+ * CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+ * TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ ******************************************************************************/
+
+package server
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	gas "github.com/wtsi-hgi/go-authserver"
+	"github.com/wtsi-ssg/wrstat/v5/dguta"
+	"github.com/wtsi-ssg/wrstat/v5/summary"
+)
+
+const (
+	// AppliedAgeHeader is the response header the where endpoint uses to say
+	// which age bucket it applied for an atimeBefore or mtimeBefore parameter.
+	AppliedAgeHeader = "X-Applied-Age"
+
+	ErrBadAgeCutoff = gas.Error("bad query; give at most one of age, atimeBefore and mtimeBefore, " +
+		"with a cutoff being an RFC3339 time no more than 7 years before the data was gathered")
+)
+
+// ageBucketThresholds are the ages, in seconds, that the atime and mtime
+// DirGUTAge buckets (after DGUTAgeAll) correspond to, in order.
+var ageBucketThresholds = [...]int64{ //nolint:gochecknoglobals
+	summary.SecondsInAMonth, summary.SecondsInAMonth * 2, summary.SecondsInAMonth * 6,
+	summary.SecondsInAYear, summary.SecondsInAYear * 2, summary.SecondsInAYear * 3,
+	summary.SecondsInAYear * 5, summary.SecondsInAYear * 7,
+}
+
+// addAgeCutoffToFilter handles the atimeBefore and mtimeBefore parameters,
+// setting the given filter's Age to the bucket that best approximates them,
+// and saying which that was in our AppliedAgeHeader. See ageBucketFor().
+//
+// Returns ErrBadAgeCutoff if more than one of them or the age parameter were
+// supplied, or the cutoff is invalid.
+func (s *Server) addAgeCutoffToFilter(c *gin.Context, filter *dguta.Filter) error {
+	atimeBefore, mtimeBefore := c.Query("atimeBefore"), c.Query("mtimeBefore")
+	if atimeBefore == "" && mtimeBefore == "" {
+		return nil
+	}
+
+	if (atimeBefore != "" && mtimeBefore != "") || c.Query("age") != "" {
+		return ErrBadAgeCutoff
+	}
+
+	cutoffStr, isMtime := atimeBefore, false
+	if mtimeBefore != "" {
+		cutoffStr, isMtime = mtimeBefore, true
+	}
+
+	cutoff, err := time.Parse(time.RFC3339, cutoffStr)
+	if err != nil {
+		return ErrBadAgeCutoff
+	}
+
+	age, err := ageBucketFor(cutoff, s.dataReferenceTime(), isMtime)
+	if err != nil {
+		return err
+	}
+
+	filter.Age = age
+
+	c.Header(AppliedAgeHeader, strconv.Itoa(int(age)))
+
+	return nil
+}
+
+// dataReferenceTime returns the time our data was gathered, or the current time
+// if we don't know.
+func (s *Server) dataReferenceTime() time.Time {
+	s.treeMutex.RLock()
+	defer s.treeMutex.RUnlock()
+
+	if s.dataTimeStamp.IsZero() {
+		return time.Now()
+	}
+
+	return s.dataTimeStamp
+}
+
+// ageBucketFor returns the atime (or mtime if isMtime) DirGUTAge bucket that
+// best approximates "files last accessed (or modified) before cutoff", given
+// that the data was gathered at refTime. Since the buckets are fixed, the
+// youngest bucket that is at least as old as the cutoff is used, so that no
+// files newer than the cutoff are included.
+//
+// Cutoffs at or after refTime give DGUTAgeAll. Returns ErrBadAgeCutoff if the
+// cutoff is older than the oldest bucket.
+func ageBucketFor(cutoff, refTime time.Time, isMtime bool) (summary.DirGUTAge, error) {
+	age := refTime.Unix() - cutoff.Unix()
+	if age <= 0 {
+		return summary.DGUTAgeAll, nil
+	}
+
+	first := summary.DGUTAgeA1M
+	if isMtime {
+		first = summary.DGUTAgeM1M
+	}
+
+	for i, threshold := range ageBucketThresholds {
+		if threshold >= age {
+			return first + summary.DirGUTAge(i), nil
+		}
+	}
+
+	return summary.DGUTAgeAll, ErrBadAgeCutoff
+}
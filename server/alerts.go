@@ -0,0 +1,186 @@
+/*******************************************************************************
+ * Copyright (c) 2024 Genome Research Ltd.
+ *
+ * Author: Sendu Bala <sb10@sanger.ac.uk>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining
+ * a copy of this software and associated documentation files (the
+ * "Software"), to deal in the Software without restriction, including
+ * without limitation the rights to use, copy, modify, merge, publish,
+ * distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so, subject to
+ * the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included
+ * in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+ * CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+ * TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ ******************************************************************************/
+
+package server
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	gas "github.com/wtsi-hgi/go-authserver"
+	"github.com/wtsi-ssg/wrstat/v5/basedirs"
+	"github.com/wtsi-ssg/wrstat/v5/summary"
+)
+
+const (
+	ErrBadAlertsQuery = gas.Error("bad query; check days and age")
+
+	defaultAlertDays = 30
+)
+
+// QuotaAlert is a group's base directory usage that is over quota, or that is
+// predicted to run out of space or inodes within an alert window. The Usage's
+// DateNoSpace and DateNoFiles are the predictions made from the base
+// directory's history, against the Usage's quota (which may be an override).
+type QuotaAlert struct {
+	*basedirs.Usage
+	OverQuota bool
+}
+
+// getBasedirsAlerts responds with the QuotaAlerts of groups that are over
+// quota, or predicted to be within the number of days in the days parameter
+// (default 30), for the age parameter (default all). LoadBasedirsDB() must
+// already have been called. This is called when there is a GET on
+// /rest/v1/basedirs/alerts or /rest/v1/auth/basedirs/alerts.
+//
+// Users that aren't white-listed only get alerts for groups they belong to.
+func (s *Server) getBasedirsAlerts(c *gin.Context) {
+	within, age, err := getAlertsArgs(c)
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, err) //nolint:errcheck
+
+		return
+	}
+
+	allowedGIDs, err := s.allowedGIDs(c)
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, err) //nolint:errcheck
+
+		return
+	}
+
+	s.getBasedirs(c, func() (any, error) {
+		return s.quotaAlerts(time.Now().Add(within), age, allowedGIDs)
+	})
+}
+
+// getAlertsArgs gets the alert window and age from the request.
+func getAlertsArgs(c *gin.Context) (time.Duration, summary.DirGUTAge, error) {
+	days, err := strconv.ParseUint(c.DefaultQuery("days", strconv.Itoa(defaultAlertDays)), 10, 16)
+	if err != nil {
+		return 0, summary.DGUTAgeAll, ErrBadAlertsQuery
+	}
+
+	age, err := summary.AgeStringToDirGUTAge(c.DefaultQuery("age", "0"))
+	if err != nil {
+		return 0, summary.DGUTAgeAll, ErrBadAlertsQuery
+	}
+
+	return time.Duration(days) * hoursPerDay * time.Hour, age, nil
+}
+
+// quotaAlerts returns the QuotaAlerts for the group usage of the given age that
+// is over quota or will be by the deadline, restricted to the allowedGIDs if
+// not nil, soonest first. You must hold the basedirs read lock.
+func (s *Server) quotaAlerts(deadline time.Time, age summary.DirGUTAge,
+	allowedGIDs map[uint32]bool) ([]*QuotaAlert, error) {
+	usage, err := s.groupUsage(age)
+	if err != nil {
+		return nil, err
+	}
+
+	alerts := []*QuotaAlert{}
+
+	for _, u := range usage {
+		if allowedGIDs != nil && !allowedGIDs[u.GID] {
+			continue
+		}
+
+		history, err := s.basedirs.History(u.GID, u.BaseDir)
+		if err != nil && !errors.Is(err, basedirs.ErrNoBaseDirHistory) {
+			return nil, err
+		}
+
+		if alert := quotaAlert(u, history, deadline); alert != nil {
+			alerts = append(alerts, alert)
+		}
+	}
+
+	sort.SliceStable(alerts, func(i, j int) bool {
+		return soonestQuotaDate(alerts[i]).Before(soonestQuotaDate(alerts[j]))
+	})
+
+	return alerts, nil
+}
+
+// quotaAlert returns a QuotaAlert for the given usage if it's over quota, or
+// its history predicts it will run out of space or inodes by the deadline.
+// Otherwise returns nil.
+//
+// The predictions are made against the given usage's quota rather than the
+// quota recorded in the history, so that they agree with OverQuota when the
+// quota has been overridden.
+func quotaAlert(u *basedirs.Usage, history []basedirs.History, deadline time.Time) *QuotaAlert {
+	if len(history) > 0 {
+		u.DateNoSpace, u.DateNoFiles = basedirs.DateQuotaFull(withQuotaOf(history, u))
+	}
+
+	alert := &QuotaAlert{
+		Usage: u,
+		OverQuota: (u.QuotaSize > 0 && u.UsageSize >= u.QuotaSize) ||
+			(u.QuotaInodes > 0 && u.UsageInodes >= u.QuotaInodes),
+	}
+
+	if alert.OverQuota || isDueBy(u.DateNoSpace, deadline) || isDueBy(u.DateNoFiles, deadline) {
+		return alert
+	}
+
+	return nil
+}
+
+// withQuotaOf returns a copy of the given history with the quotas of its latest
+// entry, which are the ones basedirs.DateQuotaFull() uses, set to those of the
+// given usage.
+func withQuotaOf(history []basedirs.History, u *basedirs.Usage) []basedirs.History {
+	history = slices.Clone(history)
+	latest := &history[len(history)-1]
+	latest.QuotaSize = u.QuotaSize
+	latest.QuotaInodes = u.QuotaInodes
+
+	return history
+}
+
+// isDueBy returns true if t is a known date that isn't after the deadline.
+func isDueBy(t, deadline time.Time) bool {
+	return !t.IsZero() && !t.After(deadline)
+}
+
+// soonestQuotaDate returns the earlier of the alert's known DateNoSpace and
+// DateNoFiles.
+func soonestQuotaDate(alert *QuotaAlert) time.Time {
+	switch {
+	case alert.DateNoSpace.IsZero():
+		return alert.DateNoFiles
+	case alert.DateNoFiles.IsZero(), alert.DateNoSpace.Before(alert.DateNoFiles):
+		return alert.DateNoSpace
+	default:
+		return alert.DateNoFiles
+	}
+}
@@ -0,0 +1,98 @@
+/*******************************************************************************
+ * Copyright (c) 2024 Genome Research Ltd.
+ *
+ * Author: Sendu Bala <sb10@sanger.ac.uk>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining
+ * a copy of this software and associated documentation files (the
+ * "Software"), to deal in the Software without restriction, including
+ * without limitation the rights to use, copy, modify, merge, publish,
+ * distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so, subject to
+ * the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included
+ * in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+ * CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+ * TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ ******************************************************************************/
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wtsi-ssg/wrstat/v5/dguta"
+)
+
+// getAncestors responds with summaries of the path parameter and each of its
+// parent directories, root first, of files passing the usual where filter
+// parameters. This lets clients show a breadcrumb with sizes at each level.
+// LoadDGUTADB() must already have been called. This is called when there is a
+// GET on /rest/v1/auth/tree/ancestors.
+func (s *Server) getAncestors(c *gin.Context) {
+	path := c.DefaultQuery("path", defaultDir)
+
+	filter, err := s.makeRestrictedFilterFromContext(c)
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, err) //nolint:errcheck
+
+		return
+	}
+
+	var dcss dguta.DCSs
+
+	if !s.runQuery(c, func(ctx context.Context) {
+		s.treeMutex.RLock()
+		defer s.treeMutex.RUnlock()
+
+		dcss, err = s.ancestors(ctx, path, filter)
+	}) {
+		return
+	}
+
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, err) //nolint:errcheck
+
+		return
+	}
+
+	setQueryRows(c, len(dcss))
+	respond(c, http.StatusOK, s.dcssToSummaries(dcss))
+}
+
+// ancestors returns the DirInfo().Current of dir and each of its parent
+// directories, root first. Directories with no files passing the filter are
+// left out. It gives up with the context's error once ctx is done. You must
+// hold the tree read lock.
+func (s *Server) ancestors(ctx context.Context, dir string, filter *dguta.Filter) (dguta.DCSs, error) {
+	var dcss dguta.DCSs
+
+	for path := filepath.Clean(dir); ; path = filepath.Dir(path) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		di, err := s.tree.DirInfo(path, filter)
+		if err != nil {
+			return nil, err
+		}
+
+		if di != nil {
+			dcss = append(dguta.DCSs{di.Current}, dcss...)
+		}
+
+		if path == filepath.Dir(path) {
+			return dcss, nil
+		}
+	}
+}
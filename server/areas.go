@@ -0,0 +1,415 @@
+/*******************************************************************************
+ * Copyright (c) 2024 Genome Research Ltd.
+ *
+ * Author: Sendu Bala <sb10@sanger.ac.uk>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining
+ * a copy of this software and associated documentation files (the
+ * "Software"), to deal in the Software without restriction, including
+ * without limitation the rights to use, copy, modify, merge, publish,
+ * distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so, subject to
+ * the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included
+ * in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+ * CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+ * TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ ******************************************************************************/
+
+package server
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	gas "github.com/wtsi-hgi/go-authserver"
+	"github.com/wtsi-ssg/wrstat/v5/watch"
+)
+
+const (
+	ErrBadGroupAreas = gas.Error("bad group areas; every area needs a name and at least one non-blank group")
+
+	areasFilePerms = 0600
+)
+
+// GroupAreaTree is a hierarchical definition of group areas, where each area
+// can have sub-areas.
+type GroupAreaTree struct {
+	Name     string           `json:"name"`
+	Groups   []string         `json:"groups,omitempty"`
+	Children []*GroupAreaTree `json:"children,omitempty"`
+}
+
+// Flatten returns the areas in this tree in the form that AddGroupAreas()
+// takes. The groups of each area are its own followed by those of its
+// sub-areas, depth first, without duplicates. Areas with a blank name (such as
+// a root that only exists to hold the top level areas) are not included, but
+// their sub-areas are.
+func (t *GroupAreaTree) Flatten() map[string][]string {
+	areas := make(map[string][]string)
+
+	t.flattenInto(areas)
+
+	return areas
+}
+
+// flattenInto adds our area and those of our sub-areas to the given map,
+// returning all the groups we found, depth first.
+func (t *GroupAreaTree) flattenInto(areas map[string][]string) []string {
+	groups := append([]string{}, t.Groups...)
+
+	for _, child := range t.Children {
+		groups = append(groups, child.flattenInto(areas)...)
+	}
+
+	if t.Name != "" {
+		areas[t.Name] = appendUnique(areas[t.Name], groups)
+	}
+
+	return groups
+}
+
+// appendUnique appends those of the given groups to existing that aren't
+// already in it.
+func appendUnique(existing, groups []string) []string {
+	seen := make(map[string]bool, len(existing)+len(groups))
+
+	for _, group := range existing {
+		seen[group] = true
+	}
+
+	for _, group := range groups {
+		if !seen[group] {
+			seen[group] = true
+			existing = append(existing, group)
+		}
+	}
+
+	return existing
+}
+
+// AddGroupAreas takes a map of area keys and group slice values. Clients will
+// then receive this map on TreeElements in the "areas" field.
+//
+// If EnableAuth() has been called, also creates the /auth/group-areas endpoint
+// that returns the current areas, and lets white-listed users replace them
+// with a PUT of a JSON object in the same form, and the /auth/group-area-tree
+// endpoint that returns them as a GroupAreaTree.
+func (s *Server) AddGroupAreas(areas map[string][]string) {
+	s.areasMutex.Lock()
+	defer s.areasMutex.Unlock()
+
+	s.areas = areas
+	s.areaTree = nil
+
+	if s.areasEndpointsAdded {
+		return
+	}
+
+	authGroup := s.AuthRouter()
+	if authGroup != nil {
+		authGroup.GET(groupAreasPaths, s.getGroupAreas)
+		authGroup.PUT(groupAreasPaths, s.putGroupAreas)
+		authGroup.GET(groupAreaTreePath, s.getGroupAreaTree)
+
+		s.areasEndpointsAdded = true
+	}
+}
+
+// AddGroupAreaTree is like AddGroupAreas(), but takes nested areas. Clients
+// will receive tree.Flatten() on TreeElements, and the tree itself from the
+// /auth/group-area-tree endpoint, until the areas are next replaced.
+func (s *Server) AddGroupAreaTree(tree *GroupAreaTree) {
+	s.AddGroupAreas(tree.Flatten())
+
+	s.areasMutex.Lock()
+	defer s.areasMutex.Unlock()
+
+	s.areaTree = tree
+}
+
+// LoadGroupAreasFile reads the group,area CSV file at the given path and
+// passes the areas in it to AddGroupAreas(). Areas PUT by white-listed users
+// will then also be written back to this file.
+func (s *Server) LoadGroupAreasFile(path string) error {
+	areas, err := readGroupAreas(path)
+	if err != nil {
+		return err
+	}
+
+	s.AddGroupAreas(areas)
+
+	s.areasMutex.Lock()
+	defer s.areasMutex.Unlock()
+
+	s.areasPath = path
+
+	return nil
+}
+
+// WatchGroupAreasFile will wait for changes to the mtime of the group,area CSV
+// file at the given path, then reload the group areas from it, so that
+// updated areas are reflected in subsequent queries without a restart.
+//
+// LoadGroupAreasFile() should already have been called. It will only return an
+// error if trying to watch path immediately fails. Other errors (eg. parsing
+// the new areas file) will be logged, and the previous areas will continue to
+// be used.
+func (s *Server) WatchGroupAreasFile(path string, interval time.Duration) error {
+	s.areasMutex.Lock()
+	defer s.areasMutex.Unlock()
+
+	cb := func(_ time.Time) {
+		s.reloadGroupAreas(path)
+	}
+
+	watcher, err := watch.New(path, cb, interval)
+	if err != nil {
+		return err
+	}
+
+	s.areasWatcher = watcher
+
+	return nil
+}
+
+// reloadGroupAreas replaces our group areas with those in the file at the given
+// path.
+//
+// Logs any errors.
+func (s *Server) reloadGroupAreas(path string) {
+	s.Logger.Printf("reloading group areas from %s", path)
+
+	areas, err := readGroupAreas(path)
+	if err != nil {
+		s.Logger.Printf("reloading group areas failed: %s", err)
+
+		return
+	}
+
+	s.areasMutex.Lock()
+	defer s.areasMutex.Unlock()
+
+	s.areas = areas
+	s.areaTree = nil
+}
+
+// readGroupAreas reads the given group,area CSV file and converts it in to a
+// map of area -> groups slice.
+func readGroupAreas(path string) (map[string][]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = 2
+	r.ReuseRecord = true
+
+	areas := make(map[string][]string)
+
+	for {
+		rec, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		areas[rec[1]] = append(areas[rec[1]], rec[0])
+	}
+
+	if err := validateGroupAreas(areas); err != nil {
+		return nil, err
+	}
+
+	return areas, nil
+}
+
+// validateGroupAreas returns ErrBadGroupAreas if any area has a blank name, no
+// groups, or a blank group.
+func validateGroupAreas(areas map[string][]string) error {
+	for area, groups := range areas {
+		if area == "" || len(groups) == 0 {
+			return ErrBadGroupAreas
+		}
+
+		for _, group := range groups {
+			if group == "" {
+				return ErrBadGroupAreas
+			}
+		}
+	}
+
+	return nil
+}
+
+// writeGroupAreas writes the given areas to the given path as a group,area CSV
+// file, sorted by area. The file is replaced atomically, so that anything
+// watching it never sees it partially written.
+func writeGroupAreas(path string, areas map[string][]string) error {
+	names := make([]string, 0, len(areas))
+
+	for area := range areas {
+		names = append(names, area)
+	}
+
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+
+	w := csv.NewWriter(&buf)
+
+	for _, area := range names {
+		for _, group := range areas[area] {
+			if err := w.Write([]string{group, area}); err != nil {
+				return err
+			}
+		}
+	}
+
+	w.Flush()
+
+	if err := w.Error(); err != nil {
+		return err
+	}
+
+	return writeFileAtomically(path, buf.Bytes())
+}
+
+// writeFileAtomically writes data to a new temporary file in the same directory
+// as path, then renames it to path. The file keeps the permissions of any
+// existing file at path, or otherwise gets areasFilePerms.
+func writeFileAtomically(path string, data []byte) error {
+	perms := os.FileMode(areasFilePerms)
+
+	if info, err := os.Stat(path); err == nil {
+		perms = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	if err = writeAndClose(tmp, data, perms); err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name()) //nolint:errcheck
+	}
+
+	return err
+}
+
+// writeAndClose writes data to the given file, sets its permissions and closes
+// it.
+func writeAndClose(f *os.File, data []byte, perms os.FileMode) error {
+	_, err := f.Write(data)
+	if err == nil {
+		err = f.Chmod(perms)
+	}
+
+	return errors.Join(err, f.Close())
+}
+
+// groupAreas returns our current group areas.
+func (s *Server) groupAreas() map[string][]string {
+	s.areasMutex.RLock()
+	defer s.areasMutex.RUnlock()
+
+	return s.areas
+}
+
+// getGroupAreas serves up our areas hash as JSON.
+func (s *Server) getGroupAreas(c *gin.Context) {
+	c.IndentedJSON(http.StatusOK, s.groupAreas())
+}
+
+// putGroupAreas lets white-listed users replace our group areas with those
+// given as a JSON object of area keys and group slice values, persisting them
+// to the file given to LoadGroupAreasFile(), if any. It responds with the new
+// areas.
+//
+// This is called when there is a PUT on /rest/v1/auth/group-areas.
+func (s *Server) putGroupAreas(c *gin.Context) {
+	if !s.requireAdmin(c) {
+		return
+	}
+
+	var areas map[string][]string
+
+	if err := c.ShouldBindJSON(&areas); err != nil || areas == nil || validateGroupAreas(areas) != nil {
+		c.AbortWithError(http.StatusBadRequest, ErrBadGroupAreas) //nolint:errcheck
+
+		return
+	}
+
+	s.areasMutex.Lock()
+	defer s.areasMutex.Unlock()
+
+	if s.areasPath != "" {
+		if err := writeGroupAreas(s.areasPath, areas); err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err) //nolint:errcheck
+
+			return
+		}
+	}
+
+	s.areas = areas
+	s.areaTree = nil
+
+	c.IndentedJSON(http.StatusOK, areas)
+}
+
+// getGroupAreaTree serves up the GroupAreaTree given to AddGroupAreaTree() as
+// JSON. If the areas weren't nested, it serves a tree with a nameless root
+// whose children are our areas, sorted by name.
+//
+// This is called when there is a GET on /rest/v1/auth/group-area-tree.
+func (s *Server) getGroupAreaTree(c *gin.Context) {
+	s.areasMutex.RLock()
+	defer s.areasMutex.RUnlock()
+
+	tree := s.areaTree
+	if tree == nil {
+		tree = flatGroupAreaTree(s.areas)
+	}
+
+	c.IndentedJSON(http.StatusOK, tree)
+}
+
+// flatGroupAreaTree returns a GroupAreaTree with a nameless root whose children
+// are the given areas, sorted by name.
+func flatGroupAreaTree(areas map[string][]string) *GroupAreaTree {
+	tree := &GroupAreaTree{Children: make([]*GroupAreaTree, 0, len(areas))}
+
+	for area, groups := range areas {
+		tree.Children = append(tree.Children, &GroupAreaTree{Name: area, Groups: groups})
+	}
+
+	sort.Slice(tree.Children, func(i, j int) bool {
+		return tree.Children[i].Name < tree.Children[j].Name
+	})
+
+	return tree
+}
@@ -28,9 +28,14 @@
 package server
 
 import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
 	gas "github.com/wtsi-hgi/go-authserver"
 )
 
+const ErrNotAdmin = gas.Error("only white-listed users are allowed to do that")
+
 // userGIDs returns the unix group IDs for the given User's UIDs. This calls
 // *User.GIDs(), but caches the result against username, and returns cached
 // results if possible.
@@ -86,3 +91,23 @@ func (s *Server) whiteListed(gids []string) bool {
 
 	return false
 }
+
+// requireAdmin returns true if the requesting user belongs to a white-listed
+// group. Otherwise it aborts the request with a 403 (or 400 if their groups
+// couldn't be determined) and returns false.
+func (s *Server) requireAdmin(c *gin.Context) bool {
+	allowedGIDs, err := s.allowedGIDs(c)
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, err) //nolint:errcheck
+
+		return false
+	}
+
+	if allowedGIDs != nil || s.whiteCB == nil {
+		c.AbortWithError(http.StatusForbidden, ErrNotAdmin) //nolint:errcheck
+
+		return false
+	}
+
+	return true
+}
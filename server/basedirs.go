@@ -26,10 +26,13 @@
 package server
 
 import (
+	"crypto/sha256"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -40,7 +43,11 @@ import (
 	"github.com/wtsi-ssg/wrstat/v5/watch"
 )
 
-const ErrBadBasedirsQuery = gas.Error("bad query; check id and basedir")
+const (
+	ErrBadBasedirsQuery = gas.Error("bad query; check id and basedir")
+	ErrBasedirsDisabled = gas.Error("basedirs database not loaded")
+	ErrBadBasedirsAge   = gas.Error("bad query; check age")
+)
 
 // LoadBasedirsDB loads the given basedirs.db file (as produced by
 // basedirs.CreateDatabase()) and makes use of the given owners file (a
@@ -48,54 +55,121 @@ const ErrBadBasedirsQuery = gas.Error("bad query; check id and basedir")
 //
 // /rest/v1/basedirs/usage/groups
 // /rest/v1/basedirs/usage/users
+// /rest/v1/basedirs/usage/owner
 // /rest/v1/basedirs/subdirs/group
 // /rest/v1/basedirs/subdirs/user
 // /rest/v1/basedirs/history
+// /rest/v1/basedirs/alerts
 //
 // If you call EnableAuth() first, then these endpoints will be secured and be
 // available at /rest/v1/auth/basedirs/*.
 //
+// It also adds a GET endpoint at /rest/v1/compare (or /rest/v1/auth/compare);
+// see getCompare(). If you call EnableAuth() first, it also adds
+// /rest/v1/auth/mounts and /rest/v1/auth/forecast; see getMounts() and
+// getForecast().
+//
+// The group and user usage endpoints return usage for all ages, unless given an
+// age parameter, in which case they only return usage for that age.
+//
+// The owner endpoint requires an owner parameter, and returns the group usage of
+// all the groups that owner owns.
+//
 // The subdir endpoints require id (gid or uid) and basedir parameters.
 // The history endpoint requires a gid and basedir (can be basedir, actually a
 // mountpoint) parameter.
+//
+// The alerts endpoint takes optional days and age parameters; see
+// getBasedirsAlerts().
+//
+// If you call EnableAuth() first, white-listed users can also override the
+// quotas of a group's base directory with a PATCH (or clear it with a DELETE)
+// on /rest/v1/auth/basedirs/usage/groups/:gid; see patchQuotaOverride(). The
+// overrides are forgotten when the database is reloaded, unless you call
+// SetQuotaOverridesFile().
 func (s *Server) LoadBasedirsDB(dbPath, ownersPath string) error {
 	s.basedirsMutex.Lock()
 	defer s.basedirsMutex.Unlock()
 
-	bd, err := basedirs.NewReader(dbPath, ownersPath)
+	bd, err := s.openBasedirs(dbPath, ownersPath)
 	if err != nil {
 		return err
 	}
 
+	byGID, usage, err := indexGroupUsage(bd)
+	if err != nil {
+		bd.Close()
+
+		return err
+	}
+
 	s.basedirs = bd
 	s.basedirsPath = dbPath
 	s.ownersPath = ownersPath
+	s.ownerGIDs = ownerToGIDsIndex(usage)
+	s.groupUsageByGID = byGID
+	s.setBasedirsCacheValidators()
 
-	authGroup := s.AuthRouter()
+	s.addBasedirsEndpoints(func(handler gin.HandlerFunc) gin.HandlerFunc { return handler })
 
-	if authGroup == nil {
-		s.Router().GET(EndPointBasedirUsageGroup, s.getBasedirsGroupUsage)
-		s.Router().GET(EndPointBasedirUsageUser, s.getBasedirsUserUsage)
-		s.Router().GET(EndPointBasedirSubdirGroup, s.getBasedirsGroupSubdirs)
-		s.Router().GET(EndPointBasedirSubdirUser, s.getBasedirsUserSubdirs)
-		s.Router().GET(EndPointBasedirHistory, s.getBasedirsHistory)
-	} else {
-		authGroup.GET(basedirsGroupUsagePath, s.getBasedirsGroupUsage)
-		authGroup.GET(basedirsUserUsagePath, s.getBasedirsUserUsage)
-		authGroup.GET(basedirsGroupSubdirPath, s.getBasedirsGroupSubdirs)
-		authGroup.GET(basedirsUserSubdirPath, s.getBasedirsUserSubdirs)
-		authGroup.GET(basedirsHistoryPath, s.getBasedirsHistory)
+	if authGroup := s.AuthRouter(); authGroup != nil {
+		authGroup.PATCH(basedirsGroupOverridePath, s.patchQuotaOverride)
+		authGroup.DELETE(basedirsGroupOverridePath, s.deleteQuotaOverride)
 	}
 
 	return nil
 }
 
+// DisableBasedirs is an alternative to LoadBasedirsDB() for when you have no
+// basedirs database. It adds the same endpoints that LoadBasedirsDB() would,
+// but they all respond with a 404 and a JSON body of {"error":"basedirs
+// database not loaded"}, so that clients can tell the feature is disabled,
+// rather than the endpoint being unknown.
+func (s *Server) DisableBasedirs() {
+	s.addBasedirsEndpoints(func(_ gin.HandlerFunc) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": ErrBasedirsDisabled.Error()})
+		}
+	})
+}
+
+// addBasedirsEndpoints adds our basedirs related endpoints to version 1 of the
+// API, in its auth group if auth has been enabled. Each of our handlers is
+// passed through the given wrap function before being added.
+func (s *Server) addBasedirsEndpoints(wrap func(gin.HandlerFunc) gin.HandlerFunc) {
+	handlers := map[string]gin.HandlerFunc{
+		basedirsGroupUsagePath:  s.getBasedirsGroupUsage,
+		basedirsUserUsagePath:   s.getBasedirsUserUsage,
+		basedirsOwnerUsagePath:  s.getBasedirsOwnerUsage,
+		basedirsGroupSubdirPath: s.getBasedirsGroupSubdirs,
+		basedirsUserSubdirPath:  s.getBasedirsUserSubdirs,
+		basedirsHistoryPath:     s.getBasedirsHistory,
+		basedirsAlertsPath:      s.getBasedirsAlerts,
+		comparePath:             s.getCompare,
+	}
+
+	if s.AuthRouter() != nil {
+		handlers[forecastPath] = s.getForecast
+	}
+
+	routes := s.routes(apiV1)
+
+	for path, handler := range handlers {
+		routes.GET(path, wrap(handler))
+	}
+}
+
 func (s *Server) getBasedirsGroupUsage(c *gin.Context) {
-	s.getBasedirs(c, func() (any, error) {
+	ages, ok := getUsageAges(c)
+	if !ok {
+		return
+	}
+
+	s.getCacheableBasedirs(c, func() (any, error) {
 		var results []*basedirs.Usage
 
-		for _, age := range summary.DirGUTAges {
-			result, err := s.basedirs.GroupUsage(age)
+		for _, age := range ages {
+			result, err := s.groupUsage(age)
 			if err != nil {
 				return nil, err
 			}
@@ -107,6 +181,24 @@ func (s *Server) getBasedirsGroupUsage(c *gin.Context) {
 	})
 }
 
+// getUsageAges returns the age given in the request's age parameter, or all
+// ages if there wasn't one. If not ok, the request has already been aborted.
+func getUsageAges(c *gin.Context) ([]summary.DirGUTAge, bool) {
+	ageStr := c.Query("age")
+	if ageStr == "" {
+		return summary.DirGUTAges[:], true
+	}
+
+	age, err := summary.AgeStringToDirGUTAge(ageStr)
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, ErrBadBasedirsAge) //nolint:errcheck
+
+		return nil, false
+	}
+
+	return []summary.DirGUTAge{age}, true
+}
+
 // getBasedirs responds with the output of your callback in JSON format.
 // LoadBasedirsDB() must already have been called.
 //
@@ -116,6 +208,88 @@ func (s *Server) getBasedirs(c *gin.Context, cb func() (any, error)) {
 	s.basedirsMutex.RLock()
 	defer s.basedirsMutex.RUnlock()
 
+	respondWithBasedirs(c, cb)
+}
+
+// getCacheableBasedirs is like getBasedirs(), but also sets ETag and
+// Last-Modified headers based on the currently loaded basedirs database and
+// owners file, and responds with a 304 (without calling your callback) if the
+// request's If-None-Match or If-Modified-Since headers show the client already
+// has the current data.
+func (s *Server) getCacheableBasedirs(c *gin.Context, cb func() (any, error)) {
+	s.basedirsMutex.RLock()
+	defer s.basedirsMutex.RUnlock()
+
+	c.Header("ETag", s.basedirsETag)
+	c.Header("Last-Modified", s.basedirsModTime.UTC().Format(http.TimeFormat))
+
+	if isNotModified(c.Request, s.basedirsETag, s.basedirsModTime) {
+		c.AbortWithStatus(http.StatusNotModified)
+
+		return
+	}
+
+	respondWithBasedirs(c, cb)
+}
+
+// isNotModified returns true if the given request's If-None-Match header
+// matches the given etag, or, if it has no If-None-Match header, its
+// If-Modified-Since header is not before the given modTime.
+func isNotModified(r *http.Request, etag string, modTime time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == etag || candidate == "*" {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+
+	return !modTime.Truncate(time.Second).After(ims)
+}
+
+// setBasedirsCacheValidators updates the ETag and modification time we use
+// for cacheable basedirs responses, based on the path and mtime of our basedirs
+// database and owners file, and our quota overrides. Call this whenever any of
+// them change.
+func (s *Server) setBasedirsCacheValidators() {
+	h := sha256.New()
+
+	var latest time.Time
+
+	for _, path := range []string{s.basedirsPath, s.ownersPath} {
+		var mtime time.Time
+
+		if info, err := os.Stat(path); err == nil {
+			mtime = info.ModTime()
+		}
+
+		if mtime.After(latest) {
+			latest = mtime
+		}
+
+		fmt.Fprintf(h, "%s\x00%d\x00", path, mtime.UnixNano())
+	}
+
+	fmt.Fprintf(h, "%d", s.overridesVersion)
+
+	if s.overridesModTime.After(latest) {
+		latest = s.overridesModTime
+	}
+
+	s.basedirsETag = fmt.Sprintf(`"%x"`, h.Sum(nil))
+	s.basedirsModTime = latest
+}
+
+// respondWithBasedirs responds with the output of your callback in JSON format.
+func respondWithBasedirs(c *gin.Context, cb func() (any, error)) {
 	result, err := cb()
 	if err != nil {
 		c.AbortWithError(http.StatusBadRequest, err) //nolint:errcheck
@@ -123,14 +297,20 @@ func (s *Server) getBasedirs(c *gin.Context, cb func() (any, error)) {
 		return
 	}
 
-	c.IndentedJSON(http.StatusOK, result)
+	setQueryRows(c, resultRows(result))
+	respond(c, http.StatusOK, result)
 }
 
 func (s *Server) getBasedirsUserUsage(c *gin.Context) {
-	s.getBasedirs(c, func() (any, error) {
+	ages, ok := getUsageAges(c)
+	if !ok {
+		return
+	}
+
+	s.getCacheableBasedirs(c, func() (any, error) {
 		var results []*basedirs.Usage
 
-		for _, age := range summary.DirGUTAges {
+		for _, age := range ages {
 			result, err := s.basedirs.UserUsage(age)
 			if err != nil {
 				return nil, err
@@ -143,6 +323,127 @@ func (s *Server) getBasedirsUserUsage(c *gin.Context) {
 	})
 }
 
+// openBasedirs opens the given basedirs database with the given owners file,
+// using any mount points set with SetMountPoints().
+func (s *Server) openBasedirs(dbPath, ownersPath string) (*basedirs.BaseDirReader, error) {
+	bd, err := basedirs.NewReader(dbPath, ownersPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.mountPoints != nil {
+		bd.SetMountPoints(s.mountPoints)
+	}
+
+	return bd, nil
+}
+
+// indexGroupUsage reads the group usage of every age from the given reader and
+// returns it keyed on age and then GID, so that the usage of particular groups
+// can later be looked up without scanning the database. It also returns the
+// usage for DGUTAgeAll.
+func indexGroupUsage(bd *basedirs.BaseDirReader) (map[summary.DirGUTAge]map[uint32][]*basedirs.Usage,
+	[]*basedirs.Usage, error,
+) {
+	byGID := make(map[summary.DirGUTAge]map[uint32][]*basedirs.Usage, len(summary.DirGUTAges))
+
+	var all []*basedirs.Usage
+
+	for _, age := range summary.DirGUTAges {
+		usage, err := bd.GroupUsage(age)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		index := make(map[uint32][]*basedirs.Usage)
+
+		for _, u := range usage {
+			index[u.GID] = append(index[u.GID], u)
+		}
+
+		byGID[age] = index
+
+		if age == summary.DGUTAgeAll {
+			all = usage
+		}
+	}
+
+	return byGID, all, nil
+}
+
+// ownerToGIDsIndex returns a map of owner name to the GIDs of the groups that
+// owner owns, according to the given group usage.
+func ownerToGIDsIndex(usage []*basedirs.Usage) map[string][]uint32 {
+	index := make(map[string][]uint32)
+	seen := make(map[uint32]bool)
+
+	for _, u := range usage {
+		if u.Owner == "" || seen[u.GID] {
+			continue
+		}
+
+		seen[u.GID] = true
+		index[u.Owner] = append(index[u.Owner], u.GID)
+	}
+
+	return index
+}
+
+func (s *Server) getBasedirsOwnerUsage(c *gin.Context) {
+	owner := c.Query("owner")
+	if owner == "" {
+		c.AbortWithError(http.StatusBadRequest, ErrBadBasedirsQuery) //nolint:errcheck
+
+		return
+	}
+
+	ages, ok := getUsageAges(c)
+	if !ok {
+		return
+	}
+
+	s.getBasedirs(c, func() (any, error) {
+		return s.groupsByOwner(owner, ages), nil
+	})
+}
+
+// GroupsByOwner returns the group usage of every group owned by the given
+// owner, as per the owners file supplied to LoadBasedirsDB(), for the given
+// ages, or for all ages if none are given. Returns an empty slice if the owner
+// owns no groups, and ErrBasedirsDisabled if LoadBasedirsDB() hasn't been
+// called.
+func (s *Server) GroupsByOwner(owner string, ages ...summary.DirGUTAge) ([]*basedirs.Usage, error) {
+	s.basedirsMutex.RLock()
+	defer s.basedirsMutex.RUnlock()
+
+	if s.basedirs == nil {
+		return nil, ErrBasedirsDisabled
+	}
+
+	if len(ages) == 0 {
+		ages = summary.DirGUTAges[:]
+	}
+
+	return s.groupsByOwner(owner, ages), nil
+}
+
+// groupsByOwner is GroupsByOwner() for when you already hold the basedirs read
+// lock. It looks up the owner's groups in our group usage index, so doesn't
+// touch the database.
+func (s *Server) groupsByOwner(owner string, ages []summary.DirGUTAge) []*basedirs.Usage {
+	results := []*basedirs.Usage{}
+
+	for _, age := range ages {
+		for _, gid := range s.ownerGIDs[owner] {
+			for _, u := range s.groupUsageByGID[age][gid] {
+				results = append(results, s.withQuotaOverride(u))
+			}
+		}
+	}
+
+	return results
+}
+
 func (s *Server) getBasedirsGroupSubdirs(c *gin.Context) {
 	allowedGIDs, err := s.allowedGIDs(c)
 	if err != nil {
@@ -267,13 +568,14 @@ func (s *Server) getBasedirsHistory(c *gin.Context) {
 }
 
 // EnableBasedirDBReloading will wait for changes to the file at watchPath, then:
-//  1. close any previously loaded basedirs database file
-//  2. find the latest file in the given directory with the given suffix
-//  3. set the basedirs.db directory path to that and load it
-//  4. delete the old basedirs.db file
+//  1. find the latest file in the given directory with the given suffix
+//  2. load it, and if that succeeds, use it in place of the previously loaded
+//     basedirs database file, closing that
+//  3. delete the old basedirs.db file
 //
 // It will only return an error if trying to watch watchPath immediately fails.
-// Other errors (eg. reloading or deleting files) will be logged.
+// Other errors (eg. reloading or deleting files) will be logged, and can be
+// retrieved with LastReloadError().
 func (s *Server) EnableBasedirDBReloading(watchPath, dir, suffix string, pollFrequency time.Duration) error {
 	s.basedirsMutex.Lock()
 	defer s.basedirsMutex.Unlock()
@@ -292,71 +594,196 @@ func (s *Server) EnableBasedirDBReloading(watchPath, dir, suffix string, pollFre
 	return nil
 }
 
-// reloadBasedirsDB closes the database file previously loaded during
-// LoadBasedirsDB(), looks for the latest file in the given directory that has
-// the given suffix, and loads that as our new basedirsPath.
+// reloadBasedirsDB looks for the latest file in the given directory that has
+// the given suffix, and if it's new, loads it as our new basedirsPath.
+//
+// If there is no such file (eg. the latest run didn't produce a basedirs
+// database), or it fails to load, we carry on using the previous database.
 //
-// On success, deletes the previous basedirsPath.
+// On success, closes and deletes the previous basedirsPath.
 //
-// Logs any errors.
+// Logs any errors, which are also recorded for LastReloadError().
 func (s *Server) reloadBasedirsDB(dir, suffix string) {
-	s.basedirsMutex.Lock()
-	defer s.basedirsMutex.Unlock()
+	s.basedirsReloadMutex.Lock()
+	defer s.basedirsReloadMutex.Unlock()
 
-	if s.basedirs != nil {
-		s.basedirs.Close()
-	}
-
-	oldPath := s.basedirsPath
+	start := time.Now()
 
-	err := s.findNewBasedirsPath(dir, suffix)
+	path, err := FindLatestBasedirsDB(dir, suffix)
 	if err != nil {
-		s.Logger.Printf("reloading basedirs db failed: %s", err)
+		s.recordReload("basedirs db", start, 0, err)
 
 		return
 	}
 
-	if s.basedirsPath == oldPath {
+	s.basedirsMutex.RLock()
+	currentPath, ownersPath := s.basedirsPath, s.ownersPath
+	s.basedirsMutex.RUnlock()
+
+	if path == currentPath {
 		return
 	}
 
-	s.loadNewBasedirsDBAndDeleteOld(oldPath)
+	s.loadNewBasedirsDBAndDeleteOld(path, ownersPath)
 }
 
-// findNewBasedirsPath finds the latest file in dir that has the given suffix,
-// then sets our basedirsPath to the result.
-func (s *Server) findNewBasedirsPath(dir, suffix string) error {
-	path, err := FindLatestBasedirsDB(dir, suffix)
+// FindLatestBasedirsDB finds the latest file in dir that has the given suffix.
+func FindLatestBasedirsDB(dir, suffix string) (string, error) {
+	return ifs.FindLatestDirectoryEntry(dir, suffix)
+}
+
+// WatchOwnersFile will wait for changes to the mtime of the owners file at the
+// given path, then reload the basedirs database with that owners file, so that
+// updated group owners are reflected in subsequent queries without a restart.
+//
+// LoadBasedirsDB() must already have been called. It will only return an error
+// if trying to watch path immediately fails. Other errors (eg. parsing the new
+// owners file) will be logged, and the previous owners will continue to be
+// used.
+func (s *Server) WatchOwnersFile(path string, interval time.Duration) error {
+	s.basedirsMutex.Lock()
+	defer s.basedirsMutex.Unlock()
+
+	cb := func(_ time.Time) {
+		s.reloadOwners(path)
+	}
+
+	watcher, err := watch.New(path, cb, interval)
 	if err != nil {
 		return err
 	}
 
-	s.basedirsPath = path
+	s.ownersWatcher = watcher
 
 	return nil
 }
 
-// FindLatestBasedirsDB finds the latest file in dir that has the given suffix.
-func FindLatestBasedirsDB(dir, suffix string) (string, error) {
-	return ifs.FindLatestDirectoryEntry(dir, suffix)
+// reloadOwners re-opens our current basedirs database with the owners file at
+// the given path, and swaps it in for the currently loaded one.
+//
+// Logs any errors, which are also recorded for LastReloadError().
+func (s *Server) reloadOwners(path string) {
+	s.basedirsReloadMutex.Lock()
+	defer s.basedirsReloadMutex.Unlock()
+
+	start := time.Now()
+
+	s.Logger.Printf("reloading owners from %s", path)
+
+	s.basedirsMutex.RLock()
+	dbPath := s.basedirsPath
+	s.basedirsMutex.RUnlock()
+
+	prepared, err := s.prepareBasedirs(dbPath, path)
+	if err != nil {
+		s.recordReload("owners", start, 0, err)
+
+		return
+	}
+
+	s.basedirsMutex.Lock()
+
+	s.swapBasedirs(prepared)
+	s.ownersPath = path
+	s.setBasedirsCacheValidators()
+
+	s.basedirsMutex.Unlock()
+
+	s.recordReload("owners", start, len(prepared.ownerGIDs), nil)
 }
 
-func (s *Server) loadNewBasedirsDBAndDeleteOld(oldPath string) {
-	s.Logger.Printf("reloading basedirs db from %s", s.basedirsPath)
+// loadNewBasedirsDBAndDeleteOld opens the basedirs database at the given path
+// with the given owners file and, only if that succeeds, swaps it in for our
+// current one, which is then closed and deleted. Queries continue to use the
+// current database while the new one is being prepared.
+func (s *Server) loadNewBasedirsDBAndDeleteOld(path, ownersPath string) {
+	start := time.Now()
 
-	var err error
+	s.Logger.Printf("reloading basedirs db from %s", path)
 
-	s.basedirs, err = basedirs.NewReader(s.basedirsPath, s.ownersPath)
+	prepared, err := s.prepareBasedirs(path, ownersPath)
 	if err != nil {
-		s.Logger.Printf("reloading basedirs db failed: %s", err)
+		s.recordReload("basedirs db", start, 0, err)
 
 		return
 	}
 
-	s.Logger.Printf("server ready again after reloading dguta dbs")
+	s.basedirsMutex.Lock()
+
+	oldPath := s.basedirsPath
+
+	s.swapBasedirs(prepared)
+	s.basedirsPath = path
+	s.resetQuotaOverrides()
+
+	s.basedirsMutex.Unlock()
+
+	s.Logger.Printf("server ready again after reloading basedirs db")
+	s.recordReload("basedirs db", start, prepared.records, nil)
 
 	err = os.Remove(oldPath)
 	if err != nil {
 		s.Logger.Printf("deletion of old basedirs db after reload failed: %s", err)
 	}
 }
+
+// preparedBasedirs is a newly opened basedirs database, ready to be swapped in
+// for our current one.
+type preparedBasedirs struct {
+	reader     *basedirs.BaseDirReader
+	ownerGIDs  map[string][]uint32
+	usageByGID map[summary.DirGUTAge]map[uint32][]*basedirs.Usage
+	records    int
+}
+
+// prepareBasedirs opens the given basedirs database and owners file and
+// indexes its owners and group usage, logging how long that took. It does not hold the
+// basedirs lock while doing so, so that queries on our current database are
+// not blocked.
+func (s *Server) prepareBasedirs(dbPath, ownersPath string) (*preparedBasedirs, error) {
+	start := time.Now()
+
+	s.basedirsMutex.RLock()
+	bd, err := s.openBasedirs(dbPath, ownersPath)
+	s.basedirsMutex.RUnlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	byGID, usage, err := indexGroupUsage(bd)
+	if err != nil {
+		bd.Close()
+
+		return nil, err
+	}
+
+	s.Logger.Printf("prepared basedirs db %s in %s", dbPath, time.Since(start))
+
+	if s.basedirsPrepared != nil {
+		s.basedirsPrepared()
+	}
+
+	return &preparedBasedirs{
+		reader:     bd,
+		ownerGIDs:  ownerToGIDsIndex(usage),
+		usageByGID: byGID,
+		records:    len(usage),
+	}, nil
+}
+
+// swapBasedirs closes our current basedirs reader and replaces it and our
+// owner and group usage indexes with the prepared ones. You must hold the basedirs write lock.
+func (s *Server) swapBasedirs(prepared *preparedBasedirs) {
+	if s.mountPoints != nil {
+		prepared.reader.SetMountPoints(s.mountPoints)
+	}
+
+	if s.basedirs != nil {
+		s.basedirs.Close()
+	}
+
+	s.basedirs = prepared.reader
+	s.ownerGIDs = prepared.ownerGIDs
+	s.groupUsageByGID = prepared.usageByGID
+}
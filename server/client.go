@@ -28,14 +28,34 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"net/url"
 	"strconv"
+	"time"
 
 	gas "github.com/wtsi-hgi/go-authserver"
 	"github.com/wtsi-ssg/wrstat/v5/summary"
 )
 
-const ErrBadQuery = gas.Error("bad query; check dir, group, user and type")
+const (
+	ErrBadQuery = gas.Error("bad query; check dir, group, user and type")
+
+	defaultRetryBackoff = 100 * time.Millisecond
+)
+
+// WhereOptions let you control how GetWhereDataIsCtx() deals with transient
+// failures.
+type WhereOptions struct {
+	// Retries is the number of extra attempts made after a connection error
+	// or 5xx response.
+	Retries int
+
+	// Backoff is how long to wait before the first retry; it doubles on each
+	// subsequent retry. Defaults to 100ms.
+	Backoff time.Duration
+}
 
 // GetGroupAreas is a client call to a Server that queries its configured group
 // area information. The returned map has area keys and group slices.
@@ -60,6 +80,29 @@ func GetGroupAreas(c *gas.ClientCLI) (map[string][]string, error) {
 	return *resp.Result().(*map[string][]string), nil //nolint:forcetypeassert
 }
 
+// GetGroupAreaTree is a client call to a Server that queries its configured
+// group areas as a GroupAreaTree.
+func GetGroupAreaTree(c *gas.ClientCLI) (*GroupAreaTree, error) {
+	r, err := c.AuthenticatedRequest()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.SetResult(&GroupAreaTree{}).
+		ForceContentType("application/json").
+		Get(EndPointAuthGroupAreaTree)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode() {
+	case http.StatusUnauthorized, http.StatusNotFound:
+		return nil, gas.ErrNoAuth
+	}
+
+	return resp.Result().(*GroupAreaTree), nil //nolint:forcetypeassert
+}
+
 // GetWhereDataIs is a client call to a Server listening at the given
 // domain:port url that queries where data is and returns the raw response body
 // (JSON string), and that body converted in to a slice of *DirSummary.
@@ -72,32 +115,216 @@ func GetGroupAreas(c *gas.ClientCLI) (map[string][]string, error) {
 // The other parameters correspond to arguments that dguta.Tree.Where() takes.
 func GetWhereDataIs(c *gas.ClientCLI, dir, groups, users, types string, age summary.DirGUTAge,
 	splits string) ([]byte, []*DirSummary, error) {
+	return GetWhereDataIsCtx(context.Background(), c, dir, groups, users, types, age, splits, WhereOptions{})
+}
+
+// GetWhereDataIsCtx is like GetWhereDataIs(), but the query is abandoned if
+// the given context is cancelled or its deadline passes, in which case the
+// context's error is returned. Connection errors and 5xx responses are retried
+// according to the given options.
+func GetWhereDataIsCtx(ctx context.Context, c *gas.ClientCLI, dir, groups, users, types string,
+	age summary.DirGUTAge, splits string, opts WhereOptions) ([]byte, []*DirSummary, error) {
+	return getWhereWithRetries(ctx, c, map[string]string{
+		"dir":    dir,
+		"groups": groups,
+		"users":  users,
+		"types":  types,
+		"age":    strconv.Itoa(int(age)),
+		"splits": splits,
+	}, opts)
+}
+
+// GetWhereDataIsGroupedBy is like GetWhereDataIs(), but instead of getting
+// summaries of directories nested under dir, gets a summary of dir for each
+// group (if groupBy is GroupByGroup) or user (if GroupByUser) that owns data
+// nested under dir.
+func GetWhereDataIsGroupedBy(c *gas.ClientCLI, dir, groups, users, types string, age summary.DirGUTAge,
+	groupBy string) ([]byte, []*DirSummary, error) {
+	return getWhere(c, map[string]string{
+		"dir":     dir,
+		"groups":  groups,
+		"users":   users,
+		"types":   types,
+		"age":     strconv.Itoa(int(age)),
+		"groupBy": groupBy,
+	})
+}
+
+// GetWhereDataIsForDirs is like GetWhereDataIs(), but queries each of the
+// given dirs in a single request, returning a map of dir to its WhereResult.
+// Problems with particular dirs (eg. them not existing) are reported in their
+// WhereResult's Error, rather than as the returned error.
+func GetWhereDataIsForDirs(c *gas.ClientCLI, dirs []string, groups, users, types string,
+	age summary.DirGUTAge, splits string) (map[string]*WhereResult, error) {
+	if len(dirs) == 1 {
+		return getWhereDataIsForDir(c, dirs[0], groups, users, types, age, splits)
+	}
+
 	r, err := c.AuthenticatedRequest()
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	resp, err := r.SetResult([]*DirSummary{}).
+	resp, err := r.SetResult(map[string]*WhereResult{}).
 		ForceContentType("application/json").
 		SetQueryParams(map[string]string{
-			"dir":    dir,
 			"groups": groups,
 			"users":  users,
 			"types":  types,
 			"age":    strconv.Itoa(int(age)),
 			"splits": splits,
 		}).
+		SetQueryParamsFromValues(url.Values{"dir": dirs}).
 		Get(EndPointAuthWhere)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	switch resp.StatusCode() {
 	case http.StatusUnauthorized, http.StatusNotFound:
-		return nil, nil, gas.ErrNoAuth
+		return nil, gas.ErrNoAuth
+	case http.StatusOK:
+		return *resp.Result().(*map[string]*WhereResult), nil //nolint:forcetypeassert
+	}
+
+	return nil, ErrBadQuery
+}
+
+// getWhereDataIsForDir does GetWhereDataIsForDirs() for a single dir, which the
+// server responds to in the form GetWhereDataIs() expects. Since the server
+// can't tell us why such a query failed, any bad query is reported in the dir's
+// WhereResult.
+func getWhereDataIsForDir(c *gas.ClientCLI, dir, groups, users, types string,
+	age summary.DirGUTAge, splits string) (map[string]*WhereResult, error) {
+	_, dss, err := GetWhereDataIs(c, dir, groups, users, types, age, splits)
+	if errors.Is(err, ErrBadQuery) {
+		return map[string]*WhereResult{dir: {Error: err.Error()}}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return map[string]*WhereResult{dir: {Summaries: dss}}, nil
+}
+
+// getWhere does a where query with the given query parameters, returning the
+// raw response body and that body converted in to a slice of *DirSummary.
+func getWhere(c *gas.ClientCLI, params map[string]string) ([]byte, []*DirSummary, error) {
+	return getWhereWithRetries(context.Background(), c, params, WhereOptions{})
+}
+
+// getWhereWithRetries is like getWhere(), but uses the given context and
+// retries transient failures as per the given options.
+func getWhereWithRetries(ctx context.Context, c *gas.ClientCLI, params map[string]string,
+	opts WhereOptions) ([]byte, []*DirSummary, error) {
+	backoff := opts.Backoff
+	if backoff <= 0 {
+		backoff = defaultRetryBackoff
+	}
+
+	for attempt := 0; ; attempt++ {
+		body, dss, transient, err := getWhereOnce(ctx, c, params)
+		if !transient || attempt >= opts.Retries {
+			return body, dss, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+	}
+}
+
+// getWhereOnce makes a single where query, additionally returning true if a
+// failure was due to a connection error or server error that might succeed if
+// tried again.
+func getWhereOnce(ctx context.Context, c *gas.ClientCLI,
+	params map[string]string) ([]byte, []*DirSummary, bool, error) {
+	r, err := c.AuthenticatedRequest()
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	resp, err := r.SetContext(ctx).
+		SetResult([]*DirSummary{}).
+		ForceContentType("application/json").
+		SetQueryParams(params).
+		Get(EndPointAuthWhere)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, nil, false, ctx.Err()
+		}
+
+		return nil, nil, true, err
+	}
+
+	switch resp.StatusCode() {
+	case http.StatusUnauthorized, http.StatusNotFound:
+		return nil, nil, false, gas.ErrNoAuth
+	case http.StatusOK:
+		return resp.Body(), *resp.Result().(*[]*DirSummary), false, nil //nolint:forcetypeassert
+	}
+
+	return nil, nil, resp.StatusCode() >= http.StatusInternalServerError, ErrBadQuery
+}
+
+// GetMounts is a client call to a Server that gets the MountStatus of each of
+// its loaded datasets.
+//
+// You must first Login() to get a JWT that will be used here.
+func GetMounts(c *gas.ClientCLI) ([]*MountStatus, error) {
+	r, err := c.AuthenticatedRequest()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.SetResult([]*MountStatus{}).
+		ForceContentType("application/json").
+		Get(EndPointAuthMounts)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode() {
+	case http.StatusUnauthorized, http.StatusNotFound:
+		return nil, gas.ErrNoAuth
+	case http.StatusOK:
+		return *resp.Result().(*[]*MountStatus), nil //nolint:forcetypeassert
+	}
+
+	return nil, ErrBadQuery
+}
+
+// GetTypeBreakdown is a client call to a Server that gets the TypeUsage of each
+// file type nested under the given dir, optionally restricted to the given
+// comma-separated groups.
+//
+// You must first Login() to get a JWT that will be used here.
+func GetTypeBreakdown(c *gas.ClientCLI, dir, groups string) (map[string]*TypeUsage, error) {
+	r, err := c.AuthenticatedRequest()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.SetResult(map[string]*TypeUsage{}).
+		ForceContentType("application/json").
+		SetQueryParams(map[string]string{
+			"dir":    dir,
+			"groups": groups,
+		}).
+		Get(EndPointAuthTreeTypeBreakdown)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode() {
+	case http.StatusUnauthorized, http.StatusNotFound:
+		return nil, gas.ErrNoAuth
 	case http.StatusOK:
-		return resp.Body(), *resp.Result().(*[]*DirSummary), nil //nolint:forcetypeassert
+		return *resp.Result().(*map[string]*TypeUsage), nil //nolint:forcetypeassert
 	}
 
-	return nil, nil, ErrBadQuery
+	return nil, ErrBadQuery
 }
@@ -0,0 +1,79 @@
+/*******************************************************************************
+ * Copyright (c) 2024 Genome Research Ltd.
+ *
+ * Author: Sendu Bala <sb10@sanger.ac.uk>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining
+ * a copy of this software and associated documentation files (the
+ * "Software"), to deal in the Software without restriction, including
+ * without limitation the rights to use, copy, modify, merge, publish,
+ * distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so, subject to
+ * the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included
+ * in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+ * CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+ * TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ ******************************************************************************/
+
+package server
+
+import (
+	"errors"
+	"os"
+
+	gas "github.com/wtsi-hgi/go-authserver"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	compactDBMode      = 0600
+	compactTxMaxSize   = 64 * 1024 * 1024
+	ErrCompactDstExist = gas.Error("compaction destination already exists")
+)
+
+// CompactDB writes a defragmented copy of the bolt database at srcPath (eg. a
+// dguta.db, dguta.db.children or basedirs.db file) to dstPath, which must not
+// already exist. Bolt files don't shrink when data is deleted from them, so
+// the copy can be much smaller, but will have identical buckets and keys.
+//
+// The source is opened read-only, so can be compacted while a server is using
+// it.
+func CompactDB(srcPath, dstPath string) (err error) {
+	if _, err = os.Stat(dstPath); err == nil {
+		return ErrCompactDstExist
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	src, err := bolt.Open(srcPath, compactDBMode, &bolt.Options{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+
+	defer src.Close()
+
+	dst, err := bolt.Open(dstPath, compactDBMode, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if errc := dst.Close(); err == nil {
+			err = errc
+		}
+
+		if err != nil {
+			os.Remove(dstPath) //nolint:errcheck
+		}
+	}()
+
+	return bolt.Compact(dst, src, compactTxMaxSize)
+}
@@ -0,0 +1,285 @@
+/*******************************************************************************
+ * Copyright (c) 2024 Genome Research Ltd.
+ *
+ * Author: Sendu Bala <sb10@sanger.ac.uk>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining
+ * a copy of this software and associated documentation files (the
+ * "Software"), to deal in the Software without restriction, including
+ * without limitation the rights to use, copy, modify, merge, publish,
+ * distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so, subject to
+ * the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included
+ * in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+ * CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+ * TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ ******************************************************************************/
+
+package server
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	gas "github.com/wtsi-hgi/go-authserver"
+	"github.com/wtsi-ssg/wrstat/v5/basedirs"
+	"github.com/wtsi-ssg/wrstat/v5/dguta"
+	"github.com/wtsi-ssg/wrstat/v5/summary"
+)
+
+const (
+	ErrBadCompareQuery = gas.Error("bad query; check groups and mount")
+	ErrGroupNotAllowed = gas.Error("you are not allowed to query that group")
+
+	compareTopBaseDirs = 5
+	monthsInHalfYear   = 6
+	monthsInYear       = 12
+)
+
+// GroupProfile is a compact summary of a group's storage on a mount, suitable
+// for comparing against other groups.
+type GroupProfile struct {
+	Group       string
+	GID         uint32
+	UsageSize   uint64
+	QuotaSize   uint64
+	UsageInodes uint64
+	QuotaInodes uint64
+
+	// Growth6Months and Growth12Months are the change in UsageSize since the
+	// history entry nearest to (but not after) 6 and 12 months before the
+	// latest history entry, or since the earliest entry if the history
+	// doesn't go back that far.
+	Growth6Months  int64
+	Growth12Months int64
+
+	// AgeSizes is the UsageSize for each of the summary.DirGUTAges.
+	AgeSizes map[summary.DirGUTAge]uint64
+
+	// FileTypeSizes is the size of each type of file, keyed on the
+	// summary.DirGUTAFileType String().
+	FileTypeSizes map[string]uint64
+
+	// TopBaseDirs are the largest (up to 5) base directories of the group.
+	TopBaseDirs []*basedirs.Usage
+}
+
+// getCompare responds with a GroupProfile for each of the groups in the
+// comma-separated groups parameter, covering their storage on the mount
+// parameter. LoadDGUTADBs() and LoadBasedirsDB() must already have been called.
+// This is called when there is a GET on /rest/v1/compare or
+// /rest/v1/auth/compare.
+//
+// Users that aren't white-listed may only compare groups they belong to.
+func (s *Server) getCompare(c *gin.Context) {
+	mount := c.Query("mount")
+
+	gids, err := getWantedIDs(c.Query("groups"), groupNameToGID)
+	if err != nil || len(gids) == 0 || mount == "" {
+		c.AbortWithError(http.StatusBadRequest, ErrBadCompareQuery) //nolint:errcheck
+
+		return
+	}
+
+	allowedGIDs, err := s.allowedGIDs(c)
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, err) //nolint:errcheck
+
+		return
+	}
+
+	if allowedGIDs != nil {
+		for _, gid := range gids {
+			if !allowedGIDs[gid] {
+				c.AbortWithError(http.StatusBadRequest, ErrGroupNotAllowed) //nolint:errcheck
+
+				return
+			}
+		}
+	}
+
+	groups := splitCommaSeparatedString(c.Query("groups"))
+
+	s.getBasedirs(c, func() (any, error) {
+		profiles := make([]*GroupProfile, len(gids))
+
+		for i, gid := range gids {
+			profile, err := s.groupProfile(groups[i], gid, mount)
+			if err != nil {
+				return nil, err
+			}
+
+			profiles[i] = profile
+		}
+
+		return profiles, nil
+	})
+}
+
+// groupProfile builds the GroupProfile of the given group on the given mount.
+// You must hold the basedirs read lock.
+func (s *Server) groupProfile(group string, gid uint32, mount string) (*GroupProfile, error) {
+	profile := &GroupProfile{
+		Group:    group,
+		GID:      gid,
+		AgeSizes: make(map[summary.DirGUTAge]uint64, len(summary.DirGUTAges)),
+	}
+
+	for _, age := range summary.DirGUTAges {
+		usage, err := s.groupUsageOnMount(gid, mount, age)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, u := range usage {
+			profile.AgeSizes[age] += u.UsageSize
+		}
+
+		if age == summary.DGUTAgeAll {
+			profile.addCurrentUsage(usage)
+		}
+	}
+
+	err := s.addGrowthToProfile(profile, mount)
+	if err != nil {
+		return nil, err
+	}
+
+	profile.FileTypeSizes, err = s.fileTypeSizes(gid, mount)
+
+	return profile, err
+}
+
+// groupUsageOnMount returns the usage of the given group in base directories
+// within the given mount.
+func (s *Server) groupUsageOnMount(gid uint32, mount string, age summary.DirGUTAge) ([]*basedirs.Usage, error) {
+	usage, err := s.groupUsage(age)
+	if err != nil {
+		return nil, err
+	}
+
+	var onMount []*basedirs.Usage
+
+	for _, u := range usage {
+		if u.GID == gid && isWithin(u.BaseDir, mount) {
+			onMount = append(onMount, u)
+		}
+	}
+
+	return onMount, nil
+}
+
+// isWithin returns true if path is dir or is nested within it.
+func isWithin(path, dir string) bool {
+	dir = strings.TrimSuffix(dir, "/")
+
+	return path == dir || strings.HasPrefix(path, dir+"/")
+}
+
+// addCurrentUsage sets our usage and quota totals, and our top base
+// directories, from the given all-age usage.
+func (p *GroupProfile) addCurrentUsage(usage []*basedirs.Usage) {
+	for _, u := range usage {
+		p.UsageSize += u.UsageSize
+		p.UsageInodes += u.UsageInodes
+
+		if u.QuotaSize > p.QuotaSize {
+			p.QuotaSize = u.QuotaSize
+		}
+
+		if u.QuotaInodes > p.QuotaInodes {
+			p.QuotaInodes = u.QuotaInodes
+		}
+	}
+
+	top := make([]*basedirs.Usage, len(usage))
+	copy(top, usage)
+
+	sort.SliceStable(top, func(i, j int) bool {
+		return top[i].UsageSize > top[j].UsageSize
+	})
+
+	if len(top) > compareTopBaseDirs {
+		top = top[:compareTopBaseDirs]
+	}
+
+	p.TopBaseDirs = top
+}
+
+// addGrowthToProfile sets the profile's growth values from the group's history
+// on the mount. A group with no history has no growth.
+func (s *Server) addGrowthToProfile(p *GroupProfile, mount string) error {
+	history, err := s.basedirs.History(p.GID, mount)
+	if errors.Is(err, basedirs.ErrNoBaseDirHistory) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	p.Growth6Months = growthSince(history, monthsInHalfYear)
+	p.Growth12Months = growthSince(history, monthsInYear)
+
+	return nil
+}
+
+// growthSince returns the change in UsageSize between the latest History and
+// the latest one that is at least the given number of months older than it (or
+// the earliest, if none are that old). history must be sorted oldest first.
+func growthSince(history []basedirs.History, months int) int64 {
+	if len(history) == 0 {
+		return 0
+	}
+
+	latest := history[len(history)-1]
+	cutoff := latest.Date.AddDate(0, -months, 0)
+	from := history[0]
+
+	for _, h := range history {
+		if h.Date.After(cutoff) {
+			break
+		}
+
+		from = h
+	}
+
+	return int64(latest.UsageSize) - int64(from.UsageSize) //nolint:gosec
+}
+
+// fileTypeSizes returns the size of the given group's files of each type
+// nested within the given mount.
+func (s *Server) fileTypeSizes(gid uint32, mount string) (map[string]uint64, error) {
+	s.treeMutex.RLock()
+	defer s.treeMutex.RUnlock()
+
+	dir := filepath.Clean(mount)
+	sizes := make(map[string]uint64, len(summary.AllTypesExceptDirectories))
+
+	for _, ft := range summary.AllTypesExceptDirectories {
+		di, err := s.tree.DirInfo(dir, &dguta.Filter{GIDs: []uint32{gid}, FTs: []summary.DirGUTAFileType{ft}})
+		if err != nil {
+			return nil, err
+		}
+
+		if di == nil || di.Current.Size == 0 {
+			continue
+		}
+
+		sizes[ft.String()] = di.Current.Size
+	}
+
+	return sizes, nil
+}
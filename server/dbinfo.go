@@ -0,0 +1,89 @@
+/*******************************************************************************
+ * Copyright (c) 2024 Genome Research Ltd.
+ *
+ * Author: Sendu Bala <sb10@sanger.ac.uk>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining
+ * a copy of this software and associated documentation files (the
+ * "Software"), to deal in the Software without restriction, including
+ * without limitation the rights to use, copy, modify, merge, publish,
+ * distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so, subject to
+ * the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included
+ * in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+ * CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+ * TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ ******************************************************************************/
+
+package server
+
+import (
+	"net/http"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+	gas "github.com/wtsi-hgi/go-authserver"
+	"github.com/wtsi-ssg/wrstat/v5/dguta"
+)
+
+const (
+	dbInfoPath = "/dbinfo"
+
+	// EndPointAuthDBInfo is the endpoint white-listed users can use to get
+	// summary information on each loaded dguta database, which is available
+	// if authorization is implemented.
+	EndPointAuthDBInfo = gas.EndPointAuth + dbInfoPath
+)
+
+// getDBInfo responds to white-listed users with a map of dataset key (the
+// basename of each dguta database directory) to its dguta.DBInfo. This is
+// called when there is a GET on /rest/v1/auth/dbinfo.
+//
+// The databases are scanned using separate read-only handles without holding
+// our tree lock, so queries and reloads are not blocked while this runs. Since
+// the scan can take a long time for large databases, it isn't subject to the
+// query timeout.
+func (s *Server) getDBInfo(c *gin.Context) {
+	if !s.requireAdmin(c) {
+		return
+	}
+
+	s.treeMutex.RLock()
+	paths := append([]string(nil), s.dgutaPaths...)
+	s.treeMutex.RUnlock()
+
+	infos, err := dbInfos(paths)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err) //nolint:errcheck
+
+		return
+	}
+
+	setQueryRows(c, len(infos))
+	c.JSON(http.StatusOK, infos)
+}
+
+// dbInfos returns the dguta.DBInfo of each of the given dguta database
+// directories, keyed on their basenames.
+func dbInfos(paths []string) (map[string]*dguta.DBInfo, error) {
+	infos := make(map[string]*dguta.DBInfo, len(paths))
+
+	for _, path := range paths {
+		info, err := dguta.NewDB(path).Info()
+		if err != nil {
+			return nil, err
+		}
+
+		infos[filepath.Base(path)] = info
+	}
+
+	return infos, nil
+}
@@ -36,48 +36,98 @@ import (
 	"github.com/wtsi-ssg/wrstat/v5/watch"
 )
 
+// maxLoadWorkers is the most dguta database directories we'll examine at once
+// when checking them for their mounts and timestamps before loading them.
+const maxLoadWorkers = 8
+
 // LoadDGUTADBs loads the given dguta.db directories (as produced by one or more
 // invocations of dguta.DB.Store()) and adds the /rest/v1/where GET endpoint to
 // the REST API. If you call EnableAuth() first, then this endpoint will be
 // secured and be available at /rest/v1/auth/where.
 //
+// The where endpoint is also available in version 2 of the API, at
+// /rest/v2/where or /rest/v2/auth/where.
+//
+// Large where responses are gzip compressed for clients that accept that.
+//
 // The where endpoint can take the dir, splits, groups, users and types
 // parameters, which correspond to arguments that dguta.Tree.Where() takes.
+//
+// It also adds the /rest/v1/mounts GET endpoint (/rest/v1/auth/mounts if you
+// called EnableAuth() first), which reports the status of each of the loaded
+// paths; see getMounts(). If you called EnableAuth() first, white-listed users
+// can also get summary information on each of the loaded paths from the
+// /rest/v1/auth/dbinfo endpoint.
+//
+// The first time this succeeds, the file given to SetReadinessFile() (if any)
+// is created.
+//
+// Each path is first examined on its own, concurrently, to check it can be
+// opened and find its mount and timestamp. If any of them can't be opened, an
+// error covering all the bad ones is returned and any previously loaded
+// databases continue to be used. Only then are they opened together, one after
+// another, as the tree used to answer queries.
+//
+// You can call this again to replace the loaded databases, which are closed;
+// the endpoints are only added the first time.
 func (s *Server) LoadDGUTADBs(paths ...string) error {
+	tree, datasets, err := s.openDgutaDBs(paths, maxLoadWorkers)
+	if err != nil {
+		return err
+	}
+
 	s.treeMutex.Lock()
 	defer s.treeMutex.Unlock()
 
-	tree, err := dguta.NewTree(paths...)
-	if err != nil {
-		return err
+	if s.tree != nil {
+		s.tree.Close()
 	}
 
 	s.tree = tree
 	s.dgutaPaths = paths
+	s.datasets = datasets
+
+	s.metrics.setDatasets(datasets)
+
+	s.writeReadinessFile()
+
+	if s.dgutaEndpointsAdded {
+		return nil
+	}
+
+	s.dgutaEndpointsAdded = true
 
-	authGroup := s.AuthRouter()
+	s.routes(apiV1).GET(wherePath, gzipResponse, s.getWhere)
+	s.routes(apiV2).GET(wherePath, gzipResponse, s.getWhere)
+	s.routes(apiV1).GET(mountsPath, s.getMounts)
 
-	if authGroup == nil {
-		s.Router().GET(EndPointWhere, s.getWhere)
-	} else {
-		authGroup.GET(wherePath, s.getWhere)
+	if authGroup := s.AuthRouter(); authGroup != nil {
+		authGroup.GET(dbInfoPath, s.getDBInfo)
 	}
 
 	return nil
 }
 
 // EnableDGUTADBReloading will wait for changes to the file at watchPath, then:
-//  1. close any previously loaded dguta database files
-//  2. find the latest sub-directory in the given directory with the given suffix
-//  3. set the dguta.db directory paths to children of 2) and load those
-//  4. delete the old dguta.db directory paths to save space, and their parent
+//  1. find the latest sub-directory in the given directory with the given suffix
+//  2. load the dguta.db directories that are children of 1), and only if they
+//     all load successfully, use them in place of the previously loaded dguta
+//     database files, closing those
+//  3. delete the old dguta.db directory paths to save space, and their parent
 //     dir if now empty
-//  5. update the server's data-creation date to the mtime of the watchPath file
+//  4. update the server's data-creation date to the mtime of the watchPath file
 //
-// It will also do 5) immediately on calling this method.
+// It will also do 4) immediately on calling this method.
 //
 // It will only return an error if trying to watch watchPath immediately fails.
-// Other errors (eg. reloading or deleting files) will be logged.
+// Other errors (eg. reloading or deleting files) will be logged, and can be
+// retrieved with LastReloadError(); the previously loaded databases continue
+// to be used after a failed reload.
+//
+// Every reload attempt of the dguta or basedirs databases is passed to our
+// ReloadLogger (see SetReloadLogger()), and if you called EnableAuth() first,
+// white-listed users can get the most recent attempts from the
+// /rest/v1/auth/reload-history endpoint.
 func (s *Server) EnableDGUTADBReloading(watchPath, dir, suffix string, pollFrequency time.Duration) error {
 	s.treeMutex.Lock()
 	defer s.treeMutex.Unlock()
@@ -95,60 +145,79 @@ func (s *Server) EnableDGUTADBReloading(watchPath, dir, suffix string, pollFrequ
 
 	s.dgutaWatcher = watcher
 
+	if authGroup := s.AuthRouter(); authGroup != nil {
+		authGroup.GET(reloadHistoryPath, s.getReloadHistory)
+	}
+
 	return nil
 }
 
-// reloadDGUTADBs closes database files previously loaded during LoadDGUTADBs(),
-// looks for the latest subdirectory of the given directory that has the given
-// suffix, and loads the children of that as our new dgutaPaths.
+// reloadDGUTADBs looks for the latest subdirectory of the given directory that
+// has the given suffix, and loads the children of that as our new dgutaPaths.
 //
-// On success, deletes the previous dgutaPaths and updates our dataTimestamp.
+// Only if all of them load successfully are they swapped in for the currently
+// loaded databases, which are then closed and deleted, and our dataTimestamp
+// updated. Otherwise the current databases continue to be used.
 //
-// Logs any errors.
+// Logs any errors, which are also recorded for LastReloadError().
 func (s *Server) reloadDGUTADBs(dir, suffix string, mtime time.Time) {
-	s.treeMutex.Lock()
-	defer s.treeMutex.Unlock()
+	start := time.Now()
 
-	if s.tree != nil {
-		s.tree.Close()
-	}
-
-	oldPaths := s.dgutaPaths
-
-	err := s.findNewDgutaPaths(dir, suffix)
+	paths, err := FindLatestDgutaDirs(dir, suffix)
 	if err != nil {
-		s.Logger.Printf("reloading dguta dbs failed: %s", err)
+		s.recordReload("dguta dbs", start, 0, err)
 
 		return
 	}
 
-	s.Logger.Printf("reloading dguta dbs from %s", s.dgutaPaths)
+	s.Logger.Printf("reloading dguta dbs from %s", paths)
 
-	s.tree, err = dguta.NewTree(s.dgutaPaths...)
+	tree, datasets, err := s.openDgutaDBs(paths, maxLoadWorkers)
 	if err != nil {
-		s.Logger.Printf("reloading dguta dbs failed: %s", err)
+		s.recordReload("dguta dbs", start, 0, err)
 
 		return
 	}
 
+	s.treeMutex.Lock()
+	defer s.treeMutex.Unlock()
+
+	if s.tree != nil {
+		s.tree.Close()
+	}
+
+	oldPaths := s.dgutaPaths
+
+	s.tree = tree
+	s.dgutaPaths = paths
+	s.datasets = datasets
+
+	s.metrics.setDatasets(datasets)
+
 	s.Logger.Printf("server ready again after reloading dguta dbs")
+	s.recordReload("dguta dbs", start, len(paths), nil)
 
 	s.deleteDirs(oldPaths)
 
 	s.dataTimeStamp = mtime
 }
 
-// findNewDgutaPaths finds the latest subdirectory of dir that has the given
-// suffix, then sets our dgutaPaths to the result's children.
-func (s *Server) findNewDgutaPaths(dir, suffix string) error {
-	paths, err := FindLatestDgutaDirs(dir, suffix)
+// openDgutaDBs checks and examines each of the given dguta database
+// directories, up to the given number of workers at once, then, only if they
+// were all fine, opens them together as a single tree. dguta.NewTree() opens
+// the paths sequentially, so only the examination is concurrent.
+func (s *Server) openDgutaDBs(paths []string, workers int) (*dguta.Tree, []*dataset, error) {
+	datasets, err := s.datasetsOf(paths, workers)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	s.dgutaPaths = paths
+	tree, err := dguta.NewTree(paths...)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	return nil
+	return tree, datasets, nil
 }
 
 // FindLatestDgutaDirs finds the latest subdirectory of dir that has the given
@@ -0,0 +1,213 @@
+/*******************************************************************************
+ * Copyright (c) 2024 Genome Research Ltd.
+ *
+ * Author: Sendu Bala <sb10@sanger.ac.uk>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining
+ * a copy of this software and associated documentation files (the
+ * "Software"), to deal in the Software without restriction, including
+ * without limitation the rights to use, copy, modify, merge, publish,
+ * distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so, subject to
+ * the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included
+ * in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+ * CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+ * TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ ******************************************************************************/
+
+package server
+
+import (
+	"sort"
+
+	"github.com/wtsi-ssg/wrstat/v5/basedirs"
+	"github.com/wtsi-ssg/wrstat/v5/summary"
+)
+
+// UsageChange describes how a group's or user's usage of a base directory
+// changed between two basedirs databases.
+type UsageChange string
+
+const (
+	UsageAdded   UsageChange = "added"
+	UsageRemoved UsageChange = "removed"
+	UsageChanged UsageChange = "changed"
+)
+
+// UsageDiff describes the change in usage of a base directory by a group or
+// user between two basedirs databases.
+type UsageDiff struct {
+	Change         UsageChange
+	GID            uint32
+	UID            uint32
+	Name           string
+	BaseDir        string
+	OldUsageSize   uint64
+	NewUsageSize   uint64
+	SizeDelta      int64
+	OldUsageInodes uint64
+	NewUsageInodes uint64
+	InodesDelta    int64
+}
+
+type usageKey struct {
+	gid     uint32
+	uid     uint32
+	basedir string
+}
+
+// DiffUsage compares the all-age entries of the given old and new usage (as
+// returned by basedirs.BaseDirReader.GroupUsage() or UserUsage()), joining them
+// on id and base directory. It returns the entries that were added, removed or
+// changed, ignoring those whose size changed by less than minDelta bytes.
+//
+// The results are sorted by the absolute size of their SizeDelta, largest
+// first.
+func DiffUsage(oldUsage, newUsage []*basedirs.Usage, minDelta uint64) []*UsageDiff {
+	olds := allAgeUsageByKey(oldUsage)
+	diffs := make([]*UsageDiff, 0, len(newUsage))
+
+	for key, n := range allAgeUsageByKey(newUsage) {
+		o, existed := olds[key]
+		delete(olds, key)
+
+		diff := newUsageDiff(o, n)
+
+		if existed && diff.SizeDelta == 0 && diff.InodesDelta == 0 {
+			continue
+		}
+
+		diffs = append(diffs, diff)
+	}
+
+	for _, o := range olds {
+		diffs = append(diffs, newUsageDiff(o, nil))
+	}
+
+	return sortAndFilterUsageDiffs(diffs, minDelta)
+}
+
+// allAgeUsageByKey returns the DGUTAgeAll members of the given usage keyed on
+// their ids and base directory.
+func allAgeUsageByKey(usage []*basedirs.Usage) map[usageKey]*basedirs.Usage {
+	byKey := make(map[usageKey]*basedirs.Usage, len(usage))
+
+	for _, u := range usage {
+		if u.Age != summary.DGUTAgeAll {
+			continue
+		}
+
+		byKey[usageKey{gid: u.GID, uid: u.UID, basedir: u.BaseDir}] = u
+	}
+
+	return byKey
+}
+
+// newUsageDiff creates a UsageDiff from an old and new Usage, either of which
+// may be nil (but not both).
+func newUsageDiff(o, n *basedirs.Usage) *UsageDiff {
+	diff := &UsageDiff{Change: UsageChanged}
+
+	switch {
+	case o == nil:
+		diff.Change = UsageAdded
+		o = &basedirs.Usage{}
+	case n == nil:
+		diff.Change = UsageRemoved
+		n = &basedirs.Usage{GID: o.GID, UID: o.UID, Name: o.Name, BaseDir: o.BaseDir}
+	}
+
+	diff.GID = n.GID
+	diff.UID = n.UID
+	diff.Name = n.Name
+	diff.BaseDir = n.BaseDir
+	diff.OldUsageSize = o.UsageSize
+	diff.NewUsageSize = n.UsageSize
+	diff.SizeDelta = int64(n.UsageSize) - int64(o.UsageSize) //nolint:gosec
+	diff.OldUsageInodes = o.UsageInodes
+	diff.NewUsageInodes = n.UsageInodes
+	diff.InodesDelta = int64(n.UsageInodes) - int64(o.UsageInodes) //nolint:gosec
+
+	return diff
+}
+
+// sortAndFilterUsageDiffs removes diffs with an absolute SizeDelta smaller than
+// minDelta, and sorts the remainder by absolute SizeDelta, largest first, then
+// by BaseDir and Name.
+func sortAndFilterUsageDiffs(diffs []*UsageDiff, minDelta uint64) []*UsageDiff {
+	filtered := diffs[:0]
+
+	for _, diff := range diffs {
+		if absInt64(diff.SizeDelta) >= minDelta {
+			filtered = append(filtered, diff)
+		}
+	}
+
+	sort.Slice(filtered, func(i, j int) bool {
+		a, b := absInt64(filtered[i].SizeDelta), absInt64(filtered[j].SizeDelta)
+		if a != b {
+			return a > b
+		}
+
+		if filtered[i].BaseDir != filtered[j].BaseDir {
+			return filtered[i].BaseDir < filtered[j].BaseDir
+		}
+
+		return filtered[i].Name < filtered[j].Name
+	})
+
+	return filtered
+}
+
+func absInt64(n int64) uint64 {
+	if n < 0 {
+		return uint64(-n)
+	}
+
+	return uint64(n)
+}
+
+// DiffBasedirsDBs opens the given old and new basedirs databases (as produced
+// by basedirs.CreateDatabase()) using the given owners file, and returns the
+// DiffUsage() of their group usage and of their user usage.
+func DiffBasedirsDBs(oldPath, newPath, ownersPath string, minDelta uint64) ([]*UsageDiff, []*UsageDiff, error) {
+	oldGroups, oldUsers, err := readAllUsage(oldPath, ownersPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	newGroups, newUsers, err := readAllUsage(newPath, ownersPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return DiffUsage(oldGroups, newGroups, minDelta), DiffUsage(oldUsers, newUsers, minDelta), nil
+}
+
+// readAllUsage returns the all-age group and user usage in the given basedirs
+// database.
+func readAllUsage(dbPath, ownersPath string) ([]*basedirs.Usage, []*basedirs.Usage, error) {
+	bd, err := basedirs.NewReader(dbPath, ownersPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer bd.Close()
+
+	groups, err := bd.GroupUsage(summary.DGUTAgeAll)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	users, err := bd.UserUsage(summary.DGUTAgeAll)
+
+	return groups, users, err
+}
@@ -0,0 +1,180 @@
+/*******************************************************************************
+ * Copyright (c) 2024 Genome Research Ltd.
+ *
+ * Author: Sendu Bala <sb10@sanger.ac.uk>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining
+ * a copy of this software and associated documentation files (the
+ * "Software"), to deal in the Software without restriction, including
+ * without limitation the rights to use, copy, modify, merge, publish,
+ * distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so, subject to
+ * the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included
+ * in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+ * CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+ * TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ ******************************************************************************/
+
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	gas "github.com/wtsi-hgi/go-authserver"
+	"github.com/wtsi-ssg/wrstat/v5/basedirs"
+	"github.com/wtsi-ssg/wrstat/v5/summary"
+)
+
+const (
+	// ExportFormat* are the formats ExportBasedirs() and ExportUsage() can
+	// write.
+	ExportFormatJSON = "json"
+	ExportFormatCSV  = "csv"
+
+	// ExportKind* are the values of the Kind of an ExportedUsage.
+	ExportKindGroup = "group"
+	ExportKindUser  = "user"
+
+	ErrUnknownExportFormat = gas.Error("unknown export format; must be json or csv")
+)
+
+// exportCSVHeader are the columns of a CSV export.
+var exportCSVHeader = []string{ //nolint:gochecknoglobals
+	"Kind", "GID", "UID", "GIDs", "UIDs", "Name", "Owner", "BaseDir",
+	"UsageSize", "QuotaSize", "UsageInodes", "QuotaInodes",
+	"Mtime", "DateNoSpace", "DateNoFiles", "Age",
+}
+
+// ExportedUsage is a group's or user's usage of a base directory, as written
+// by ExportUsage().
+type ExportedUsage struct {
+	Kind string
+	*basedirs.Usage
+}
+
+// ExportBasedirs writes all the group and user usage, of all ages, in the given
+// reader to w in the given format; see ExportUsage(). The reader can be one in
+// live use by a Server.
+func ExportBasedirs(w io.Writer, bd *basedirs.BaseDirReader, format string) error {
+	var groups, users []*basedirs.Usage
+
+	for _, age := range summary.DirGUTAges {
+		g, err := bd.GroupUsage(age)
+		if err != nil {
+			return err
+		}
+
+		u, err := bd.UserUsage(age)
+		if err != nil {
+			return err
+		}
+
+		groups = append(groups, g...)
+		users = append(users, u...)
+	}
+
+	return ExportUsage(w, format, groups, users)
+}
+
+// ExportUsage writes the given group and user usage to w. The json format
+// writes an ExportedUsage JSON object per line. The csv format writes a header
+// line followed by a line per usage, with the same fields as ExportedUsage;
+// GIDs and UIDs are semicolon separated, and times are RFC3339.
+func ExportUsage(w io.Writer, format string, groups, users []*basedirs.Usage) error {
+	switch format {
+	case ExportFormatJSON:
+		return exportUsageJSON(w, groups, users)
+	case ExportFormatCSV:
+		return exportUsageCSV(w, groups, users)
+	default:
+		return ErrUnknownExportFormat
+	}
+}
+
+// eachUsage calls cb with each of the groups and then each of the users,
+// along with their kind, stopping at the first error.
+func eachUsage(groups, users []*basedirs.Usage, cb func(kind string, u *basedirs.Usage) error) error {
+	for _, u := range groups {
+		if err := cb(ExportKindGroup, u); err != nil {
+			return err
+		}
+	}
+
+	for _, u := range users {
+		if err := cb(ExportKindUser, u); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func exportUsageJSON(w io.Writer, groups, users []*basedirs.Usage) error {
+	enc := json.NewEncoder(w)
+
+	return eachUsage(groups, users, func(kind string, u *basedirs.Usage) error {
+		return enc.Encode(&ExportedUsage{Kind: kind, Usage: u})
+	})
+}
+
+func exportUsageCSV(w io.Writer, groups, users []*basedirs.Usage) error {
+	cw := csv.NewWriter(w)
+
+	if err := cw.Write(exportCSVHeader); err != nil {
+		return err
+	}
+
+	if err := eachUsage(groups, users, func(kind string, u *basedirs.Usage) error {
+		return cw.Write(usageToCSVRecord(kind, u))
+	}); err != nil {
+		return err
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
+
+func usageToCSVRecord(kind string, u *basedirs.Usage) []string {
+	return []string{
+		kind,
+		strconv.FormatUint(uint64(u.GID), 10),
+		strconv.FormatUint(uint64(u.UID), 10),
+		joinIDs(u.GIDs),
+		joinIDs(u.UIDs),
+		u.Name,
+		u.Owner,
+		u.BaseDir,
+		strconv.FormatUint(u.UsageSize, 10),
+		strconv.FormatUint(u.QuotaSize, 10),
+		strconv.FormatUint(u.UsageInodes, 10),
+		strconv.FormatUint(u.QuotaInodes, 10),
+		u.Mtime.Format(time.RFC3339),
+		u.DateNoSpace.Format(time.RFC3339),
+		u.DateNoFiles.Format(time.RFC3339),
+		strconv.Itoa(int(u.Age)),
+	}
+}
+
+func joinIDs(ids []uint32) string {
+	strs := make([]string, len(ids))
+
+	for i, id := range ids {
+		strs[i] = strconv.FormatUint(uint64(id), 10)
+	}
+
+	return strings.Join(strs, ";")
+}
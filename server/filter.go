@@ -26,6 +26,7 @@
 package server
 
 import (
+	"fmt"
 	"os/user"
 	"strconv"
 	"strings"
@@ -178,7 +179,7 @@ func addTypesToFilter(filter *dguta.Filter, types string) error {
 	for i, name := range tnames {
 		ft, err := summary.FileTypeStringToDirGUTAFileType(name)
 		if err != nil {
-			return err
+			return fmt.Errorf("%w: %s", err, name)
 		}
 
 		fts[i] = ft
@@ -197,7 +198,7 @@ func addAgeToFilter(filter *dguta.Filter, ageStr string) error {
 
 	age, err := summary.AgeStringToDirGUTAge(ageStr)
 	if err != nil {
-		return err
+		return fmt.Errorf("%w: %s (must be 0 to %d)", err, ageStr, len(summary.DirGUTAges)-1)
 	}
 
 	filter.Age = age
@@ -205,6 +206,38 @@ func addAgeToFilter(filter *dguta.Filter, ageStr string) error {
 	return nil
 }
 
+// validateFilter checks that the given filter's Age and FTs are ones that the
+// dguta database knows about, returning an error that says which one isn't.
+func validateFilter(filter *dguta.Filter) error {
+	if int(filter.Age) >= len(summary.DirGUTAges) {
+		return fmt.Errorf("%w: %d (must be 0 to %d)", summary.ErrInvalidAge, filter.Age, len(summary.DirGUTAges)-1)
+	}
+
+	for _, ft := range filter.FTs {
+		if !isKnownFileType(ft) {
+			return fmt.Errorf("%w: %d", summary.ErrInvalidType, ft)
+		}
+	}
+
+	return nil
+}
+
+// isKnownFileType returns true if the given file type is one of those that
+// files or directories are summarised as.
+func isKnownFileType(ft summary.DirGUTAFileType) bool {
+	if ft == summary.DGUTAFileTypeDir {
+		return true
+	}
+
+	for _, known := range summary.AllTypesExceptDirectories {
+		if ft == known {
+			return true
+		}
+	}
+
+	return false
+}
+
 // allowedGIDs checks our JWT if present, and will return the GIDs that
 // user is allowed to query. If the user is not restricted on GIDs, returns nil.
 func (s *Server) allowedGIDs(c *gin.Context) (map[uint32]bool, error) {
@@ -0,0 +1,363 @@
+/*******************************************************************************
+ * Copyright (c) 2024 Genome Research Ltd.
+ *
+ * Author: Sendu Bala <sb10@sanger.ac.uk>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining
+ * a copy of this software and associated documentation files (the
+ * "Software"), to deal in the Software without restriction, including
+ * without limitation the rights to use, copy, modify, merge, publish,
+ * distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so, subject to
+ * the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included
+ * in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+ * CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+ * TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ ******************************************************************************/
+
+package server
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	gas "github.com/wtsi-hgi/go-authserver"
+	"github.com/wtsi-ssg/wrstat/v5/basedirs"
+	"github.com/wtsi-ssg/wrstat/v5/summary"
+)
+
+const (
+	ErrBadForecastQuery = gas.Error("bad query; check mount, capacity and window")
+	ErrUnknownMount     = gas.Error("mount has no base directories; supply its capacity")
+
+	// DefaultForecastWindow is the period of most recent history used to
+	// calculate growth if no window is specified.
+	DefaultForecastWindow = 90 * 24 * time.Hour
+
+	forecastTopGrowers = 5
+	hoursPerDay        = 24
+)
+
+// Forecast describes the aggregate growth of all groups' usage on a mount, and
+// when that growth will fill the mount.
+type Forecast struct {
+	Mount     string
+	Capacity  uint64
+	UsageSize uint64
+
+	// GrowthPerDay is the rate of growth, in bytes per day, of a least-squares
+	// linear fit of the aggregate usage over the forecast window.
+	GrowthPerDay float64
+
+	// DateFull is when the mount is projected to be full at the current rate
+	// of growth. It is the zero time if usage isn't growing, or there isn't
+	// enough history to tell.
+	DateFull time.Time
+
+	// TopGrowers are the (up to 5) groups whose usage grew the most over the
+	// forecast window, largest growth first.
+	TopGrowers []*GroupGrowth
+}
+
+// GroupGrowth is the growth in usage of a group over a forecast window.
+type GroupGrowth struct {
+	GID    uint32
+	Name   string
+	Growth int64
+}
+
+// getForecast responds with a Forecast for the mount parameter. The mount's
+// capacity in bytes is taken from the capacity parameter if supplied, otherwise
+// from the filesystem mounted there, which is only looked at if it is one of
+// the mounts that base directories are on. The window parameter, a number of
+// days, sets how much recent history to base growth on (default 90).
+// LoadBasedirsDB() must already have been called. This is called when there is
+// a GET on /rest/v1/auth/forecast.
+func (s *Server) getForecast(c *gin.Context) {
+	mount, capacity, window, err := getForecastArgs(c)
+	if err == nil && capacity == 0 {
+		capacity, err = s.mountCapacity(mount)
+	}
+
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, err) //nolint:errcheck
+
+		return
+	}
+
+	s.getBasedirs(c, func() (any, error) {
+		histories, names, err := s.mountHistories(mount)
+		if err != nil {
+			return nil, err
+		}
+
+		f := forecastMount(histories, capacity, window)
+		f.Mount = mount
+
+		for _, g := range f.TopGrowers {
+			g.Name = names[g.GID]
+		}
+
+		return f, nil
+	})
+}
+
+// getForecastArgs gets the mount, capacity and window from the request. If
+// capacity isn't given, it is returned as 0.
+func getForecastArgs(c *gin.Context) (string, uint64, time.Duration, error) {
+	mount := c.Query("mount")
+	if mount == "" {
+		return "", 0, 0, ErrBadForecastQuery
+	}
+
+	window := DefaultForecastWindow
+
+	if windowStr := c.Query("window"); windowStr != "" {
+		days, err := strconv.ParseUint(windowStr, 10, 16)
+		if err != nil || days == 0 {
+			return "", 0, 0, ErrBadForecastQuery
+		}
+
+		window = time.Duration(days) * hoursPerDay * time.Hour
+	}
+
+	var capacity uint64
+
+	if capacityStr := c.Query("capacity"); capacityStr != "" {
+		var err error
+
+		capacity, err = strconv.ParseUint(capacityStr, 10, 64)
+		if err != nil || capacity == 0 {
+			return "", 0, 0, ErrBadForecastQuery
+		}
+	}
+
+	return mount, capacity, window, nil
+}
+
+// mountCapacity returns the size in bytes of the filesystem mounted at the
+// given mount. So that we only ever look at filesystems we know about, it
+// returns ErrUnknownMount if mount isn't one of the mounts that base directories
+// are on.
+func (s *Server) mountCapacity(mount string) (uint64, error) {
+	s.basedirsMutex.RLock()
+	mounts, err := s.mountsInUse()
+	s.basedirsMutex.RUnlock()
+
+	if err != nil {
+		return 0, err
+	}
+
+	if !slices.Contains(mounts, strings.TrimSuffix(mount, "/")+"/") {
+		return 0, ErrUnknownMount
+	}
+
+	var st syscall.Statfs_t
+
+	if err := syscall.Statfs(mount, &st); err != nil {
+		return 0, err
+	}
+
+	return st.Blocks * uint64(st.Bsize), nil //nolint:gosec
+}
+
+// mountHistories returns the history of every group that has a base directory
+// on the given mount, along with a map of those groups' GIDs to names. You
+// must hold the basedirs read lock.
+func (s *Server) mountHistories(mount string) (map[uint32][]basedirs.History, map[uint32]string, error) {
+	usage, err := s.groupUsage(summary.DGUTAgeAll)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	histories := make(map[uint32][]basedirs.History)
+	names := make(map[uint32]string)
+
+	for _, u := range usage {
+		if _, done := names[u.GID]; done || !isWithin(u.BaseDir, mount) {
+			continue
+		}
+
+		names[u.GID] = u.Name
+
+		history, err := s.basedirs.History(u.GID, mount)
+		if errors.Is(err, basedirs.ErrNoBaseDirHistory) {
+			continue
+		}
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		histories[u.GID] = history
+	}
+
+	return histories, names, nil
+}
+
+// forecastMount sums the given group histories (each sorted oldest first) by
+// date, and fits a line to the sums from the given window before the latest
+// date to find the current growth rate and when capacity will be reached.
+//
+// Groups are assumed to keep their last known usage on dates they have no
+// history for.
+func forecastMount(histories map[uint32][]basedirs.History, capacity uint64, window time.Duration) *Forecast {
+	dates := historyDates(histories)
+	f := &Forecast{Capacity: capacity, TopGrowers: []*GroupGrowth{}}
+
+	if len(dates) == 0 {
+		return f
+	}
+
+	latest := dates[len(dates)-1]
+	windowStart := latest.Add(-window)
+
+	var xs, ys []float64
+
+	firstInWindow := latest
+
+	for _, date := range dates {
+		total := totalUsageAt(histories, date)
+		f.UsageSize = total
+
+		if date.Before(windowStart) {
+			continue
+		}
+
+		if date.Before(firstInWindow) {
+			firstInWindow = date
+		}
+
+		xs = append(xs, date.Sub(windowStart).Hours()/hoursPerDay)
+		ys = append(ys, float64(total))
+	}
+
+	f.GrowthPerDay = linearFitSlope(xs, ys)
+	f.TopGrowers = topGrowers(histories, firstInWindow, latest)
+
+	if f.GrowthPerDay <= 0 || f.UsageSize >= capacity {
+		return f
+	}
+
+	days := float64(capacity-f.UsageSize) / f.GrowthPerDay
+	f.DateFull = latest.Add(time.Duration(days * hoursPerDay * float64(time.Hour)))
+
+	return f
+}
+
+// historyDates returns the unique dates in the given histories, sorted oldest
+// first.
+func historyDates(histories map[uint32][]basedirs.History) []time.Time {
+	seen := make(map[time.Time]bool)
+
+	var dates []time.Time
+
+	for _, history := range histories {
+		for _, h := range history {
+			if !seen[h.Date] {
+				seen[h.Date] = true
+				dates = append(dates, h.Date)
+			}
+		}
+	}
+
+	sort.Slice(dates, func(i, j int) bool {
+		return dates[i].Before(dates[j])
+	})
+
+	return dates
+}
+
+// totalUsageAt sums the usage of each group as of the given date.
+func totalUsageAt(histories map[uint32][]basedirs.History, date time.Time) uint64 {
+	var total uint64
+
+	for _, history := range histories {
+		total += usageAt(history, date)
+	}
+
+	return total
+}
+
+// usageAt returns the UsageSize of the latest History at or before the given
+// date, or 0 if there is none.
+func usageAt(history []basedirs.History, date time.Time) uint64 {
+	var usage uint64
+
+	for _, h := range history {
+		if h.Date.After(date) {
+			break
+		}
+
+		usage = h.UsageSize
+	}
+
+	return usage
+}
+
+// linearFitSlope returns the slope of the least-squares line through the given
+// points, or 0 if there are fewer than 2 distinct x values.
+func linearFitSlope(xs, ys []float64) float64 {
+	n := float64(len(xs))
+	if n < 2 { //nolint:mnd
+		return 0
+	}
+
+	var sumX, sumY, sumXY, sumXX float64
+
+	for i := range xs {
+		sumX += xs[i]
+		sumY += ys[i]
+		sumXY += xs[i] * ys[i]
+		sumXX += xs[i] * xs[i]
+	}
+
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0
+	}
+
+	return (n*sumXY - sumX*sumY) / denominator
+}
+
+// topGrowers returns the groups whose usage grew the most between the given
+// dates, excluding those that didn't grow.
+func topGrowers(histories map[uint32][]basedirs.History, from, to time.Time) []*GroupGrowth {
+	growers := []*GroupGrowth{}
+
+	for gid, history := range histories {
+		growth := int64(usageAt(history, to)) - int64(usageAt(history, from)) //nolint:gosec
+		if growth > 0 {
+			growers = append(growers, &GroupGrowth{GID: gid, Growth: growth})
+		}
+	}
+
+	sort.Slice(growers, func(i, j int) bool {
+		if growers[i].Growth != growers[j].Growth {
+			return growers[i].Growth > growers[j].Growth
+		}
+
+		return growers[i].GID < growers[j].GID
+	})
+
+	if len(growers) > forecastTopGrowers {
+		growers = growers[:forecastTopGrowers]
+	}
+
+	return growers
+}
@@ -0,0 +1,149 @@
+/*******************************************************************************
+ * Copyright (c) 2024 Genome Research Ltd.
+ *
+ * Author: Sendu Bala <sb10@sanger.ac.uk>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining
+ * a copy of this software and associated documentation files (the
+ * "Software"), to deal in the Software without restriction, including
+ * without limitation the rights to use, copy, modify, merge, publish,
+ * distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so, subject to
+ * the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included
+ * in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+ * CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+ * TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ ******************************************************************************/
+
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// gzipMinSize is the minimum size of response body that gzipResponse() will
+// bother compressing.
+const gzipMinSize = 1024
+
+var gzipWriterPool = sync.Pool{ //nolint:gochecknoglobals
+	New: func() any {
+		return gzip.NewWriter(io.Discard)
+	},
+}
+
+// bufferedResponseWriter is a gin.ResponseWriter that holds on to the body
+// instead of writing it.
+type bufferedResponseWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (b *bufferedResponseWriter) Write(data []byte) (int, error) {
+	return b.body.Write(data)
+}
+
+func (b *bufferedResponseWriter) WriteString(s string) (int, error) {
+	return b.body.WriteString(s)
+}
+
+// gzipResponse is middleware that gzip compresses the response body of the
+// following handlers if the client's Accept-Encoding header allows it and the
+// body is at least gzipMinSize bytes. Streamed NDJSON responses are never
+// compressed.
+func gzipResponse(c *gin.Context) {
+	if !acceptsGzip(c.GetHeader("Accept-Encoding")) || wantsNDJSON(c) {
+		return
+	}
+
+	w := c.Writer
+	bw := &bufferedResponseWriter{ResponseWriter: w}
+	c.Writer = bw
+
+	defer func() {
+		c.Writer = w
+	}()
+
+	c.Next()
+
+	c.Header("Vary", "Accept-Encoding")
+
+	if bw.body.Len() < gzipMinSize {
+		w.Write(bw.body.Bytes()) //nolint:errcheck
+
+		return
+	}
+
+	c.Header("Content-Encoding", "gzip")
+	w.Header().Del("Content-Length")
+
+	gz := gzipWriterPool.Get().(*gzip.Writer) //nolint:forcetypeassert,errcheck
+	defer gzipWriterPool.Put(gz)
+
+	gz.Reset(w)
+	gz.Write(bw.body.Bytes()) //nolint:errcheck
+	gz.Close()
+}
+
+// acceptsGzip returns true if the given Accept-Encoding header value allows
+// gzip, ie. lists gzip or * with a non-zero q value (and doesn't reject gzip
+// explicitly when using *).
+func acceptsGzip(acceptEncoding string) bool {
+	gzipQ, starQ := -1.0, -1.0
+
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, q := parseEncodingAndQ(part)
+
+		switch coding {
+		case "gzip", "x-gzip":
+			gzipQ = q
+		case "*":
+			starQ = q
+		}
+	}
+
+	if gzipQ >= 0 {
+		return gzipQ > 0
+	}
+
+	return starQ > 0
+}
+
+// parseEncodingAndQ parses an Accept-Encoding element like "gzip;q=0.5" in to
+// its lowercased coding and q value. The q value defaults to 1, and is 0 if
+// invalid.
+func parseEncodingAndQ(element string) (string, float64) {
+	params := strings.Split(element, ";")
+	coding := strings.ToLower(strings.TrimSpace(params[0]))
+	q := 1.0
+
+	for _, param := range params[1:] {
+		k, v, found := strings.Cut(strings.TrimSpace(param), "=")
+		if !found || strings.ToLower(strings.TrimSpace(k)) != "q" {
+			continue
+		}
+
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			parsed = 0
+		}
+
+		q = parsed
+	}
+
+	return coding, q
+}
@@ -0,0 +1,56 @@
+/*******************************************************************************
+ * Copyright (c) 2024 Genome Research Ltd.
+ *
+ * Author: Sendu Bala <sb10@sanger.ac.uk>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining
+ * a copy of this software and associated documentation files (the
+ * "Software"), to deal in the Software without restriction, including
+ * without limitation the rights to use, copy, modify, merge, publish,
+ * distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so, subject to
+ * the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included
+ * in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+ * CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+ * TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ ******************************************************************************/
+
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// EndPointHealth is the unauthenticated endpoint that container and load
+	// balancer healthchecks can use to see if we're ready to answer queries.
+	EndPointHealth = "/health"
+
+	healthOK     = "ok"
+	healthNoTree = "no database loaded"
+)
+
+// getHealth responds with a 200 if we have a dguta database loaded, or a 503
+// otherwise.
+func (s *Server) getHealth(c *gin.Context) {
+	s.treeMutex.RLock()
+	defer s.treeMutex.RUnlock()
+
+	if s.tree == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": healthNoTree})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": healthOK, "dataTimeStamp": s.dataTimeStamp.Unix()})
+}
@@ -0,0 +1,127 @@
+/*******************************************************************************
+ * Copyright (c) 2024 Genome Research Ltd.
+ *
+ * Author: Sendu Bala <sb10@sanger.ac.uk>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining
+ * a copy of this software and associated documentation files (the
+ * "Software"), to deal in the Software without restriction, including
+ * without limitation the rights to use, copy, modify, merge, publish,
+ * distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so, subject to
+ * the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included
+ * in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+ * CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+ * TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ ******************************************************************************/
+
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gin-contrib/secure"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	insecureStopTimeout       = 10 * time.Second
+	insecureReadHeaderTimeout = 20 * time.Second
+)
+
+// StartInsecure is like Start(), but serves the REST API and website over plain
+// HTTP, for use behind a reverse proxy that terminates TLS for us. Requests the
+// proxy says it received over https (with an "X-Forwarded-Proto: https"
+// header) get the same security headers as Start() would give them, but no
+// requests are redirected to https.
+//
+// Authentication still works as normal: the cert and key files given to
+// EnableAuth() are only used to sign and verify JWTs, so they don't need to be
+// the certificate the proxy presents.
+//
+// It blocks, but will gracefully shut down on SIGINT and SIGTERM. If you
+// StartInsecure() in a go-routine, you can call Stop() manually.
+func (s *Server) StartInsecure(addr string) error {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           s.Router(),
+		ReadHeaderTimeout: insecureReadHeaderTimeout,
+	}
+
+	s.insecureMutex.Lock()
+	s.insecureSrv = srv
+	s.insecureMutex.Unlock()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+	defer func() {
+		signal.Stop(sigs)
+		close(sigs)
+	}()
+
+	go func() {
+		if _, ok := <-sigs; ok {
+			s.Stop()
+		}
+	}()
+
+	err := srv.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
+
+// proxiedSecurityHeaders returns middleware that adds the same security headers
+// as Start() does, treating requests with an "X-Forwarded-Proto: https" header
+// as https, but never redirecting requests to https. New() installs this, so
+// that the router isn't changed once StartInsecure() is serving.
+func proxiedSecurityHeaders() gin.HandlerFunc {
+	config := secure.DefaultConfig()
+	config.SSLRedirect = false
+
+	return secure.New(config)
+}
+
+// Stop gracefully stops the server after Start() or StartInsecure(), and waits
+// for active connections to close and the port to be available again. It also
+// removes any file created due to SetReadinessFile().
+func (s *Server) Stop() {
+	defer s.removeReadinessFile()
+
+	s.insecureMutex.Lock()
+	srv := s.insecureSrv
+	s.insecureSrv = nil
+	s.insecureMutex.Unlock()
+
+	if srv == nil {
+		s.Server.Stop()
+
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), insecureStopTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		s.Logger.Printf("stopping the server failed: %s", err)
+	}
+
+	s.stop()
+}
@@ -0,0 +1,306 @@
+/*******************************************************************************
+ * Copyright (c) 2024 Genome Research Ltd.
+ *
+ * Author: Sendu Bala <sb10@sanger.ac.uk>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining
+ * a copy of this software and associated documentation files (the
+ * "Software"), to deal in the Software without restriction, including
+ * without limitation the rights to use, copy, modify, merge, publish,
+ * distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so, subject to
+ * the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included
+ * in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+ * CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+ * TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ ******************************************************************************/
+
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// EndPointMetrics is the unauthenticated endpoint that serves our metrics
+	// in the Prometheus text exposition format.
+	EndPointMetrics = "/metrics"
+
+	metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+	unmatchedEndpoint  = "unmatched"
+	reloadSuccess      = "success"
+	reloadFailure      = "failure"
+)
+
+// durationBuckets are the upper bounds, in seconds, of our duration
+// histograms' buckets.
+var durationBuckets = []float64{ //nolint:gochecknoglobals
+	0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300, 600,
+}
+
+// histogram is a Prometheus-style histogram of durations in seconds.
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newHistogram() *histogram {
+	return &histogram{counts: make([]uint64, len(durationBuckets))}
+}
+
+// observe adds the given duration to the histogram.
+func (h *histogram) observe(d time.Duration) {
+	secs := d.Seconds()
+
+	for i, le := range durationBuckets {
+		if secs <= le {
+			h.counts[i]++
+		}
+	}
+
+	h.sum += secs
+	h.count++
+}
+
+// write writes the histogram's buckets, sum and count in the exposition
+// format, with the given name and label (which should be of the form
+// `key="value"`).
+func (h *histogram) write(w io.Writer, name, label string) {
+	for i, le := range durationBuckets {
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", name, label,
+			strconv.FormatFloat(le, 'g', -1, 64), h.counts[i])
+	}
+
+	fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, label, h.count)
+	fmt.Fprintf(w, "%s_sum{%s} %g\n", name, label, h.sum)
+	fmt.Fprintf(w, "%s_count{%s} %d\n", name, label, h.count)
+}
+
+type requestLabels struct {
+	endpoint string
+	method   string
+	status   int
+}
+
+type reloadLabels struct {
+	kind   string
+	result string
+}
+
+// metrics is a small registry of the things we measure about ourselves.
+type metrics struct {
+	mu              sync.Mutex
+	requests        map[requestLabels]uint64
+	queryDurations  map[string]*histogram
+	reloadDurations map[string]*histogram
+	reloads         map[reloadLabels]uint64
+	oldestDataset   time.Time
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		requests:        make(map[requestLabels]uint64),
+		queryDurations:  make(map[string]*histogram),
+		reloadDurations: make(map[string]*histogram),
+		reloads:         make(map[reloadLabels]uint64),
+	}
+}
+
+// middleware counts every request by the endpoint it matched, its method and
+// its response status.
+func (m *metrics) middleware(c *gin.Context) {
+	c.Next()
+
+	endpoint := c.FullPath()
+	if endpoint == "" {
+		endpoint = unmatchedEndpoint
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[requestLabels{endpoint, c.Request.Method, c.Writer.Status()}]++
+}
+
+// observeQuery records how long a query of the given kind took.
+func (m *metrics) observeQuery(query string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	observeInto(m.queryDurations, query, d)
+}
+
+// observeReload records how long a reload of the given kind of database took,
+// and whether it succeeded.
+func (m *metrics) observeReload(kind string, d time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	observeInto(m.reloadDurations, kind, d)
+
+	result := reloadSuccess
+	if err != nil {
+		result = reloadFailure
+	}
+
+	m.reloads[reloadLabels{kind, result}]++
+}
+
+func observeInto(histograms map[string]*histogram, key string, d time.Duration) {
+	h, ok := histograms[key]
+	if !ok {
+		h = newHistogram()
+		histograms[key] = h
+	}
+
+	h.observe(d)
+}
+
+// setDatasets records the creation time of the oldest of the given datasets,
+// so that we can report its age without looking at the loaded datasets on
+// every scrape.
+func (m *metrics) setDatasets(datasets []*dataset) {
+	var oldest time.Time
+
+	for _, ds := range datasets {
+		if !ds.mtime.IsZero() && (oldest.IsZero() || ds.mtime.Before(oldest)) {
+			oldest = ds.mtime
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.oldestDataset = oldest
+}
+
+// write writes all our metrics in the exposition format, including the age of
+// the oldest dataset given to setDatasets(), or 0 if none were.
+func (m *metrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var oldestDatasetAge time.Duration
+
+	if !m.oldestDataset.IsZero() {
+		oldestDatasetAge = time.Since(m.oldestDataset)
+	}
+
+	m.writeRequests(w)
+	writeHistograms(w, "wrstat_ui_query_duration_seconds",
+		"Time taken to answer where and tree queries.", "query", m.queryDurations)
+	writeHistograms(w, "wrstat_ui_reload_duration_seconds",
+		"Time taken to reload databases.", "kind", m.reloadDurations)
+	m.writeReloads(w)
+
+	fmt.Fprintln(w, "# HELP wrstat_ui_oldest_dataset_age_seconds Age of the oldest loaded dataset.")
+	fmt.Fprintln(w, "# TYPE wrstat_ui_oldest_dataset_age_seconds gauge")
+	fmt.Fprintf(w, "wrstat_ui_oldest_dataset_age_seconds %g\n", oldestDatasetAge.Seconds())
+}
+
+func (m *metrics) writeRequests(w io.Writer) {
+	labels := make([]requestLabels, 0, len(m.requests))
+
+	for l := range m.requests {
+		labels = append(labels, l)
+	}
+
+	sort.Slice(labels, func(i, j int) bool {
+		if labels[i].endpoint != labels[j].endpoint {
+			return labels[i].endpoint < labels[j].endpoint
+		}
+
+		if labels[i].method != labels[j].method {
+			return labels[i].method < labels[j].method
+		}
+
+		return labels[i].status < labels[j].status
+	})
+
+	fmt.Fprintln(w, "# HELP wrstat_ui_http_requests_total HTTP requests by endpoint, method and status.")
+	fmt.Fprintln(w, "# TYPE wrstat_ui_http_requests_total counter")
+
+	for _, l := range labels {
+		fmt.Fprintf(w, "wrstat_ui_http_requests_total{endpoint=%q,method=%q,status=\"%d\"} %d\n",
+			l.endpoint, l.method, l.status, m.requests[l])
+	}
+}
+
+func writeHistograms(w io.Writer, name, help, labelName string, histograms map[string]*histogram) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+
+	for _, key := range sortedKeys(histograms) {
+		histograms[key].write(w, name, fmt.Sprintf("%s=%q", labelName, key))
+	}
+}
+
+func (m *metrics) writeReloads(w io.Writer) {
+	labels := make([]reloadLabels, 0, len(m.reloads))
+
+	for l := range m.reloads {
+		labels = append(labels, l)
+	}
+
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i].kind+labels[i].result < labels[j].kind+labels[j].result
+	})
+
+	fmt.Fprintln(w, "# HELP wrstat_ui_reloads_total Database reloads by kind and result.")
+	fmt.Fprintln(w, "# TYPE wrstat_ui_reloads_total counter")
+
+	for _, l := range labels {
+		fmt.Fprintf(w, "wrstat_ui_reloads_total{kind=%q,result=%q} %d\n", l.kind, l.result, m.reloads[l])
+	}
+}
+
+func sortedKeys(histograms map[string]*histogram) []string {
+	keys := make([]string, 0, len(histograms))
+
+	for key := range histograms {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// queryName returns the name we use to label metrics about the query being
+// answered by the given request, eg. "where" for /rest/v1/auth/where.
+func queryName(c *gin.Context) string {
+	full := strings.TrimSuffix(c.FullPath(), "/")
+	if full == "" {
+		return unmatchedEndpoint
+	}
+
+	return path.Base(full)
+}
+
+// getMetrics responds with our metrics in the Prometheus text exposition
+// format.
+func (s *Server) getMetrics(c *gin.Context) {
+	c.Header("Content-Type", metricsContentType)
+	c.Status(http.StatusOK)
+
+	s.metrics.write(c.Writer)
+}
@@ -0,0 +1,237 @@
+/*******************************************************************************
+ * Copyright (c) 2024 Genome Research Ltd.
+ *
+ * Author: Sendu Bala <sb10@sanger.ac.uk>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining
+ * a copy of this software and associated documentation files (the
+ * "Software"), to deal in the Software without restriction, including
+ * without limitation the rights to use, copy, modify, merge, publish,
+ * distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so, subject to
+ * the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included
+ * in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+ * CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+ * TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ ******************************************************************************/
+
+package server
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/moby/sys/mountinfo"
+	"github.com/wtsi-ssg/wrstat/v5/summary"
+)
+
+const (
+	procMountsPath = "/proc/self/mounts"
+
+	procMountsMinFields   = 3
+	procMountsPointField  = 1
+	procMountsFSTypeField = 2
+
+	octalEscapeLen = 3
+)
+
+// DefaultMountFSTypes are the file system types that mount points are usually
+// detected for with DetectMountPoints().
+var DefaultMountFSTypes = []string{"lustre", "nfs", "nfs4"} //nolint:gochecknoglobals
+
+// SetMountPoints sets the mount points that base directories and their history
+// are considered to be on, for use if the automatic discovery of mount points
+// on the server's system doesn't work. The mount points apply to the currently
+// loaded basedirs database and any that get loaded in the future.
+func (s *Server) SetMountPoints(mountpoints []string) {
+	s.basedirsMutex.Lock()
+	defer s.basedirsMutex.Unlock()
+
+	s.mountPoints = make([]string, len(mountpoints))
+
+	for i, mp := range mountpoints {
+		if !strings.HasSuffix(mp, "/") {
+			mp += "/"
+		}
+
+		s.mountPoints[i] = mp
+	}
+
+	if s.basedirs != nil {
+		s.basedirs.SetMountPoints(s.mountPoints)
+	}
+}
+
+// DetectMountPoints reads the system's mounts from /proc/self/mounts and passes
+// those with one of the given file system types to SetMountPoints(). Use this
+// instead of relying on the automatic discovery of all the system's mount
+// points if that picks up irrelevant mounts, or doesn't notice new ones.
+func (s *Server) DetectMountPoints(fsTypes []string) error {
+	f, err := os.Open(procMountsPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	mountpoints, err := mountPointsOf(f, fsTypes)
+	if err != nil {
+		return err
+	}
+
+	s.SetMountPoints(mountpoints)
+
+	return nil
+}
+
+// mountPointsOf parses the given content in the format of /proc/self/mounts and
+// returns the unique mount points of the given file system types, each with a
+// trailing slash, sorted longest first as basedirs expects.
+func mountPointsOf(r io.Reader, fsTypes []string) ([]string, error) {
+	wanted := make(map[string]bool, len(fsTypes))
+
+	for _, fsType := range fsTypes {
+		wanted[fsType] = true
+	}
+
+	seen := make(map[string]bool)
+
+	var mountpoints []string
+
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < procMountsMinFields || !wanted[fields[procMountsFSTypeField]] {
+			continue
+		}
+
+		mp := unescapeMountPoint(fields[procMountsPointField])
+		if !strings.HasSuffix(mp, "/") {
+			mp += "/"
+		}
+
+		if !seen[mp] {
+			seen[mp] = true
+			mountpoints = append(mountpoints, mp)
+		}
+	}
+
+	sort.Slice(mountpoints, func(i, j int) bool {
+		if len(mountpoints[i]) == len(mountpoints[j]) {
+			return mountpoints[i] < mountpoints[j]
+		}
+
+		return len(mountpoints[i]) > len(mountpoints[j])
+	})
+
+	return mountpoints, scanner.Err()
+}
+
+// unescapeMountPoint converts the octal escapes that /proc/self/mounts uses for
+// spaces and other special characters in mount points back to the characters.
+func unescapeMountPoint(mp string) string {
+	if !strings.Contains(mp, "\\") {
+		return mp
+	}
+
+	var b strings.Builder
+
+	for i := 0; i < len(mp); i++ {
+		if mp[i] == '\\' && i+octalEscapeLen < len(mp) {
+			if n, err := strconv.ParseUint(mp[i+1:i+1+octalEscapeLen], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += octalEscapeLen
+
+				continue
+			}
+		}
+
+		b.WriteByte(mp[i])
+	}
+
+	return b.String()
+}
+
+// mountsInUse returns the sorted mount points that our group base directories
+// are on. You must hold the basedirs read lock.
+func (s *Server) mountsInUse() ([]string, error) {
+	candidates, err := s.knownMountPoints()
+	if err != nil {
+		return nil, err
+	}
+
+	usage, err := s.groupUsage(summary.DGUTAgeAll)
+	if err != nil {
+		return nil, err
+	}
+
+	inUse := make(map[string]bool)
+
+	for _, u := range usage {
+		if mp := longestPrefix(candidates, u.BaseDir); mp != "" {
+			inUse[mp] = true
+		}
+	}
+
+	paths := make([]string, 0, len(inUse))
+
+	for mp := range inUse {
+		paths = append(paths, mp)
+	}
+
+	sort.Strings(paths)
+
+	return paths, nil
+}
+
+// knownMountPoints returns the mount points set with SetMountPoints(), or if
+// none were set, those of the system, each with a trailing slash.
+func (s *Server) knownMountPoints() ([]string, error) {
+	if s.mountPoints != nil {
+		return s.mountPoints, nil
+	}
+
+	mounts, err := mountinfo.GetMounts(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	mps := make([]string, len(mounts))
+
+	for i, m := range mounts {
+		mp := m.Mountpoint
+		if !strings.HasSuffix(mp, "/") {
+			mp += "/"
+		}
+
+		mps[i] = mp
+	}
+
+	return mps, nil
+}
+
+// longestPrefix returns the longest of the given mount points that path is
+// within, or blank if none.
+func longestPrefix(mountpoints []string, path string) string {
+	longest := ""
+
+	for _, mp := range mountpoints {
+		if len(mp) > len(longest) && strings.HasPrefix(path+"/", mp) {
+			longest = mp
+		}
+	}
+
+	return longest
+}
@@ -0,0 +1,163 @@
+/*******************************************************************************
+ * Copyright (c) 2024 Genome Research Ltd.
+ *
+ * Author: Sendu Bala <sb10@sanger.ac.uk>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining
+ * a copy of this software and associated documentation files (the
+ * "Software"), to deal in the Software without restriction, including
+ * without limitation the rights to use, copy, modify, merge, publish,
+ * distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so, subject to
+ * the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included
+ * in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+ * CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+ * TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ ******************************************************************************/
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wtsi-hgi/wrstat-ui/internal/split"
+	"github.com/wtsi-ssg/wrstat/v5/dguta"
+)
+
+const (
+	// DefaultStaleThreshold is the StaleThreshold used by new Servers.
+	DefaultStaleThreshold = 3 * 24 * time.Hour
+)
+
+// MountStatus describes one of the loaded dguta datasets: its Key (the name of
+// its database directory), the Mount path its data is all nested under, the
+// unix Timestamp of when it was created, how many hours old that is, and
+// whether that is older than the server's stale threshold.
+type MountStatus struct {
+	Key       string
+	Mount     string
+	Timestamp int64
+	AgeHours  float64
+	Stale     bool
+}
+
+// dataset is what we know about a loaded dguta database directory.
+type dataset struct {
+	key   string
+	mount string
+	mtime time.Time
+}
+
+// SetStaleThreshold sets how old a dataset has to be before the mount status
+// endpoint reports it as stale. Defaults to DefaultStaleThreshold.
+func (s *Server) SetStaleThreshold(threshold time.Duration) {
+	s.treeMutex.Lock()
+	defer s.treeMutex.Unlock()
+
+	s.staleThreshold = threshold
+}
+
+// getMounts responds with a MountStatus for each of our loaded dguta datasets.
+// LoadDGUTADBs() must already have been called. This is called when there is a
+// GET on /rest/v1/mounts or /rest/v1/auth/mounts.
+func (s *Server) getMounts(c *gin.Context) {
+	s.treeMutex.RLock()
+	defer s.treeMutex.RUnlock()
+
+	now := time.Now()
+	statuses := make([]*MountStatus, len(s.datasets))
+
+	for i, ds := range s.datasets {
+		age := now.Sub(ds.mtime)
+
+		statuses[i] = &MountStatus{
+			Key:       ds.key,
+			Mount:     ds.mount,
+			Timestamp: ds.mtime.Unix(),
+			AgeHours:  age.Hours(),
+			Stale:     age > s.staleThreshold,
+		}
+	}
+
+	respond(c, http.StatusOK, statuses)
+}
+
+// datasetsOf returns a dataset for each of the given dguta database
+// directories, examining up to the given number of them at once. If any of them
+// can't be opened, the errors for all of them are returned joined together.
+// Other problems finding out about them are just logged.
+func (s *Server) datasetsOf(paths []string, workers int) ([]*dataset, error) {
+	datasets := make([]*dataset, len(paths))
+	errs := make([]error, len(paths))
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+
+	for range min(max(workers, 1), len(paths)) {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range indexes {
+				datasets[i], errs[i] = s.datasetOf(paths[i])
+			}
+		}()
+	}
+
+	for i := range paths {
+		indexes <- i
+	}
+
+	close(indexes)
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	return datasets, nil
+}
+
+// datasetOf opens the given dguta database directory to find the deepest
+// directory that all its data is nested under.
+func (s *Server) datasetOf(path string) (*dataset, error) {
+	tree, err := dguta.NewTree(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	defer tree.Close()
+
+	ds := &dataset{key: filepath.Base(path)}
+
+	if fi, errs := os.Stat(path); errs == nil {
+		ds.mtime = fi.ModTime()
+	} else {
+		s.Logger.Printf("could not get the timestamp of dguta db %s: %s", path, errs)
+	}
+
+	dcss, err := tree.Where(defaultDir, &dguta.Filter{}, split.SplitsToSplitFn(0))
+	if err != nil {
+		s.Logger.Printf("could not get the mount of dguta db %s: %s", path, err)
+	} else if len(dcss) > 0 {
+		ds.mount = dcss[0].Dir
+	}
+
+	return ds, nil
+}
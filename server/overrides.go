@@ -0,0 +1,305 @@
+/*******************************************************************************
+ * Copyright (c) 2024 Genome Research Ltd.
+ *
+ * Author: Sendu Bala <sb10@sanger.ac.uk>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining
+ * a copy of this software and associated documentation files (the
+ * "Software"), to deal in the Software without restriction, including
+ * without limitation the rights to use, copy, modify, merge, publish,
+ * distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so, subject to
+ * the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included
+ * in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+ * CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+ * TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ ******************************************************************************/
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	gas "github.com/wtsi-hgi/go-authserver"
+	"github.com/wtsi-ssg/wrstat/v5/basedirs"
+	"github.com/wtsi-ssg/wrstat/v5/summary"
+)
+
+const (
+	ErrBadOverride = gas.Error("bad override; check gid, basedir, quota_size and quota_inodes")
+
+	overridesFilePerms = 0600
+)
+
+// QuotaOverride is a soft quota set by an administrator for a group's base
+// directory, used in place of the quota from the quota CSV. A nil QuotaSize or
+// QuotaInodes leaves that quota as it was.
+type QuotaOverride struct {
+	GID         uint32  `json:"gid"`
+	BaseDir     string  `json:"basedir"`
+	QuotaSize   *uint64 `json:"quota_size,omitempty"`
+	QuotaInodes *uint64 `json:"quota_inodes,omitempty"`
+}
+
+type quotaOverrideKey struct {
+	gid     uint32
+	basedir string
+}
+
+// SetQuotaOverridesFile makes quota overrides persist in the given JSON file,
+// loading any overrides already in it. Without this, overrides are forgotten
+// whenever the basedirs database is reloaded.
+func (s *Server) SetQuotaOverridesFile(path string) error {
+	s.basedirsMutex.Lock()
+	defer s.basedirsMutex.Unlock()
+
+	overrides, err := readQuotaOverrides(path)
+	if err != nil {
+		return err
+	}
+
+	s.overridesPath = path
+	s.setQuotaOverrides(overrides)
+
+	return nil
+}
+
+// readQuotaOverrides reads the overrides in the given JSON file. A non-existent
+// file is treated as having no overrides.
+func readQuotaOverrides(path string) (map[quotaOverrideKey]*QuotaOverride, error) {
+	overrides := make(map[quotaOverrideKey]*QuotaOverride)
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return overrides, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var list []*QuotaOverride
+
+	if err = json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+
+	for _, o := range list {
+		overrides[quotaOverrideKey{o.GID, o.BaseDir}] = o
+	}
+
+	return overrides, nil
+}
+
+// setQuotaOverrides replaces our overrides, updating our basedirs cache
+// validators so clients don't use responses with the old quotas. You must hold
+// the basedirsMutex write lock.
+func (s *Server) setQuotaOverrides(overrides map[quotaOverrideKey]*QuotaOverride) {
+	s.quotaOverrides = overrides
+	s.overridesVersion++
+	s.overridesModTime = time.Now()
+	s.setBasedirsCacheValidators()
+}
+
+// resetQuotaOverrides reverts our overrides to those in our overrides file,
+// or to none if there isn't one. You must hold the basedirsMutex write lock.
+func (s *Server) resetQuotaOverrides() {
+	if s.overridesPath == "" {
+		s.setQuotaOverrides(nil)
+
+		return
+	}
+
+	overrides, err := readQuotaOverrides(s.overridesPath)
+	if err != nil {
+		s.Logger.Printf("reading quota overrides failed: %s", err)
+
+		overrides = nil
+	}
+
+	s.setQuotaOverrides(overrides)
+}
+
+// writeQuotaOverrides writes the given overrides to our overrides file, if we
+// have one.
+func (s *Server) writeQuotaOverrides(overrides map[quotaOverrideKey]*QuotaOverride) error {
+	if s.overridesPath == "" {
+		return nil
+	}
+
+	list := make([]*QuotaOverride, 0, len(overrides))
+
+	for _, o := range overrides {
+		list = append(list, o)
+	}
+
+	data, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(s.overridesPath, data, overridesFilePerms)
+}
+
+// groupUsage is like basedirs.BaseDirReader.GroupUsage(), but with any quota
+// overrides applied. Note that the DateNoSpace and DateNoFiles predictions
+// are still those made with the original quotas.
+func (s *Server) groupUsage(age summary.DirGUTAge) ([]*basedirs.Usage, error) {
+	usage, err := s.basedirs.GroupUsage(age)
+	if err != nil || len(s.quotaOverrides) == 0 {
+		return usage, err
+	}
+
+	for i, u := range usage {
+		usage[i] = s.withQuotaOverride(u)
+	}
+
+	return usage, nil
+}
+
+// withQuotaOverride returns the given usage if there is no quota override for
+// its group and basedir, otherwise a copy of it with the override applied.
+func (s *Server) withQuotaOverride(u *basedirs.Usage) *basedirs.Usage {
+	o, ok := s.quotaOverrides[quotaOverrideKey{u.GID, u.BaseDir}]
+	if !ok {
+		return u
+	}
+
+	overridden := *u
+
+	if o.QuotaSize != nil {
+		overridden.QuotaSize = *o.QuotaSize
+	}
+
+	if o.QuotaInodes != nil {
+		overridden.QuotaInodes = *o.QuotaInodes
+	}
+
+	return &overridden
+}
+
+// patchQuotaOverride lets white-listed users set the quota_size and/or
+// quota_inodes override for the basedir of the gid in the URL, given in a JSON
+// body. It responds with the resulting override.
+//
+// This is called when there is a PATCH on
+// /rest/v1/auth/basedirs/usage/groups/:gid.
+func (s *Server) patchQuotaOverride(c *gin.Context) {
+	key, ok := s.quotaOverrideKeyFromRequest(c)
+	if !ok {
+		return
+	}
+
+	var o QuotaOverride
+
+	if err := c.ShouldBindJSON(&o); err != nil || (o.QuotaSize == nil && o.QuotaInodes == nil) {
+		c.AbortWithError(http.StatusBadRequest, ErrBadOverride) //nolint:errcheck
+
+		return
+	}
+
+	s.basedirsMutex.Lock()
+	defer s.basedirsMutex.Unlock()
+
+	overrides := make(map[quotaOverrideKey]*QuotaOverride, len(s.quotaOverrides)+1)
+
+	for k, v := range s.quotaOverrides {
+		overrides[k] = v
+	}
+
+	merged := &QuotaOverride{GID: key.gid, BaseDir: key.basedir}
+
+	if existing, found := overrides[key]; found {
+		*merged = *existing
+	}
+
+	if o.QuotaSize != nil {
+		merged.QuotaSize = o.QuotaSize
+	}
+
+	if o.QuotaInodes != nil {
+		merged.QuotaInodes = o.QuotaInodes
+	}
+
+	overrides[key] = merged
+
+	s.updateQuotaOverrides(c, overrides, merged)
+}
+
+// deleteQuotaOverride lets white-listed users clear the override for the
+// basedir given in the basedir parameter of the gid in the URL.
+//
+// This is called when there is a DELETE on
+// /rest/v1/auth/basedirs/usage/groups/:gid.
+func (s *Server) deleteQuotaOverride(c *gin.Context) {
+	key, ok := s.quotaOverrideKeyFromRequest(c)
+	if !ok {
+		return
+	}
+
+	s.basedirsMutex.Lock()
+	defer s.basedirsMutex.Unlock()
+
+	overrides := make(map[quotaOverrideKey]*QuotaOverride, len(s.quotaOverrides))
+
+	for k, v := range s.quotaOverrides {
+		if k != key {
+			overrides[k] = v
+		}
+	}
+
+	s.updateQuotaOverrides(c, overrides, nil)
+}
+
+// updateQuotaOverrides sets and persists the given overrides, responding with
+// the given result. You must hold the basedirsMutex write lock.
+func (s *Server) updateQuotaOverrides(c *gin.Context, overrides map[quotaOverrideKey]*QuotaOverride,
+	result *QuotaOverride) {
+	if err := s.writeQuotaOverrides(overrides); err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err) //nolint:errcheck
+
+		return
+	}
+
+	s.setQuotaOverrides(overrides)
+
+	if result == nil {
+		c.Status(http.StatusNoContent)
+
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// quotaOverrideKeyFromRequest checks the requesting user is white-listed and
+// returns the gid in the URL and basedir in the query parameters. If not ok,
+// the request has already been aborted.
+func (s *Server) quotaOverrideKeyFromRequest(c *gin.Context) (quotaOverrideKey, bool) {
+	if !s.requireAdmin(c) {
+		return quotaOverrideKey{}, false
+	}
+
+	gid, err := strconv.ParseUint(c.Param("gid"), 10, 32)
+	basedir := c.Query("basedir")
+
+	if err != nil || basedir == "" {
+		c.AbortWithError(http.StatusBadRequest, ErrBadOverride) //nolint:errcheck
+
+		return quotaOverrideKey{}, false
+	}
+
+	return quotaOverrideKey{uint32(gid), basedir}, true
+}
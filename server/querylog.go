@@ -0,0 +1,132 @@
+/*******************************************************************************
+ * Copyright (c) 2024 Genome Research Ltd.
+ *
+ * Author: Sendu Bala <sb10@sanger.ac.uk>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining
+ * a copy of this software and associated documentation files (the
+ * "Software"), to deal in the Software without restriction, including
+ * without limitation the rights to use, copy, modify, merge, publish,
+ * distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so, subject to
+ * the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included
+ * in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+ * CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+ * TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ ******************************************************************************/
+
+package server
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// DefaultSlowQueryThreshold is the SlowQueryThreshold used by new Servers.
+	DefaultSlowQueryThreshold = 5 * time.Second
+
+	queryRowsKey = "queryRows"
+	noUser       = "-"
+)
+
+// SetSlowQueryThreshold sets how long a where, tree or basedirs query can take
+// before its query log line is emitted as a WARN instead of an INFO. Defaults
+// to DefaultSlowQueryThreshold.
+func (s *Server) SetSlowQueryThreshold(threshold time.Duration) {
+	s.slowQueryMutex.Lock()
+	defer s.slowQueryMutex.Unlock()
+
+	s.slowQueryThreshold = threshold
+}
+
+// logQueries is middleware that, for requests to the where, tree and basedirs
+// endpoints, logs the request's ID, the authenticated username, the query
+// parameters (sorted by key), the number of results and how long it took. Only
+// the URL's query parameters are logged, never headers or cookies, so JWTs are
+// not exposed.
+func (s *Server) logQueries(c *gin.Context) {
+	if !isLoggedQuery(c.FullPath()) {
+		c.Next()
+
+		return
+	}
+
+	start := time.Now()
+
+	c.Next()
+
+	duration := time.Since(start)
+
+	s.slowQueryMutex.RLock()
+	threshold := s.slowQueryThreshold
+	s.slowQueryMutex.RUnlock()
+
+	level := "INFO"
+	if duration > threshold {
+		level = "WARN"
+	}
+
+	rows := -1
+	if n, ok := c.Get(queryRowsKey); ok {
+		rows, _ = n.(int)
+	}
+
+	s.Logger.Printf("%s query ID=%s USER=%s ENDPOINT=%s PARAMS=%q STATUS=%d ROWS=%d DURATION=%s",
+		level, c.GetString(requestIDKey), s.queryUsername(c), c.FullPath(), c.Request.URL.Query().Encode(),
+		c.Writer.Status(), rows, duration)
+}
+
+// isLoggedQuery returns true if the given route is one of the where, tree or
+// basedirs endpoints.
+func isLoggedQuery(route string) bool {
+	for _, path := range []string{wherePath, TreePath, basedirsPath} {
+		if strings.Contains(route, path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// queryUsername returns the username of the authenticated user making the
+// request, or "-" if there isn't one.
+func (s *Server) queryUsername(c *gin.Context) string {
+	if u := s.GetUser(c); u != nil {
+		return u.Username
+	}
+
+	return noUser
+}
+
+// setQueryRows records the number of results a query returned, for our query
+// log.
+func setQueryRows(c *gin.Context, n int) {
+	c.Set(queryRowsKey, n)
+}
+
+// resultRows returns the number of results in the given response object: the
+// length of a slice or map, otherwise 1.
+func resultRows(obj any) int {
+	v := reflect.ValueOf(obj)
+
+	switch v.Kind() { //nolint:exhaustive
+	case reflect.Slice, reflect.Map:
+		return v.Len()
+	case reflect.Invalid:
+		return 0
+	default:
+		return 1
+	}
+}
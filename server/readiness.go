@@ -0,0 +1,79 @@
+/*******************************************************************************
+ * Copyright (c) 2024 Genome Research Ltd.
+ *
+ * Author: Sendu Bala <sb10@sanger.ac.uk>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining
+ * a copy of this software and associated documentation files (the
+ * "Software"), to deal in the Software without restriction, including
+ * without limitation the rights to use, copy, modify, merge, publish,
+ * distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so, subject to
+ * the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included
+ * in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+ * CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+ * TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ ******************************************************************************/
+
+package server
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+)
+
+const readinessFilePerms = 0644
+
+// SetReadinessFile sets a path that will be created once LoadDGUTADBs() first
+// succeeds, and removed when Stop() is called. This is useful for things like
+// Kubernetes readiness probes that check for the existence of a file.
+//
+// If the file can't be created, a warning is logged, but the server continues
+// as normal.
+func (s *Server) SetReadinessFile(path string) {
+	s.treeMutex.Lock()
+	defer s.treeMutex.Unlock()
+
+	s.readinessFile = path
+}
+
+// writeReadinessFile creates our readiness file, if we have one and haven't
+// already created it. You must hold the tree write lock.
+func (s *Server) writeReadinessFile() {
+	if s.readinessFile == "" || s.readinessWritten {
+		return
+	}
+
+	if err := os.WriteFile(s.readinessFile, nil, readinessFilePerms); err != nil {
+		s.Logger.Printf("WARN could not write readiness file: %s", err)
+
+		return
+	}
+
+	s.readinessWritten = true
+}
+
+// removeReadinessFile removes our readiness file, if we created it.
+func (s *Server) removeReadinessFile() {
+	s.treeMutex.Lock()
+	defer s.treeMutex.Unlock()
+
+	if !s.readinessWritten {
+		return
+	}
+
+	s.readinessWritten = false
+
+	if err := os.Remove(s.readinessFile); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		s.Logger.Printf("WARN could not remove readiness file: %s", err)
+	}
+}
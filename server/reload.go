@@ -0,0 +1,183 @@
+/*******************************************************************************
+ * Copyright (c) 2024 Genome Research Ltd.
+ *
+ * Author: Sendu Bala <sb10@sanger.ac.uk>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining
+ * a copy of this software and associated documentation files (the
+ * "Software"), to deal in the Software without restriction, including
+ * without limitation the rights to use, copy, modify, merge, publish,
+ * distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so, subject to
+ * the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included
+ * in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+ * CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+ * TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ ******************************************************************************/
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	gas "github.com/wtsi-hgi/go-authserver"
+)
+
+const (
+	// DefaultReloadHistorySize is the number of ReloadEvents a new Server
+	// remembers.
+	DefaultReloadHistorySize = 20
+
+	reloadHistoryPath = "/reload-history"
+
+	// EndPointAuthReloadHistory is the endpoint white-listed users can use to
+	// get the most recent ReloadEvents, available if authorization is
+	// implemented.
+	EndPointAuthReloadHistory = gas.EndPointAuth + reloadHistoryPath
+)
+
+// ReloadEvent describes an attempt to reload a kind of database (the Key, eg.
+// "dguta dbs", "basedirs db" or "owners"). RecordCount is the number of dguta
+// database directories, basedirs group base directories, or owners that were
+// loaded. Error is blank if the reload succeeded.
+type ReloadEvent struct {
+	Key         string
+	StartedAt   time.Time
+	FinishedAt  time.Time
+	RecordCount int
+	Error       string `json:",omitempty"`
+}
+
+// ReloadLogger is something that wants to know about every ReloadEvent.
+type ReloadLogger interface {
+	LogReload(event *ReloadEvent)
+}
+
+// JSONReloadLogger is a ReloadLogger that writes each ReloadEvent as a line of
+// JSON to its Writer. It is what Servers use by default, writing to STDERR.
+type JSONReloadLogger struct {
+	io.Writer
+}
+
+// LogReload writes the given event as JSON on its own line.
+func (j JSONReloadLogger) LogReload(event *ReloadEvent) {
+	json.NewEncoder(j.Writer).Encode(event) //nolint:errcheck,errchkjson
+}
+
+// SetReloadLogger sets the ReloadLogger that will be told about every reload
+// of the dguta and basedirs databases. Defaults to a JSONReloadLogger writing
+// to STDERR.
+func (s *Server) SetReloadLogger(logger ReloadLogger) {
+	s.reloadMutex.Lock()
+	defer s.reloadMutex.Unlock()
+
+	s.reloadLogger = logger
+}
+
+// SetReloadHistorySize sets how many of the most recent ReloadEvents are
+// served by EndPointAuthReloadHistory. Defaults to DefaultReloadHistorySize.
+func (s *Server) SetReloadHistorySize(n int) {
+	s.reloadMutex.Lock()
+	defer s.reloadMutex.Unlock()
+
+	s.reloadHistorySize = n
+	s.trimReloadHistory()
+}
+
+// LastReloadError returns the error from the most recent attempt to reload the
+// dguta or basedirs databases, or nil if that attempt succeeded (or there
+// haven't been any). When a reload fails, the previously loaded databases
+// continue to be used.
+func (s *Server) LastReloadError() error {
+	s.reloadMutex.Lock()
+	defer s.reloadMutex.Unlock()
+
+	return s.lastReloadError
+}
+
+// ReloadErrors returns the number of times reloading the dguta or basedirs
+// databases has failed.
+func (s *Server) ReloadErrors() int {
+	s.reloadMutex.Lock()
+	defer s.reloadMutex.Unlock()
+
+	return s.reloadErrors
+}
+
+// recordReload records the result of reloading the given kind of database,
+// which started at the given time and loaded the given number of records,
+// logging and counting it if it's an error.
+func (s *Server) recordReload(kind string, start time.Time, records int, err error) {
+	s.metrics.observeReload(kind, time.Since(start), err)
+
+	s.reloadMutex.Lock()
+	defer s.reloadMutex.Unlock()
+
+	event := &ReloadEvent{Key: kind, StartedAt: start, FinishedAt: time.Now(), RecordCount: records}
+
+	defer s.logReloadEvent(event)
+
+	if err == nil {
+		s.lastReloadError = nil
+
+		return
+	}
+
+	s.lastReloadError = fmt.Errorf("reloading %s failed: %w", kind, err)
+	s.reloadErrors++
+	event.Error = err.Error()
+
+	s.Logger.Printf("%s; continuing to use the previous databases", s.lastReloadError)
+}
+
+// logReloadEvent passes the given event to our ReloadLogger and adds it to our
+// history. You must hold the reloadMutex.
+func (s *Server) logReloadEvent(event *ReloadEvent) {
+	if s.reloadLogger != nil {
+		s.reloadLogger.LogReload(event)
+	}
+
+	s.reloadHistory = append(s.reloadHistory, event)
+	s.trimReloadHistory()
+}
+
+// trimReloadHistory removes the oldest ReloadEvents from our history if we
+// have more than our reloadHistorySize. You must hold the reloadMutex.
+func (s *Server) trimReloadHistory() {
+	if excess := len(s.reloadHistory) - max(s.reloadHistorySize, 0); excess > 0 {
+		s.reloadHistory = append([]*ReloadEvent(nil), s.reloadHistory[excess:]...)
+	}
+}
+
+// getReloadHistory responds with our most recent ReloadEvents, oldest first,
+// to white-listed users. This is called when there is a GET on
+// /rest/v1/auth/reload-history.
+func (s *Server) getReloadHistory(c *gin.Context) {
+	if !s.requireAdmin(c) {
+		return
+	}
+
+	s.reloadMutex.Lock()
+	defer s.reloadMutex.Unlock()
+
+	c.JSON(http.StatusOK, append([]*ReloadEvent{}, s.reloadHistory...))
+}
+
+// newDefaultReloadLogger returns the ReloadLogger Servers use by default.
+func newDefaultReloadLogger() ReloadLogger {
+	return JSONReloadLogger{Writer: os.Stderr}
+}
@@ -0,0 +1,113 @@
+/*******************************************************************************
+ * Copyright (c) 2024 Genome Research Ltd.
+ *
+ * Author: Sendu Bala <sb10@sanger.ac.uk>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining
+ * a copy of this software and associated documentation files (the
+ * "Software"), to deal in the Software without restriction, including
+ * without limitation the rights to use, copy, modify, merge, publish,
+ * distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so, subject to
+ * the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included
+ * in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+ * CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+ * TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ ******************************************************************************/
+
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// RequestIDHeader is the header we read a request's ID from, and return it
+	// in.
+	RequestIDHeader = "X-Request-ID"
+
+	requestIDKey    = "requestID"
+	maxRequestIDLen = 128
+	uuidBytes       = 16
+)
+
+type requestIDContextKey struct{}
+
+// RequestID returns the request ID stored in the given context by our request
+// ID middleware, or an empty string if there isn't one.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+
+	return id
+}
+
+// useRequestIDs adds middleware to our router, after go-authserver's own
+// logging and panic recovery, that assigns every request an ID and then logs
+// the request again in the usual format but including that ID.
+func (s *Server) useRequestIDs() {
+	s.Router().Use(requestIDMiddleware, requestLogger())
+}
+
+// requestIDMiddleware takes the ID from the request's X-Request-ID header, or
+// generates a new UUID if there wasn't one (or it was unreasonably long),
+// and returns it in the response header, as well as storing it in the gin
+// and request contexts.
+func requestIDMiddleware(c *gin.Context) {
+	id := c.GetHeader(RequestIDHeader)
+	if id == "" || len(id) > maxRequestIDLen {
+		id = newRequestID()
+	}
+
+	c.Header(RequestIDHeader, id)
+	c.Set(requestIDKey, id)
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), requestIDContextKey{}, id))
+
+	c.Next()
+}
+
+// newRequestID returns a random (version 4) UUID.
+func newRequestID() string {
+	var b [uuidBytes]byte
+
+	rand.Read(b[:]) //nolint:errcheck
+
+	b[6] = (b[6] & 0x0f) | 0x40 //nolint:mnd
+	b[8] = (b[8] & 0x3f) | 0x80 //nolint:mnd
+
+	h := hex.EncodeToString(b[:])
+
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+// requestLogger returns a handler that logs in the same searchable format as
+// go-authserver, but with the request's ID included.
+func requestLogger() gin.HandlerFunc {
+	return gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
+		id, _ := param.Keys[requestIDKey].(string)
+
+		return fmt.Sprintf("%s - [%s %s %s \"%s\"] ID=%s STATUS=%d %s %s\n",
+			param.ClientIP,
+			param.Method,
+			param.Path,
+			param.Request.Proto,
+			param.Request.UserAgent(),
+			id,
+			param.StatusCode,
+			param.Latency,
+			param.ErrorMessage,
+		)
+	})
+}
@@ -0,0 +1,137 @@
+/*******************************************************************************
+ * Copyright (c) 2024 Genome Research Ltd.
+ *
+ * Author: Sendu Bala <sb10@sanger.ac.uk>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining
+ * a copy of this software and associated documentation files (the
+ * "Software"), to deal in the Software without restriction, including
+ * without limitation the rights to use, copy, modify, merge, publish,
+ * distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so, subject to
+ * the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included
+ * in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+ * CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+ * TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ ******************************************************************************/
+
+package server
+
+import (
+	"os/user"
+	"sort"
+	"strconv"
+
+	"github.com/wtsi-ssg/wrstat/v5/dguta"
+	"github.com/wtsi-ssg/wrstat/v5/summary"
+)
+
+// RetentionDir is a directory all of whose files belonging to a particular
+// group are older than a retention threshold.
+type RetentionDir struct {
+	Dir   string
+	Size  uint64
+	Count uint64
+}
+
+// GroupRetention lists the directories of a group that would be deleted by a
+// retention policy, along with their total size and file count.
+type GroupRetention struct {
+	GID   uint32
+	Group string
+	Size  uint64
+	Count uint64
+	Dirs  []*RetentionDir
+}
+
+// RetentionPreview finds, for each group with files nested under dir, the
+// directories whose files (of that group) all pass the given age filter, ie.
+// the directories that a policy of deleting data of that age would entirely
+// remove. Only the highest such directories are returned; their
+// subdirectories are not listed separately.
+//
+// Ages are evaluated with the same dguta.Filter semantics as the where and
+// tree endpoints. Results are sorted largest first, as are each group's Dirs.
+func RetentionPreview(tree *dguta.Tree, dir string, age summary.DirGUTAge) ([]*GroupRetention, error) {
+	di, err := tree.DirInfo(dir, &dguta.Filter{FTs: summary.AllTypesExceptDirectories})
+	if err != nil || di == nil {
+		return nil, err
+	}
+
+	previews := make([]*GroupRetention, 0, len(di.Current.GIDs))
+
+	for _, gid := range di.Current.GIDs {
+		gr := &GroupRetention{GID: gid, Group: gidToGroupName(gid)}
+
+		if err := addRetentionDirs(tree, dir, gid, age, gr); err != nil {
+			return nil, err
+		}
+
+		if len(gr.Dirs) == 0 {
+			continue
+		}
+
+		sort.SliceStable(gr.Dirs, func(i, j int) bool { return gr.Dirs[i].Size > gr.Dirs[j].Size })
+
+		previews = append(previews, gr)
+	}
+
+	sort.SliceStable(previews, func(i, j int) bool { return previews[i].Size > previews[j].Size })
+
+	return previews, nil
+}
+
+// addRetentionDirs adds dir to gr if all of gid's files in it pass the age
+// filter, otherwise recurses into dir's children that have gid's files.
+func addRetentionDirs(tree *dguta.Tree, dir string, gid uint32, age summary.DirGUTAge, gr *GroupRetention) error {
+	filter := &dguta.Filter{GIDs: []uint32{gid}, FTs: summary.AllTypesExceptDirectories}
+
+	all, err := tree.DirInfo(dir, filter)
+	if err != nil || all == nil || all.Current.Count == 0 {
+		return err
+	}
+
+	filter.Age = age
+
+	old, err := tree.DirInfo(dir, filter)
+	if err != nil {
+		return err
+	}
+
+	if old != nil && old.Current.Count == all.Current.Count {
+		gr.Dirs = append(gr.Dirs, &RetentionDir{Dir: dir, Size: old.Current.Size, Count: old.Current.Count})
+		gr.Size += old.Current.Size
+		gr.Count += old.Current.Count
+
+		return nil
+	}
+
+	for _, child := range all.Children {
+		if err := addRetentionDirs(tree, child.Dir, gid, age, gr); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// gidToGroupName returns the name of the group with the given gid, or the gid
+// as a string if it can't be looked up.
+func gidToGroupName(gid uint32) string {
+	id := strconv.FormatUint(uint64(gid), 10)
+
+	g, err := user.LookupGroupId(id)
+	if err != nil {
+		return id
+	}
+
+	return g.Name
+}
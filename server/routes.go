@@ -0,0 +1,127 @@
+/*******************************************************************************
+ * Copyright (c) 2024 Genome Research Ltd.
+ *
+ * Author: Sendu Bala <sb10@sanger.ac.uk>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining
+ * a copy of this software and associated documentation files (the
+ * "Software"), to deal in the Software without restriction, including
+ * without limitation the rights to use, copy, modify, merge, publish,
+ * distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so, subject to
+ * the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included
+ * in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+ * CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+ * TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ ******************************************************************************/
+
+package server
+
+import (
+	"github.com/gin-gonic/gin"
+	gas "github.com/wtsi-hgi/go-authserver"
+)
+
+const (
+	// EndPointRESTV2 is the base of version 2 of the REST API, used when
+	// authorization isn't implemented.
+	EndPointRESTV2 = "/rest/v2"
+
+	// EndPointAuthV2 is the base of version 2 of the REST API when
+	// authorization is implemented.
+	EndPointAuthV2 = EndPointRESTV2 + "/auth"
+
+	// EndPointV2Where and EndPointAuthV2Where are the version 2 equivalents of
+	// EndPointWhere and EndPointAuthWhere.
+	EndPointV2Where     = EndPointRESTV2 + wherePath
+	EndPointAuthV2Where = EndPointAuthV2 + wherePath
+
+	apiVersionKey = "wrstat-api-version"
+)
+
+// apiVersion describes a version of our REST API: where its endpoints are, and
+// how responses to them are serialised. Handlers are shared between versions,
+// and should send their responses using respond(), so that version-specific
+// differences in response schemas can be made in serialise.
+type apiVersion struct {
+	rest      string
+	auth      string
+	serialise func(c *gin.Context, code int, obj any)
+}
+
+var (
+	// apiV1 is the original API, at the /rest/v1 paths managed by gas.
+	apiV1 = &apiVersion{ //nolint:gochecknoglobals
+		rest: gas.EndPointREST,
+		auth: gas.EndPointAuth,
+		serialise: func(c *gin.Context, code int, obj any) {
+			c.IndentedJSON(code, obj)
+		},
+	}
+
+	// apiV2 is where breaking changes to the API can be introduced. So far it
+	// only differs from v1 in returning compact JSON.
+	apiV2 = &apiVersion{ //nolint:gochecknoglobals
+		rest: EndPointRESTV2,
+		auth: EndPointAuthV2,
+		serialise: func(c *gin.Context, code int, obj any) {
+			c.JSON(code, obj)
+		},
+	}
+)
+
+// routes returns the router group that endpoints of the given API version
+// should be added to: its auth group if EnableAuth() has been called, otherwise
+// its non-auth group. Handlers added to the group can find out which version
+// they were called through with versionOf().
+func (s *Server) routes(v *apiVersion) *gin.RouterGroup {
+	authGroup := s.AuthRouter()
+
+	if v == apiV1 {
+		if authGroup != nil {
+			return authGroup
+		}
+
+		return s.Router().Group(v.rest)
+	}
+
+	setVersion := func(c *gin.Context) {
+		c.Set(apiVersionKey, v)
+	}
+
+	if authGroup == nil {
+		return s.Router().Group(v.rest, setVersion)
+	}
+
+	// the last of gas's auth group handlers is the middleware that checks the
+	// JWT; the others are the engine's own, which our new group inherits.
+	jwtMiddleware := authGroup.Handlers[len(authGroup.Handlers)-1]
+
+	return s.Router().Group(v.auth, jwtMiddleware, setVersion)
+}
+
+// versionOf returns the API version that the request in the given context was
+// made through.
+func versionOf(c *gin.Context) *apiVersion {
+	if v, ok := c.Get(apiVersionKey); ok {
+		if av, ok := v.(*apiVersion); ok {
+			return av
+		}
+	}
+
+	return apiV1
+}
+
+// respond serialises the given obj as the response to the request in the given
+// context, in the manner of the API version the request was made through.
+func respond(c *gin.Context, code int, obj any) {
+	versionOf(c).serialise(c, code, obj)
+}
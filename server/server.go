@@ -31,12 +31,14 @@ package server
 import (
 	"embed"
 	"io"
+	"net/http"
 	"sync"
 	"time"
 
 	gas "github.com/wtsi-hgi/go-authserver"
 	"github.com/wtsi-ssg/wrstat/v5/basedirs"
 	"github.com/wtsi-ssg/wrstat/v5/dguta"
+	"github.com/wtsi-ssg/wrstat/v5/summary"
 	"github.com/wtsi-ssg/wrstat/v5/watch"
 )
 
@@ -60,30 +62,74 @@ const (
 	// group areas are, which is available if authorization is implemented.
 	EndPointAuthGroupAreas = gas.EndPointAuth + groupAreasPaths
 
+	groupAreaTreePath = "/group-area-tree"
+
+	// EndPointAuthGroupAreaTree is the endpoint for getting the group areas as
+	// a GroupAreaTree, which is available if authorization is implemented.
+	EndPointAuthGroupAreaTree = gas.EndPointAuth + groupAreaTreePath
+
 	basedirsPath            = "/basedirs"
 	basedirsUsagePath       = basedirsPath + "/usage"
 	basedirsGroupUsagePath  = basedirsUsagePath + "/groups"
 	basedirsUserUsagePath   = basedirsUsagePath + "/users"
+	basedirsOwnerUsagePath  = basedirsUsagePath + "/owner"
 	basedirsSubdirPath      = basedirsPath + "/subdirs"
 	basedirsGroupSubdirPath = basedirsSubdirPath + "/group"
 	basedirsUserSubdirPath  = basedirsSubdirPath + "/user"
 	basedirsHistoryPath     = basedirsPath + "/history"
+	basedirsAlertsPath      = basedirsPath + "/alerts"
 
 	// EndPointBasedir* are the endpoints for making base directory related
 	// queries if authorization isn't implemented.
 	EndPointBasedirUsageGroup  = gas.EndPointREST + basedirsGroupUsagePath
 	EndPointBasedirUsageUser   = gas.EndPointREST + basedirsUserUsagePath
+	EndPointBasedirUsageOwner  = gas.EndPointREST + basedirsOwnerUsagePath
 	EndPointBasedirSubdirGroup = gas.EndPointREST + basedirsGroupSubdirPath
 	EndPointBasedirSubdirUser  = gas.EndPointREST + basedirsUserSubdirPath
 	EndPointBasedirHistory     = gas.EndPointREST + basedirsHistoryPath
+	EndPointBasedirAlerts      = gas.EndPointREST + basedirsAlertsPath
 
 	// EndPointAuthBasedir* are the endpoints for making base directory related
 	// queries if authorization is implemented.
 	EndPointAuthBasedirUsageGroup  = gas.EndPointAuth + basedirsGroupUsagePath
 	EndPointAuthBasedirUsageUser   = gas.EndPointAuth + basedirsUserUsagePath
+	EndPointAuthBasedirUsageOwner  = gas.EndPointAuth + basedirsOwnerUsagePath
 	EndPointAuthBasedirSubdirGroup = gas.EndPointAuth + basedirsGroupSubdirPath
 	EndPointAuthBasedirSubdirUser  = gas.EndPointAuth + basedirsUserSubdirPath
 	EndPointAuthBasedirHistory     = gas.EndPointAuth + basedirsHistoryPath
+	EndPointAuthBasedirAlerts      = gas.EndPointAuth + basedirsAlertsPath
+
+	comparePath = "/compare"
+	mountsPath  = "/mounts"
+
+	// EndPointMounts is the endpoint for getting the status of each loaded
+	// dataset if authorization isn't implemented.
+	EndPointMounts = gas.EndPointREST + mountsPath
+
+	basedirsGroupOverridePath = basedirsGroupUsagePath + "/:gid"
+
+	// EndPointAuthBasedirQuotaOverride is the endpoint white-listed users can
+	// PATCH or DELETE to change the quota of one of a group's base directories;
+	// add the gid to the end. It is available if authorization is implemented.
+	EndPointAuthBasedirQuotaOverride = EndPointAuthBasedirUsageGroup + "/"
+
+	forecastPath = "/forecast"
+
+	// EndPointAuthForecast is the endpoint for getting a mount's disk-space
+	// forecast, which is available if authorization is implemented.
+	EndPointAuthForecast = gas.EndPointAuth + forecastPath
+
+	// EndPointAuthMounts is the endpoint for getting the status of each loaded
+	// dataset if authorization is implemented.
+	EndPointAuthMounts = gas.EndPointAuth + mountsPath
+
+	// EndPointCompare is the endpoint for comparing the storage profiles of
+	// groups if authorization isn't implemented.
+	EndPointCompare = gas.EndPointREST + comparePath
+
+	// EndPointAuthCompare is the endpoint for comparing the storage profiles of
+	// groups if authorization is implemented.
+	EndPointAuthCompare = gas.EndPointAuth + comparePath
 
 	// TreePath is the path to the static tree website.
 	TreePath = "/tree"
@@ -92,6 +138,22 @@ const (
 	// authorization is implemented.
 	EndPointAuthTree = gas.EndPointAuth + TreePath
 
+	topNPath      = TreePath + "/topn"
+	typesPath     = TreePath + "/types"
+	ancestorsPath = TreePath + "/ancestors"
+
+	// EndPointAuthTreeTypeBreakdown is the endpoint for getting the usage of
+	// each file type under a directory when authorization is implemented.
+	EndPointAuthTreeTypeBreakdown = gas.EndPointAuth + typesPath
+
+	// EndPointAuthTreeTopN is the endpoint for getting the largest directories
+	// under a directory when authorization is implemented.
+	EndPointAuthTreeTopN = gas.EndPointAuth + topNPath
+
+	// EndPointAuthTreeAncestors is the endpoint for getting summaries of a
+	// directory and all its parents when authorization is implemented.
+	EndPointAuthTreeAncestors = gas.EndPointAuth + ancestorsPath
+
 	defaultDir = "/"
 	unknown    = "#unknown"
 )
@@ -109,13 +171,60 @@ type Server struct {
 	dgutaPaths     []string
 	dgutaWatcher   *watch.Watcher
 	dataTimeStamp  time.Time
-	areas          map[string][]string
+	queryTimeout   time.Duration
+	datasets       []*dataset
+	staleThreshold time.Duration
+	uiConfig       *UIConfig
+	uiConfigMutex  sync.RWMutex
+
+	dgutaEndpointsAdded bool
+
+	readinessFile    string
+	readinessWritten bool
+
+	areasMutex          sync.RWMutex
+	areas               map[string][]string
+	areaTree            *GroupAreaTree
+	areasPath           string
+	areasWatcher        *watch.Watcher
+	areasEndpointsAdded bool
 
 	basedirsMutex   sync.RWMutex
 	basedirs        *basedirs.BaseDirReader
 	basedirsPath    string
 	ownersPath      string
+	ownerGIDs       map[string][]uint32
+	groupUsageByGID map[summary.DirGUTAge]map[uint32][]*basedirs.Usage
 	basedirsWatcher *watch.Watcher
+	ownersWatcher   *watch.Watcher
+	mountPoints     []string
+	basedirsETag    string
+	basedirsModTime time.Time
+
+	basedirsReloadMutex sync.Mutex
+	basedirsPrepared    func()
+
+	quotaOverrides   map[quotaOverrideKey]*QuotaOverride
+	overridesPath    string
+	overridesVersion int
+	overridesModTime time.Time
+
+	metrics *metrics
+
+	reloadMutex       sync.Mutex
+	lastReloadError   error
+	reloadErrors      int
+	reloadLogger      ReloadLogger
+	reloadHistory     []*ReloadEvent
+	reloadHistorySize int
+
+	insecureMutex sync.Mutex
+	insecureSrv   *http.Server
+
+	slowQueryMutex     sync.RWMutex
+	slowQueryThreshold time.Duration
+
+	topNMaxDirs int
 }
 
 // New creates a Server which can serve a REST API and website.
@@ -124,12 +233,26 @@ type Server struct {
 // log/syslog pkg with syslog.new(syslog.LOG_INFO, "tag").
 func New(logWriter io.Writer) *Server {
 	s := &Server{
-		Server:         *gas.New(logWriter),
-		uidToNameCache: make(map[uint32]string),
-		gidToNameCache: make(map[uint32]string),
-		userToGIDs:     make(map[string][]string),
+		Server:            *gas.New(logWriter),
+		uidToNameCache:    make(map[uint32]string),
+		gidToNameCache:    make(map[uint32]string),
+		userToGIDs:        make(map[string][]string),
+		queryTimeout:      DefaultQueryTimeout,
+		staleThreshold:    DefaultStaleThreshold,
+		metrics:           newMetrics(),
+		reloadLogger:      newDefaultReloadLogger(),
+		reloadHistorySize: DefaultReloadHistorySize,
+
+		slowQueryThreshold: DefaultSlowQueryThreshold,
+
+		topNMaxDirs: DefaultTopNMaxDirs,
 	}
 
+	s.useRequestIDs()
+	s.Router().Use(proxiedSecurityHeaders())
+	s.Router().Use(s.metrics.middleware, s.logQueries)
+	s.Router().GET(EndPointHealth, s.getHealth)
+	s.Router().GET(EndPointMetrics, s.getMetrics)
 	s.SetStopCallBack(s.stop)
 
 	return s
@@ -151,6 +274,16 @@ func (s *Server) stop() {
 		s.basedirsWatcher = nil
 	}
 
+	if s.ownersWatcher != nil {
+		s.ownersWatcher.Stop()
+		s.ownersWatcher = nil
+	}
+
+	if s.areasWatcher != nil {
+		s.areasWatcher.Stop()
+		s.areasWatcher = nil
+	}
+
 	if s.tree != nil {
 		s.tree.Close()
 		s.tree = nil
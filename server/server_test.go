@@ -26,18 +26,29 @@
 package server
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"os/exec"
 	"os/user"
 	"path/filepath"
+	"reflect"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -52,6 +63,7 @@ import (
 	"github.com/wtsi-ssg/wrstat/v5/basedirs"
 	"github.com/wtsi-ssg/wrstat/v5/dguta"
 	"github.com/wtsi-ssg/wrstat/v5/summary"
+	bolt "go.etcd.io/bbolt"
 )
 
 func TestIDsToWanted(t *testing.T) {
@@ -61,6 +73,1657 @@ func TestIDsToWanted(t *testing.T) {
 	})
 }
 
+func TestAcceptsGzip(t *testing.T) {
+	Convey("acceptsGzip understands Accept-Encoding headers", t, func() {
+		for header, expected := range map[string]bool{
+			"":                      false,
+			"gzip":                  true,
+			"GZIP":                  true,
+			"deflate, gzip;q=0.5":   true,
+			"gzip;q=0":              false,
+			"gzip; q=0.0, deflate":  false,
+			"gzip;q=foo":            false,
+			"*":                     true,
+			"*;q=0":                 false,
+			"gzip;q=0, *":           false,
+			"identity, *;q=0.1":     true,
+			"deflate, br, identity": false,
+		} {
+			So(acceptsGzip(header), ShouldEqual, expected)
+		}
+	})
+}
+
+func TestForecastMount(t *testing.T) {
+	day := 24 * time.Hour
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	linearHistory := func(days int, initial, perDay uint64) []basedirs.History {
+		history := make([]basedirs.History, days+1)
+
+		for d := range history {
+			history[d] = basedirs.History{
+				Date:      start.Add(time.Duration(d) * day),
+				UsageSize: initial + perDay*uint64(d),
+			}
+		}
+
+		return history
+	}
+
+	Convey("forecastMount fits the aggregate growth of all groups", t, func() {
+		histories := map[uint32][]basedirs.History{
+			1: linearHistory(10, 1000, 10),
+			2: linearHistory(10, 500, 5),
+			3: linearHistory(10, 100, 0),
+		}
+
+		f := forecastMount(histories, 3250, 90*day)
+		So(f.Capacity, ShouldEqual, 3250)
+		So(f.UsageSize, ShouldEqual, 1750)
+		So(f.GrowthPerDay, ShouldAlmostEqual, 15, 0.0001)
+		So(f.DateFull.Sub(start.Add(10*day)), ShouldAlmostEqual, 100*day, time.Second)
+		So(len(f.TopGrowers), ShouldEqual, 2)
+		So(f.TopGrowers[0].GID, ShouldEqual, 1)
+		So(f.TopGrowers[0].Growth, ShouldEqual, 100)
+		So(f.TopGrowers[1].GID, ShouldEqual, 2)
+		So(f.TopGrowers[1].Growth, ShouldEqual, 50)
+
+		Convey("only considering growth within the window", func() {
+			histories[1][0].UsageSize = 0
+
+			f = forecastMount(histories, 3250, 90*day)
+			So(f.GrowthPerDay, ShouldBeGreaterThan, 15)
+			So(f.TopGrowers[0].Growth, ShouldEqual, 1100)
+
+			f = forecastMount(histories, 3250, 5*day)
+			So(f.GrowthPerDay, ShouldAlmostEqual, 15, 0.0001)
+			So(f.TopGrowers[0].GID, ShouldEqual, 1)
+			So(f.TopGrowers[0].Growth, ShouldEqual, 50)
+			So(f.TopGrowers[1].Growth, ShouldEqual, 25)
+		})
+
+		Convey("with no projection for shrinking usage", func() {
+			histories[1] = linearHistory(10, 1000, 0)
+			histories[1][10].UsageSize = 0
+
+			f = forecastMount(histories, 3250, 90*day)
+			So(f.GrowthPerDay, ShouldBeLessThan, 0)
+			So(f.DateFull.IsZero(), ShouldBeTrue)
+		})
+
+		Convey("carrying forward sparse history", func() {
+			histories = map[uint32][]basedirs.History{
+				1: linearHistory(10, 1000, 10),
+				2: {{Date: start, UsageSize: 500}},
+			}
+
+			f = forecastMount(histories, 3250, 90*day)
+			So(f.UsageSize, ShouldEqual, 1600)
+			So(f.GrowthPerDay, ShouldAlmostEqual, 10, 0.0001)
+		})
+
+		Convey("with no projection without enough history", func() {
+			f = forecastMount(map[uint32][]basedirs.History{
+				1: linearHistory(0, 1000, 10),
+			}, 3250, 90*day)
+			So(f.UsageSize, ShouldEqual, 1000)
+			So(f.GrowthPerDay, ShouldEqual, 0)
+			So(f.DateFull.IsZero(), ShouldBeTrue)
+
+			f = forecastMount(nil, 3250, 90*day)
+			So(f.UsageSize, ShouldEqual, 0)
+			So(f.DateFull.IsZero(), ShouldBeTrue)
+		})
+	})
+}
+
+func TestQuotaAlert(t *testing.T) {
+	day := 24 * time.Hour
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	latest := start.Add(10 * day)
+
+	trendingHistory := func(perDay uint64) []basedirs.History {
+		history := make([]basedirs.History, 11)
+
+		for d := range history {
+			history[d] = basedirs.History{
+				Date:        start.Add(time.Duration(d) * day),
+				UsageSize:   500 + perDay*uint64(d),
+				QuotaSize:   1000,
+				UsageInodes: 10,
+				QuotaInodes: 100,
+			}
+		}
+
+		return history
+	}
+
+	Convey("quotaAlert only alerts on groups that will run out within the window", t, func() {
+		usage := func() *basedirs.Usage {
+			return &basedirs.Usage{GID: 1, UsageSize: 600, QuotaSize: 1000, UsageInodes: 10, QuotaInodes: 100}
+		}
+
+		history := trendingHistory(10)
+
+		So(quotaAlert(usage(), history, latest.Add(30*day)), ShouldBeNil)
+
+		alert := quotaAlert(usage(), history, latest.Add(60*day))
+		So(alert, ShouldNotBeNil)
+		So(alert.OverQuota, ShouldBeFalse)
+		So(alert.DateNoSpace.Sub(latest), ShouldAlmostEqual, 40*day, time.Second)
+		So(alert.DateNoFiles.IsZero(), ShouldBeTrue)
+		So(soonestQuotaDate(alert), ShouldEqual, alert.DateNoSpace)
+
+		So(quotaAlert(usage(), trendingHistory(0), latest.Add(3650*day)), ShouldBeNil)
+		So(quotaAlert(usage(), nil, latest.Add(3650*day)), ShouldBeNil)
+
+		Convey("or that are already over quota", func() {
+			u := usage()
+			u.UsageInodes = 100
+
+			alert = quotaAlert(u, trendingHistory(0), latest)
+			So(alert, ShouldNotBeNil)
+			So(alert.OverQuota, ShouldBeTrue)
+
+			u = usage()
+			u.UsageSize = 1000
+
+			alert = quotaAlert(u, nil, latest)
+			So(alert, ShouldNotBeNil)
+			So(alert.OverQuota, ShouldBeTrue)
+		})
+
+		Convey("using the usage's quota, which may be overridden, instead of the history's", func() {
+			u := usage()
+			u.QuotaSize = 800
+
+			alert = quotaAlert(u, history, latest.Add(30*day))
+			So(alert, ShouldNotBeNil)
+			So(alert.OverQuota, ShouldBeFalse)
+			So(alert.DateNoSpace.Sub(latest), ShouldAlmostEqual, 20*day, time.Second)
+			So(history[len(history)-1].QuotaSize, ShouldEqual, 1000)
+
+			u = usage()
+			u.QuotaSize = 5000
+
+			So(quotaAlert(u, history, latest.Add(60*day)), ShouldBeNil)
+
+			u.UsageSize = 5000
+
+			alert = quotaAlert(u, history, latest.Add(60*day))
+			So(alert, ShouldNotBeNil)
+			So(alert.OverQuota, ShouldBeTrue)
+		})
+	})
+}
+
+func TestRetentionPreview(t *testing.T) {
+	Convey("RetentionPreview lists each group's directories whose files are all old", t, func() {
+		now := int(time.Now().Unix())
+		old := int(time.Now().AddDate(-2, 0, 0).Unix())
+
+		files := []internaldata.TestFile{
+			{Path: "/m/old/x/file.bam", NumFiles: 2, SizeOfEachFile: 10, GID: 1, UID: 1, ATime: old, MTime: old},
+			{Path: "/m/mixed/old/file.bam", NumFiles: 1, SizeOfEachFile: 5, GID: 1, UID: 1, ATime: old, MTime: old},
+			{Path: "/m/mixed/new/file.bam", NumFiles: 1, SizeOfEachFile: 7, GID: 1, UID: 1, ATime: now, MTime: now},
+			{Path: "/m/mixed/new/other.bam", NumFiles: 3, SizeOfEachFile: 1, GID: 2, UID: 1, ATime: now, MTime: now},
+		}
+
+		tree, _, err := internaldb.CreateDGUTADBFromFakeFiles(t, files)
+		So(err, ShouldBeNil)
+
+		defer tree.Close()
+
+		previews, err := RetentionPreview(tree, "/m", summary.DGUTAgeM6M)
+		So(err, ShouldBeNil)
+		So(len(previews), ShouldEqual, 1)
+		So(previews[0].GID, ShouldEqual, 1)
+		So(previews[0].Group, ShouldNotBeBlank)
+		So(previews[0].Size, ShouldEqual, 25)
+		So(previews[0].Count, ShouldEqual, 3)
+		So(previews[0].Dirs, ShouldResemble, []*RetentionDir{
+			{Dir: "/m/old", Size: 20, Count: 2},
+			{Dir: "/m/mixed/old", Size: 5, Count: 1},
+		})
+
+		previews, err = RetentionPreview(tree, "/m/mixed/new", summary.DGUTAgeM6M)
+		So(err, ShouldBeNil)
+		So(previews, ShouldBeEmpty)
+
+		previews, err = RetentionPreview(tree, "/m", summary.DGUTAgeM7Y)
+		So(err, ShouldBeNil)
+		So(previews, ShouldBeEmpty)
+	})
+}
+
+func TestExportUsage(t *testing.T) {
+	Convey("ExportUsage round-trips usage records", t, func() {
+		mtime := time.Date(2024, 2, 3, 4, 5, 6, 0, time.UTC)
+
+		groups := []*basedirs.Usage{
+			{
+				GID: 1, UIDs: []uint32{10, 11}, Name: "a", Owner: "o", BaseDir: "/m/a",
+				UsageSize: 100, QuotaSize: 200, UsageInodes: 3, QuotaInodes: 40,
+				Mtime: mtime, DateNoSpace: mtime.Add(time.Hour), Age: summary.DGUTAgeA1Y,
+			},
+		}
+		users := []*basedirs.Usage{
+			{UID: 10, GIDs: []uint32{1}, Name: "u", BaseDir: "/m/a", UsageSize: 60, UsageInodes: 2, Mtime: mtime},
+		}
+
+		var buf bytes.Buffer
+
+		err := ExportUsage(&buf, ExportFormatJSON, groups, users)
+		So(err, ShouldBeNil)
+
+		dec := json.NewDecoder(&buf)
+
+		var got []*ExportedUsage
+
+		for dec.More() {
+			eu := &ExportedUsage{}
+			So(dec.Decode(eu), ShouldBeNil)
+
+			got = append(got, eu)
+		}
+
+		So(got, ShouldResemble, []*ExportedUsage{
+			{Kind: ExportKindGroup, Usage: groups[0]},
+			{Kind: ExportKindUser, Usage: users[0]},
+		})
+
+		buf.Reset()
+
+		err = ExportUsage(&buf, ExportFormatCSV, groups, users)
+		So(err, ShouldBeNil)
+
+		records, err := csv.NewReader(&buf).ReadAll()
+		So(err, ShouldBeNil)
+		So(records, ShouldResemble, [][]string{
+			exportCSVHeader,
+			{
+				"group", "1", "0", "", "10;11", "a", "o", "/m/a", "100", "200", "3", "40",
+				"2024-02-03T04:05:06Z", "2024-02-03T05:05:06Z", "0001-01-01T00:00:00Z", "4",
+			},
+			{
+				"user", "0", "10", "1", "", "u", "", "/m/a", "60", "0", "2", "0",
+				"2024-02-03T04:05:06Z", "0001-01-01T00:00:00Z", "0001-01-01T00:00:00Z", "0",
+			},
+		})
+
+		So(ExportUsage(&buf, "parquet", groups, users), ShouldEqual, ErrUnknownExportFormat)
+	})
+}
+
+func TestWhereSplitsContract(t *testing.T) {
+	Convey("Where results follow the documented splits contract", t, func() {
+		files := []internaldata.TestFile{
+			{Path: "/c/1/2/3/a.bam", NumFiles: 1, SizeOfEachFile: 1, GID: 1, UID: 1, ATime: 1, MTime: 1},
+			{Path: "/e/x/a.bam", NumFiles: 1, SizeOfEachFile: 2, GID: 1, UID: 1, ATime: 1, MTime: 1},
+			{Path: "/e/y/a.bam", NumFiles: 1, SizeOfEachFile: 3, GID: 2, UID: 1, ATime: 1, MTime: 1},
+			{Path: "/e/y/z/a.bam", NumFiles: 1, SizeOfEachFile: 4, GID: 2, UID: 1, ATime: 1, MTime: 1},
+		}
+
+		tree, _, err := internaldb.CreateDGUTADBFromFakeFiles(t, files)
+		So(err, ShouldBeNil)
+
+		defer tree.Close()
+
+		where := func(dir string, filter *dguta.Filter, splits int) []string {
+			dcss, errw := tree.Where(dir, filter, split.SplitsToSplitFn(splits))
+			So(errw, ShouldBeNil)
+
+			dirs := make([]string, len(dcss))
+			for i, dcs := range dcss {
+				dirs[i] = dcs.Dir
+			}
+
+			return dirs
+		}
+
+		Convey("a single chain of directories collapses to its deepest directory", func() {
+			for _, splits := range []int{0, 1, 2, 5} {
+				So(where("/c", nil, splits), ShouldResemble, []string{"/c/1/2/3"})
+			}
+		})
+
+		Convey("each split adds the children of the previous level", func() {
+			So(where("/e", nil, 0), ShouldResemble, []string{"/e"})
+			So(where("/e", nil, 1), ShouldResemble, []string{"/e", "/e/y", "/e/x"})
+			So(where("/e", nil, 2), ShouldResemble, []string{"/e", "/e/y", "/e/y/z", "/e/x"})
+			So(where("/e", nil, 3), ShouldResemble, where("/e", nil, 2))
+		})
+
+		Convey("filtering out a child collapses its parent to the remaining child", func() {
+			So(where("/e", &dguta.Filter{GIDs: []uint32{1}}, 2), ShouldResemble, []string{"/e/x"})
+			So(where("/e", &dguta.Filter{GIDs: []uint32{2}}, 1), ShouldResemble, []string{"/e/y", "/e/y/z"})
+		})
+
+		Convey("filtering out everything gives no results and no error", func() {
+			So(where("/e", &dguta.Filter{GIDs: []uint32{3}}, 2), ShouldBeEmpty)
+		})
+
+		Convey("a directory not in the database is an error", func() {
+			_, err = tree.Where("/missing", nil, split.SplitsToSplitFn(2))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestWhereCollapse(t *testing.T) {
+	Convey("Given a server with a crafted tree", t, func() {
+		files := []internaldata.TestFile{
+			{Path: "/c/1/2/3/a.bam", NumFiles: 1, SizeOfEachFile: 1, GID: 1, UID: 1, ATime: 1, MTime: 1},
+			{Path: "/e/x/a.bam", NumFiles: 1, SizeOfEachFile: 2, GID: 1, UID: 1, ATime: 1, MTime: 1},
+			{Path: "/e/y/a.bam", NumFiles: 1, SizeOfEachFile: 3, GID: 2, UID: 1, ATime: 1, MTime: 1},
+			{Path: "/e/y/z/a.bam", NumFiles: 1, SizeOfEachFile: 4, GID: 2, UID: 1, ATime: 1, MTime: 1},
+		}
+
+		tree, path, err := internaldb.CreateDGUTADBFromFakeFiles(t, files)
+		So(err, ShouldBeNil)
+
+		defer tree.Close()
+
+		s := New(io.Discard)
+
+		err = s.LoadDGUTADBs(path)
+		So(err, ShouldBeNil)
+
+		defer s.stop()
+
+		where := func(dir string, gids []uint32, splits int, collapse bool) []string {
+			dcss, errw := s.where(context.Background(), dir, &dguta.Filter{GIDs: gids}, strconv.Itoa(splits), "", collapse)
+			So(errw, ShouldBeNil)
+
+			dirs := make([]string, len(dcss))
+			for i, dcs := range dcss {
+				dirs[i] = dcs.Dir
+			}
+
+			return dirs
+		}
+
+		Convey("by default, results are the same as Tree.Where gives", func() {
+			for _, dir := range []string{"/", "/c", "/e"} {
+				for _, gids := range [][]uint32{nil, {1}, {2}, {3}} {
+					for splits := range 4 {
+						expected, errw := tree.Where(dir, &dguta.Filter{GIDs: gids}, split.SplitsToSplitFn(splits))
+						So(errw, ShouldBeNil)
+
+						dcss, errw := s.where(context.Background(), dir, &dguta.Filter{GIDs: gids}, strconv.Itoa(splits), "", true)
+						So(errw, ShouldBeNil)
+						So(dcss, ShouldResemble, expected)
+					}
+				}
+			}
+		})
+
+		Convey("without collapsing, parents are kept and results are at most splits deep", func() {
+			So(where("/c", nil, 0, false), ShouldResemble, []string{"/c"})
+			So(where("/c", nil, 2, false), ShouldResemble, []string{"/c", "/c/1", "/c/1/2"})
+			So(where("/e", nil, 1, false), ShouldResemble, []string{"/e", "/e/y", "/e/x"})
+			So(where("/e", []uint32{1}, 2, false), ShouldResemble, []string{"/e", "/e/x"})
+			So(where("/e", []uint32{2}, 1, false), ShouldResemble, []string{"/e", "/e/y"})
+			So(where("/e", []uint32{2}, 2, false), ShouldResemble, []string{"/e", "/e/y", "/e/y/z"})
+			So(where("/e", []uint32{3}, 2, false), ShouldBeEmpty)
+		})
+
+		Convey("the where endpoint takes a collapse parameter", func() {
+			response, err := queryWhere(s, "?dir=/c&splits=1&collapse=false")
+			So(err, ShouldBeNil)
+			So(response.Code, ShouldEqual, http.StatusOK)
+
+			var dss []*DirSummary
+
+			err = json.Unmarshal(response.Body.Bytes(), &dss)
+			So(err, ShouldBeNil)
+			So(len(dss), ShouldEqual, 2)
+			So(dss[0].Dir, ShouldEqual, "/c")
+			So(dss[1].Dir, ShouldEqual, "/c/1")
+
+			response, err = queryWhere(s, "?dir=/c&splits=1")
+			So(err, ShouldBeNil)
+			So(response.Code, ShouldEqual, http.StatusOK)
+
+			err = json.Unmarshal(response.Body.Bytes(), &dss)
+			So(err, ShouldBeNil)
+			So(len(dss), ShouldEqual, 1)
+			So(dss[0].Dir, ShouldEqual, "/c/1/2/3")
+
+			response, err = queryWhere(s, "?collapse=foo")
+			So(err, ShouldBeNil)
+			So(response.Code, ShouldEqual, http.StatusBadRequest)
+		})
+	})
+}
+
+func TestMountStatus(t *testing.T) {
+	Convey("The mount status endpoint reports each loaded dataset", t, func() {
+		recent := time.Now().Add(-time.Hour).Truncate(time.Second)
+		old := time.Now().Add(-100 * time.Hour).Truncate(time.Second)
+
+		tree1, path1, err := internaldb.CreateDGUTADBFromFakeFiles(t, []internaldata.TestFile{
+			{Path: "/lustre/scratch123/a/b/file.bam", NumFiles: 1, SizeOfEachFile: 1, GID: 1, UID: 1, ATime: 1, MTime: 1},
+			{Path: "/lustre/scratch123/a/c/file.bam", NumFiles: 1, SizeOfEachFile: 1, GID: 1, UID: 1, ATime: 1, MTime: 1},
+		}, recent)
+		So(err, ShouldBeNil)
+		tree1.Close()
+
+		tree2, path2, err := internaldb.CreateDGUTADBFromFakeFiles(t, []internaldata.TestFile{
+			{Path: "/lustre/scratch125/d/file.bam", NumFiles: 1, SizeOfEachFile: 1, GID: 1, UID: 1, ATime: 1, MTime: 1},
+			{Path: "/lustre/scratch125/e/file.bam", NumFiles: 1, SizeOfEachFile: 1, GID: 1, UID: 1, ATime: 1, MTime: 1},
+		}, old)
+		So(err, ShouldBeNil)
+		tree2.Close()
+
+		s := New(gas.NewStringLogger())
+		s.SetStaleThreshold(48 * time.Hour)
+
+		err = s.LoadDGUTADBs(path1, path2)
+		So(err, ShouldBeNil)
+
+		defer s.stop()
+
+		response, err := query(s, EndPointMounts, "")
+		So(err, ShouldBeNil)
+		So(response.Code, ShouldEqual, http.StatusOK)
+
+		var statuses []*MountStatus
+		err = json.NewDecoder(response.Body).Decode(&statuses)
+		So(err, ShouldBeNil)
+		So(len(statuses), ShouldEqual, 2)
+
+		So(statuses[0].Key, ShouldEqual, "0")
+		So(statuses[0].Mount, ShouldEqual, "/lustre/scratch123/a")
+		So(statuses[0].Timestamp, ShouldEqual, recent.Unix())
+		So(statuses[0].AgeHours, ShouldAlmostEqual, 1, 0.1)
+		So(statuses[0].Stale, ShouldBeFalse)
+
+		So(statuses[1].Mount, ShouldEqual, "/lustre/scratch125")
+		So(statuses[1].Timestamp, ShouldEqual, old.Unix())
+		So(statuses[1].AgeHours, ShouldAlmostEqual, 100, 0.1)
+		So(statuses[1].Stale, ShouldBeTrue)
+	})
+}
+
+func TestMountPointsOf(t *testing.T) {
+	Convey("Given /proc/self/mounts content", t, func() {
+		content := `proc /proc proc rw,nosuid,nodev,noexec,relatime 0 0
+tmpfs /tmp tmpfs rw,nosuid,nodev 0 0
+10.0.0.1@tcp:/scratch123 /lustre/scratch123 lustre rw,flock 0 0
+10.0.0.1@tcp:/scratch123/sub /lustre/scratch123/sub lustre rw,flock 0 0
+10.0.0.2@tcp:/scratch125 /lustre/scratch125/ lustre rw,flock 0 0
+10.0.0.2@tcp:/scratch125 /lustre/scratch125 lustre rw,flock 0 0
+nfs.example.com:/share /nfs/my\040share nfs4 rw,relatime 0 0
+bad
+`
+
+		Convey("You can get the mount points of the wanted file system types, longest first", func() {
+			mps, err := mountPointsOf(strings.NewReader(content), DefaultMountFSTypes)
+			So(err, ShouldBeNil)
+			So(mps, ShouldResemble, []string{
+				"/lustre/scratch123/sub/",
+				"/lustre/scratch123/",
+				"/lustre/scratch125/",
+				"/nfs/my share/",
+			})
+
+			So(longestPrefix(mps, "/lustre/scratch123/humgen/projects/a"), ShouldEqual, "/lustre/scratch123/")
+			So(longestPrefix(mps, "/lustre/scratch123/sub/teams/b"), ShouldEqual, "/lustre/scratch123/sub/")
+			So(longestPrefix(mps, "/nfs/my share/c"), ShouldEqual, "/nfs/my share/")
+			So(longestPrefix(mps, "/tmp/d"), ShouldBeBlank)
+
+			mps, err = mountPointsOf(strings.NewReader(content), []string{"tmpfs"})
+			So(err, ShouldBeNil)
+			So(mps, ShouldResemble, []string{"/tmp/"})
+		})
+
+		Convey("No wanted file system types gives no mount points", func() {
+			mps, err := mountPointsOf(strings.NewReader(content), nil)
+			So(err, ShouldBeNil)
+			So(mps, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestWhereFilterValidation(t *testing.T) {
+	Convey("validateFilter rejects unknown ages and file types", t, func() {
+		So(validateFilter(&dguta.Filter{}), ShouldBeNil)
+		So(validateFilter(&dguta.Filter{Age: summary.DGUTAgeM7Y}), ShouldBeNil)
+		So(validateFilter(&dguta.Filter{
+			FTs: []summary.DirGUTAFileType{summary.DGUTAFileTypeTemp, summary.DGUTAFileTypeDir},
+		}), ShouldBeNil)
+
+		err := validateFilter(&dguta.Filter{Age: summary.DGUTAgeM7Y + 1})
+		So(errors.Is(err, summary.ErrInvalidAge), ShouldBeTrue)
+		So(err.Error(), ShouldEqual, "not a valid age: 17 (must be 0 to 16)")
+
+		err = validateFilter(&dguta.Filter{FTs: []summary.DirGUTAFileType{summary.DGUTAFileTypeBam, 99}})
+		So(errors.Is(err, summary.ErrInvalidType), ShouldBeTrue)
+		So(err.Error(), ShouldEqual, "not a valid file type: 99")
+	})
+
+	Convey("The where endpoint explains bad filter parameters", t, func() {
+		tree, path, err := internaldb.CreateDGUTADBFromFakeFiles(t, []internaldata.TestFile{
+			{Path: "/a/b/file.bam", NumFiles: 1, SizeOfEachFile: 1, GID: 1, UID: 1, ATime: 1, MTime: 1},
+		})
+		So(err, ShouldBeNil)
+		tree.Close()
+
+		s := New(gas.NewStringLogger())
+
+		err = s.LoadDGUTADBs(path)
+		So(err, ShouldBeNil)
+
+		defer s.stop()
+
+		for _, test := range []struct {
+			extra    string
+			expected string
+		}{
+			{"?age=99", "not a valid age: 99 (must be 0 to 16)"},
+			{"?age=foo", "not a valid age: foo (must be 0 to 16)"},
+			{"?types=bam,foo", "not a valid file type: foo"},
+			{"?groups=!nosuchgroup", "group: unknown group !nosuchgroup"},
+			{"?users=!nosuchuser", "user: unknown user !nosuchuser"},
+			{"?atimeBefore=foo", string(ErrBadAgeCutoff)},
+			{"?atimeBefore=2020-01-01T00:00:00Z&mtimeBefore=2020-01-01T00:00:00Z", string(ErrBadAgeCutoff)},
+			{"?age=1&mtimeBefore=2020-01-01T00:00:00Z", string(ErrBadAgeCutoff)},
+			{"?atimeBefore=1900-01-01T00:00:00Z", string(ErrBadAgeCutoff)},
+		} {
+			response, errq := queryWhere(s, test.extra)
+			So(errq, ShouldBeNil)
+			So(response.Code, ShouldEqual, http.StatusBadRequest)
+
+			var body map[string]string
+
+			errq = json.NewDecoder(response.Body).Decode(&body)
+			So(errq, ShouldBeNil)
+			So(body["error"], ShouldEqual, test.expected)
+		}
+
+		response, err := queryWhere(s, "?age=16&types=bam")
+		So(err, ShouldBeNil)
+		So(response.Code, ShouldEqual, http.StatusOK)
+		So(response.Header().Get(AppliedAgeHeader), ShouldBeBlank)
+
+		ninetyDaysAgo := time.Now().Add(-90 * 24 * time.Hour).Format(time.RFC3339)
+
+		response, err = queryWhere(s, "?types=bam&atimeBefore="+url.QueryEscape(ninetyDaysAgo))
+		So(err, ShouldBeNil)
+		So(response.Code, ShouldEqual, http.StatusOK)
+		So(response.Header().Get(AppliedAgeHeader), ShouldEqual, strconv.Itoa(int(summary.DGUTAgeA6M)))
+	})
+}
+
+func TestAgeBucketFor(t *testing.T) {
+	Convey("Age cutoffs map to the youngest bucket at least as old as them", t, func() {
+		refTime := time.Unix(summary.SecondsInAYear*10, 0)
+		before := func(secs int64) time.Time {
+			return refTime.Add(-time.Duration(secs) * time.Second)
+		}
+
+		month, year := int64(summary.SecondsInAMonth), int64(summary.SecondsInAYear)
+
+		for _, test := range []struct {
+			cutoff time.Time
+			atime  summary.DirGUTAge
+			mtime  summary.DirGUTAge
+		}{
+			{refTime.Add(time.Hour), summary.DGUTAgeAll, summary.DGUTAgeAll},
+			{refTime, summary.DGUTAgeAll, summary.DGUTAgeAll},
+			{before(1), summary.DGUTAgeA1M, summary.DGUTAgeM1M},
+			{before(month), summary.DGUTAgeA1M, summary.DGUTAgeM1M},
+			{before(month + 1), summary.DGUTAgeA2M, summary.DGUTAgeM2M},
+			{before(month * 2), summary.DGUTAgeA2M, summary.DGUTAgeM2M},
+			{before(month*2 + 1), summary.DGUTAgeA6M, summary.DGUTAgeM6M},
+			{before(month * 6), summary.DGUTAgeA6M, summary.DGUTAgeM6M},
+			{before(month*6 + 1), summary.DGUTAgeA1Y, summary.DGUTAgeM1Y},
+			{before(year), summary.DGUTAgeA1Y, summary.DGUTAgeM1Y},
+			{before(year + 1), summary.DGUTAgeA2Y, summary.DGUTAgeM2Y},
+			{before(year * 2), summary.DGUTAgeA2Y, summary.DGUTAgeM2Y},
+			{before(year*2 + 1), summary.DGUTAgeA3Y, summary.DGUTAgeM3Y},
+			{before(year * 3), summary.DGUTAgeA3Y, summary.DGUTAgeM3Y},
+			{before(year*3 + 1), summary.DGUTAgeA5Y, summary.DGUTAgeM5Y},
+			{before(year * 5), summary.DGUTAgeA5Y, summary.DGUTAgeM5Y},
+			{before(year*5 + 1), summary.DGUTAgeA7Y, summary.DGUTAgeM7Y},
+			{before(year * 7), summary.DGUTAgeA7Y, summary.DGUTAgeM7Y},
+		} {
+			age, err := ageBucketFor(test.cutoff, refTime, false)
+			So(err, ShouldBeNil)
+			So(age, ShouldEqual, test.atime)
+
+			age, err = ageBucketFor(test.cutoff, refTime, true)
+			So(err, ShouldBeNil)
+			So(age, ShouldEqual, test.mtime)
+		}
+
+		_, err := ageBucketFor(before(year*7+1), refTime, false)
+		So(err, ShouldEqual, ErrBadAgeCutoff)
+
+		_, err = ageBucketFor(before(year*7+1), refTime, true)
+		So(err, ShouldEqual, ErrBadAgeCutoff)
+	})
+}
+
+func TestCompactDB(t *testing.T) {
+	Convey("Given a bolt database that has had keys deleted", t, func() {
+		dir := t.TempDir()
+		srcPath := filepath.Join(dir, "src.db")
+
+		db, err := bolt.Open(srcPath, 0600, nil)
+		So(err, ShouldBeNil)
+
+		value := bytes.Repeat([]byte("v"), 1024)
+
+		err = db.Update(func(tx *bolt.Tx) error {
+			for _, name := range []string{"a", "b"} {
+				b, errc := tx.CreateBucket([]byte(name))
+				if errc != nil {
+					return errc
+				}
+
+				for i := range 1000 {
+					if errc = b.Put([]byte(fmt.Sprintf("%s%04d", name, i)), value); errc != nil {
+						return errc
+					}
+				}
+			}
+
+			return nil
+		})
+		So(err, ShouldBeNil)
+
+		err = db.Update(func(tx *bolt.Tx) error {
+			b := tx.Bucket([]byte("a"))
+
+			for i := range 900 {
+				if errd := b.Delete([]byte(fmt.Sprintf("a%04d", i))); errd != nil {
+					return errd
+				}
+			}
+
+			return nil
+		})
+		So(err, ShouldBeNil)
+		So(db.Close(), ShouldBeNil)
+
+		Convey("You can compact it to a smaller file with the same contents", func() {
+			dstPath := filepath.Join(dir, "dst.db")
+
+			err = CompactDB(srcPath, dstPath)
+			So(err, ShouldBeNil)
+
+			srcInfo, err := os.Stat(srcPath)
+			So(err, ShouldBeNil)
+
+			dstInfo, err := os.Stat(dstPath)
+			So(err, ShouldBeNil)
+			So(dstInfo.Size(), ShouldBeLessThan, srcInfo.Size())
+
+			So(boltContents(t, dstPath), ShouldResemble, boltContents(t, srcPath))
+
+			err = CompactDB(srcPath, dstPath)
+			So(err, ShouldEqual, ErrCompactDstExist)
+		})
+
+		Convey("Compacting a non-existent database fails without leaving a file", func() {
+			dstPath := filepath.Join(dir, "dst.db")
+
+			err = CompactDB(filepath.Join(dir, "missing.db"), dstPath)
+			So(err, ShouldNotBeNil)
+
+			_, err = os.Stat(dstPath)
+			So(errors.Is(err, os.ErrNotExist), ShouldBeTrue)
+		})
+	})
+}
+
+// boltContents returns all the keys and values of all the top level buckets in
+// the given bolt database.
+func boltContents(t *testing.T, path string) map[string]map[string]string {
+	t.Helper()
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	contents := make(map[string]map[string]string)
+
+	err = db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			kvs := make(map[string]string)
+			contents[string(name)] = kvs
+
+			return b.ForEach(func(k, v []byte) error {
+				kvs[string(k)] = string(v)
+
+				return nil
+			})
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return contents
+}
+
+func TestConcurrentDgutaLoading(t *testing.T) {
+	Convey("Given several dguta db dirs", t, func() {
+		paths := createExampleDgutaDirs(t, 6)
+		s := New(gas.NewStringLogger())
+
+		Convey("Examining them concurrently gives the same results as sequentially", func() {
+			sequential, err := s.datasetsOf(paths, 1)
+			So(err, ShouldBeNil)
+			So(len(sequential), ShouldEqual, len(paths))
+
+			concurrent, err := s.datasetsOf(paths, len(paths))
+			So(err, ShouldBeNil)
+			So(concurrent, ShouldResemble, sequential)
+
+			for i, ds := range concurrent {
+				So(ds.mount, ShouldEqual, fmt.Sprintf("/lustre/scratch%d/dir", i))
+			}
+
+			err = s.LoadDGUTADBs(paths...)
+			So(err, ShouldBeNil)
+
+			defer s.stop()
+
+			So(s.datasets, ShouldResemble, sequential)
+
+			tree, err := dguta.NewTree(paths...)
+			So(err, ShouldBeNil)
+
+			defer tree.Close()
+
+			expected, err := tree.Where("/", nil, split.SplitsToSplitFn(2))
+			So(err, ShouldBeNil)
+
+			dcss, err := s.tree.Where("/", nil, split.SplitsToSplitFn(2))
+			So(err, ShouldBeNil)
+			So(dcss, ShouldResemble, expected)
+		})
+
+		Convey("A load with bad paths reports them all and keeps the previous data", func() {
+			err := s.LoadDGUTADBs(paths[:1]...)
+			So(err, ShouldBeNil)
+
+			defer s.stop()
+
+			err = s.LoadDGUTADBs(paths[1], "/foo", "/bar")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "/foo")
+			So(err.Error(), ShouldContainSubstring, "/bar")
+
+			So(s.dgutaPaths, ShouldResemble, paths[:1])
+			So(len(s.datasets), ShouldEqual, 1)
+			So(s.datasets[0].mount, ShouldEqual, "/lustre/scratch0/dir")
+		})
+	})
+}
+
+func BenchmarkOpenDgutaDBs(b *testing.B) {
+	paths := createExampleDgutaDirs(b, 12)
+	s := New(gas.NewStringLogger())
+
+	for _, workers := range []int{1, maxLoadWorkers} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for range b.N {
+				tree, _, err := s.openDgutaDBs(paths, workers)
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				tree.Close()
+			}
+		})
+	}
+}
+
+// createExampleDgutaDirs creates n dguta db dirs, each with data nested under
+// a different mount.
+func createExampleDgutaDirs(tb testing.TB, n int) []string {
+	tb.Helper()
+
+	paths := make([]string, n)
+
+	for i := range paths {
+		dir := fmt.Sprintf("/lustre/scratch%d/dir", i)
+
+		tree, path, err := internaldb.CreateDGUTADBFromFakeFiles(tb, []internaldata.TestFile{
+			{Path: dir + "/a/file.bam", NumFiles: 1, SizeOfEachFile: 10, GID: 1, UID: 1, ATime: 1, MTime: 1},
+			{Path: dir + "/b/file.cram", NumFiles: 2, SizeOfEachFile: 20, GID: 2, UID: 2, ATime: 1, MTime: 1},
+		})
+		if err != nil {
+			tb.Fatal(err)
+		}
+
+		tree.Close()
+
+		paths[i] = path
+	}
+
+	return paths
+}
+
+type collectingReloadLogger struct {
+	sync.Mutex
+	events []*ReloadEvent
+}
+
+func (l *collectingReloadLogger) LogReload(event *ReloadEvent) {
+	l.Lock()
+	defer l.Unlock()
+
+	l.events = append(l.events, event)
+}
+
+func TestReloadEvents(t *testing.T) {
+	Convey("Given a server with a ReloadLogger", t, func() {
+		path := createExampleDgutaDirs(t, 1)[0]
+		dir := filepath.Dir(filepath.Dir(path))
+
+		s := New(gas.NewStringLogger())
+		logger := &collectingReloadLogger{}
+		s.SetReloadLogger(logger)
+
+		err := s.LoadDGUTADBs(path)
+		So(err, ShouldBeNil)
+
+		defer s.stop()
+
+		Convey("Reloads are logged with their timing and record counts", func() {
+			s.reloadDGUTADBs(dir, internaldb.ExampleDgutaDirParentSuffix, time.Now())
+			s.reloadDGUTADBs("/nonexistent", internaldb.ExampleDgutaDirParentSuffix, time.Now())
+
+			So(len(logger.events), ShouldEqual, 2)
+
+			ok := logger.events[0]
+			So(ok.Key, ShouldEqual, "dguta dbs")
+			So(ok.RecordCount, ShouldEqual, 1)
+			So(ok.Error, ShouldBeBlank)
+			So(ok.FinishedAt, ShouldHappenOnOrAfter, ok.StartedAt)
+
+			failed := logger.events[1]
+			So(failed.Key, ShouldEqual, "dguta dbs")
+			So(failed.RecordCount, ShouldEqual, 0)
+			So(failed.Error, ShouldContainSubstring, "no such file or directory")
+
+			So(s.reloadHistory, ShouldResemble, logger.events)
+
+			Convey("and only the most recent are remembered", func() {
+				s.SetReloadHistorySize(1)
+				So(s.reloadHistory, ShouldResemble, logger.events[1:])
+
+				s.reloadDGUTADBs("/nonexistent", internaldb.ExampleDgutaDirParentSuffix, time.Now())
+				So(len(logger.events), ShouldEqual, 3)
+				So(s.reloadHistory, ShouldResemble, logger.events[2:])
+			})
+		})
+
+		Convey("A JSONReloadLogger writes a line of JSON per event", func() {
+			var buf bytes.Buffer
+
+			s.SetReloadLogger(JSONReloadLogger{Writer: &buf})
+			s.reloadDGUTADBs("/nonexistent", internaldb.ExampleDgutaDirParentSuffix, time.Now())
+
+			var event ReloadEvent
+
+			err := json.Unmarshal(buf.Bytes(), &event)
+			So(err, ShouldBeNil)
+			So(event.Key, ShouldEqual, "dguta dbs")
+			So(event.Error, ShouldNotBeBlank)
+		})
+	})
+}
+
+func TestGroupAreasFile(t *testing.T) {
+	Convey("Given a group,area csv file", t, func() {
+		path := filepath.Join(t.TempDir(), "areas.csv")
+
+		err := os.WriteFile(path, []byte("1,a\n2,a\n3,b\n"), 0600)
+		So(err, ShouldBeNil)
+
+		s := New(gas.NewStringLogger())
+
+		defer s.stop()
+
+		Convey("You can load areas from it", func() {
+			err = s.LoadGroupAreasFile(path)
+			So(err, ShouldBeNil)
+			So(s.groupAreas(), ShouldResemble, map[string][]string{
+				"a": {"1", "2"},
+				"b": {"3"},
+			})
+
+			Convey("and changes are picked up after WatchGroupAreasFile()", func() {
+				err = s.WatchGroupAreasFile(path, 10*time.Millisecond)
+				So(err, ShouldBeNil)
+
+				expected := map[string][]string{"c": {"4"}}
+
+				err = writeGroupAreas(path, expected)
+				So(err, ShouldBeNil)
+
+				later := time.Now().Add(time.Minute)
+				err = os.Chtimes(path, later, later)
+				So(err, ShouldBeNil)
+
+				So(waitForGroupAreas(s, expected), ShouldBeTrue)
+
+				Convey("though bad changes are ignored", func() {
+					err = writeFileAtomically(path, []byte(",d\n"))
+					So(err, ShouldBeNil)
+
+					later = later.Add(time.Minute)
+					err = os.Chtimes(path, later, later)
+					So(err, ShouldBeNil)
+
+					<-time.After(100 * time.Millisecond)
+					So(s.groupAreas(), ShouldResemble, expected)
+				})
+			})
+		})
+
+		Convey("Writing areas keeps the file's permissions and leaves no temporary files", func() {
+			err = os.Chmod(path, 0640)
+			So(err, ShouldBeNil)
+
+			expected := map[string][]string{"c": {"4"}}
+
+			err = writeGroupAreas(path, expected)
+			So(err, ShouldBeNil)
+
+			info, err := os.Stat(path)
+			So(err, ShouldBeNil)
+			So(info.Mode().Perm(), ShouldEqual, os.FileMode(0640))
+
+			entries, err := os.ReadDir(filepath.Dir(path))
+			So(err, ShouldBeNil)
+			So(len(entries), ShouldEqual, 1)
+
+			err = s.LoadGroupAreasFile(path)
+			So(err, ShouldBeNil)
+			So(s.groupAreas(), ShouldResemble, expected)
+
+			newPath := filepath.Join(filepath.Dir(path), "new.csv")
+
+			err = writeFileAtomically(newPath, []byte("1,a\n"))
+			So(err, ShouldBeNil)
+
+			info, err = os.Stat(newPath)
+			So(err, ShouldBeNil)
+			So(info.Mode().Perm(), ShouldEqual, os.FileMode(areasFilePerms))
+		})
+
+		Convey("Loading fails on malformed files", func() {
+			err = os.WriteFile(path, []byte("1,a,extra\n"), 0600)
+			So(err, ShouldBeNil)
+
+			err = s.LoadGroupAreasFile(path)
+			So(err, ShouldNotBeNil)
+
+			err = os.WriteFile(path, []byte("1,\n"), 0600)
+			So(err, ShouldBeNil)
+
+			err = s.LoadGroupAreasFile(path)
+			So(err, ShouldEqual, ErrBadGroupAreas)
+			So(s.groupAreas(), ShouldBeNil)
+		})
+	})
+}
+
+func TestGroupAreaTree(t *testing.T) {
+	Convey("Given a nested GroupAreaTree", t, func() {
+		tree := &GroupAreaTree{
+			Children: []*GroupAreaTree{
+				{
+					Name:   "science",
+					Groups: []string{"1"},
+					Children: []*GroupAreaTree{
+						{Name: "genomics", Groups: []string{"2", "3"}},
+						{
+							Name:     "cells",
+							Groups:   []string{"4"},
+							Children: []*GroupAreaTree{{Name: "organoids", Groups: []string{"5", "1"}}},
+						},
+					},
+				},
+				{Name: "admin", Groups: []string{"6"}},
+			},
+		}
+
+		Convey("You can flatten it, with areas including their sub-areas' groups depth first", func() {
+			So(tree.Flatten(), ShouldResemble, map[string][]string{
+				"science":   {"1", "2", "3", "4", "5"},
+				"genomics":  {"2", "3"},
+				"cells":     {"4", "5", "1"},
+				"organoids": {"5", "1"},
+				"admin":     {"6"},
+			})
+		})
+
+		Convey("It serialises to JSON depth first", func() {
+			b, err := json.Marshal(tree)
+			So(err, ShouldBeNil)
+			So(string(b), ShouldEqual, `{"name":"","children":[`+
+				`{"name":"science","groups":["1"],"children":[`+
+				`{"name":"genomics","groups":["2","3"]},`+
+				`{"name":"cells","groups":["4"],"children":[{"name":"organoids","groups":["5","1"]}]}]},`+
+				`{"name":"admin","groups":["6"]}]}`)
+		})
+
+		Convey("Adding it to a server sets the flattened areas, until they're replaced", func() {
+			s := New(gas.NewStringLogger())
+
+			s.AddGroupAreaTree(tree)
+			So(s.groupAreas(), ShouldResemble, tree.Flatten())
+			So(s.areaTree, ShouldEqual, tree)
+
+			s.AddGroupAreas(map[string][]string{"b": {"7"}, "a": {"8"}})
+			So(s.areaTree, ShouldBeNil)
+			So(flatGroupAreaTree(s.groupAreas()), ShouldResemble, &GroupAreaTree{
+				Children: []*GroupAreaTree{
+					{Name: "a", Groups: []string{"8"}},
+					{Name: "b", Groups: []string{"7"}},
+				},
+			})
+		})
+	})
+}
+
+func TestStartInsecure(t *testing.T) {
+	Convey("Given a server with auth and a database", t, func() {
+		username, uid := gas.GetUser(t)
+
+		certPath, keyPath, err := gas.CreateTestCert(t)
+		So(err, ShouldBeNil)
+
+		s := New(gas.NewStringLogger())
+
+		err = s.EnableAuth(certPath, keyPath, func(_, _ string) (bool, string) {
+			return true, uid
+		})
+		So(err, ShouldBeNil)
+
+		err = s.LoadDGUTADBs(createExampleDgutaDirs(t, 1)[0])
+		So(err, ShouldBeNil)
+
+		err = s.AddTreePage()
+		So(err, ShouldBeNil)
+
+		l, err := net.Listen("tcp", "localhost:0")
+		So(err, ShouldBeNil)
+
+		addr := l.Addr().String()
+		err = l.Close()
+		So(err, ShouldBeNil)
+
+		errCh := make(chan error, 1)
+
+		go func() {
+			errCh <- s.StartInsecure(addr)
+		}()
+
+		defer func() {
+			s.Stop()
+			So(<-errCh, ShouldBeNil)
+		}()
+
+		<-time.After(100 * time.Millisecond)
+
+		Convey("You can log in and make authenticated queries over plain HTTP", func() {
+			resp, err := http.PostForm("http://"+addr+gas.EndPointJWT,
+				url.Values{"username": {username}, "password": {"pass"}})
+			So(err, ShouldBeNil)
+
+			defer resp.Body.Close()
+
+			So(resp.StatusCode, ShouldEqual, http.StatusOK)
+
+			var token string
+
+			err = json.NewDecoder(resp.Body).Decode(&token)
+			So(err, ShouldBeNil)
+			So(token, ShouldNotBeBlank)
+
+			req, err := http.NewRequest(http.MethodGet, "http://"+addr+EndPointAuthTree+"?path=/", nil)
+			So(err, ShouldBeNil)
+
+			resp, err = http.DefaultClient.Do(req)
+			So(err, ShouldBeNil)
+			resp.Body.Close()
+			So(resp.StatusCode, ShouldEqual, http.StatusUnauthorized)
+
+			req.Header.Set("Authorization", "Bearer "+token)
+
+			resp, err = http.DefaultClient.Do(req)
+			So(err, ShouldBeNil)
+
+			defer resp.Body.Close()
+
+			So(resp.StatusCode, ShouldEqual, http.StatusOK)
+
+			var te TreeElement
+
+			err = json.NewDecoder(resp.Body).Decode(&te)
+			So(err, ShouldBeNil)
+			So(te.Path, ShouldEqual, "/")
+			So(te.Count, ShouldBeGreaterThan, 0)
+		})
+
+		Convey("Responses get security headers, without redirecting to https", func() {
+			req, err := http.NewRequest(http.MethodGet, "http://"+addr+EndPointHealth, nil)
+			So(err, ShouldBeNil)
+
+			resp, err := http.DefaultClient.Do(req)
+			So(err, ShouldBeNil)
+			resp.Body.Close()
+			So(resp.StatusCode, ShouldEqual, http.StatusOK)
+			So(resp.Header.Get("X-Frame-Options"), ShouldEqual, "DENY")
+			So(resp.Header.Get("X-Content-Type-Options"), ShouldEqual, "nosniff")
+		})
+	})
+}
+
+func TestReadinessFile(t *testing.T) {
+	Convey("Given a server with a readiness file", t, func() {
+		logWriter := gas.NewStringLogger()
+		s := New(logWriter)
+
+		readiness := filepath.Join(t.TempDir(), "ready")
+		s.SetReadinessFile(readiness)
+
+		Convey("The file only exists between loading a database and stopping", func() {
+			_, err := os.Stat(readiness)
+			So(err, ShouldNotBeNil)
+
+			err = s.LoadDGUTADBs("/nonexistent")
+			So(err, ShouldNotBeNil)
+
+			_, err = os.Stat(readiness)
+			So(err, ShouldNotBeNil)
+
+			paths := createExampleDgutaDirs(t, 2)
+
+			err = s.LoadDGUTADBs(paths[0])
+			So(err, ShouldBeNil)
+
+			_, err = os.Stat(readiness)
+			So(err, ShouldBeNil)
+
+			l, err := net.Listen("tcp", "localhost:0")
+			So(err, ShouldBeNil)
+
+			addr := l.Addr().String()
+			err = l.Close()
+			So(err, ShouldBeNil)
+
+			errCh := make(chan error, 1)
+
+			go func() {
+				errCh <- s.StartInsecure(addr)
+			}()
+
+			<-time.After(100 * time.Millisecond)
+
+			err = s.LoadDGUTADBs(paths[1])
+			So(err, ShouldBeNil)
+
+			_, err = os.Stat(readiness)
+			So(err, ShouldBeNil)
+
+			s.Stop()
+			So(<-errCh, ShouldBeNil)
+
+			_, err = os.Stat(readiness)
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+
+		Convey("Failing to write the file is just a warning", func() {
+			s.SetReadinessFile(filepath.Join(readiness, "missing", "ready"))
+
+			err := s.LoadDGUTADBs(createExampleDgutaDirs(t, 1)[0])
+			So(err, ShouldBeNil)
+			So(logWriter.String(), ShouldContainSubstring, "WARN could not write readiness file")
+
+			s.stop()
+		})
+	})
+}
+
+func TestTopN(t *testing.T) {
+	Convey("Given a server with a database of directories of different sizes", t, func() {
+		var files []internaldata.TestFile
+
+		for i := 1; i <= 20; i++ {
+			for j := 1; j <= 5; j++ {
+				files = append(files, internaldata.TestFile{
+					Path:     fmt.Sprintf("/t/d%02d/s%d/file.bam", i, j),
+					NumFiles: 1, SizeOfEachFile: i*100 + j, GID: 1, UID: 1, ATime: 1, MTime: i,
+				})
+			}
+		}
+
+		tree, path, err := internaldb.CreateDGUTADBFromFakeFiles(t, files)
+		So(err, ShouldBeNil)
+
+		tree.Close()
+
+		s := New(io.Discard)
+
+		err = s.LoadDGUTADBs(path)
+		So(err, ShouldBeNil)
+
+		defer s.stop()
+
+		s.treeMutex.RLock()
+		defer s.treeMutex.RUnlock()
+
+		topN := func(n int, sortBy string) (dguta.DCSs, error) {
+			return s.topN(context.Background(), "/t", &dguta.Filter{FTs: summary.AllTypesExceptDirectories}, n, sortBy)
+		}
+
+		Convey("topN gives the largest directories, largest first", func() {
+			dcss, err := topN(3, SortBySize)
+			So(err, ShouldBeNil)
+			So(len(dcss), ShouldEqual, 3)
+			So(dcss[0].Dir, ShouldEqual, "/t/d20")
+			So(dcss[1].Dir, ShouldEqual, "/t/d19")
+			So(dcss[2].Dir, ShouldEqual, "/t/d18")
+
+			dcss, err = topN(6, SortByMtime)
+			So(err, ShouldBeNil)
+			So(len(dcss), ShouldEqual, 6)
+			So(dcss[0].Mtime.Unix(), ShouldEqual, 20)
+			So(dcss[5].Mtime.Unix(), ShouldEqual, 20)
+
+			dcss, err = topN(200, SortByCount)
+			So(err, ShouldBeNil)
+			So(len(dcss), ShouldEqual, 120)
+			So(dcss[0].Count, ShouldEqual, 5)
+			So(dcss[119].Count, ShouldEqual, 1)
+		})
+
+		Convey("directories that can't make the top n aren't looked in to", func() {
+			s.SetTopNMaxDirs(3)
+
+			dcss, err := topN(3, SortBySize)
+			So(err, ShouldBeNil)
+			So(len(dcss), ShouldEqual, 3)
+			So(dcss[0].Dir, ShouldEqual, "/t/d20")
+
+			_, err = topN(200, SortBySize)
+			So(err, ShouldEqual, ErrTopNTooManyDirs)
+		})
+	})
+}
+
+func TestTypeBreakdown(t *testing.T) {
+	Convey("Given a server with a database of files of several types", t, func() {
+		tree, path, err := internaldb.CreateDGUTADBFromFakeFiles(t, []internaldata.TestFile{
+			{Path: "/t/a/file.bam", NumFiles: 2, SizeOfEachFile: 10, GID: 1, UID: 1, ATime: 1, MTime: 1},
+			{Path: "/t/a/b/file.cram", NumFiles: 3, SizeOfEachFile: 20, GID: 2, UID: 1, ATime: 1, MTime: 1},
+			{Path: "/t/c/file.tmp", NumFiles: 1, SizeOfEachFile: 5, GID: 1, UID: 1, ATime: 1, MTime: 1},
+			{Path: "/t/c/file.vcf", NumFiles: 1, SizeOfEachFile: 7, GID: 2, UID: 1, ATime: 1, MTime: 1},
+		})
+		So(err, ShouldBeNil)
+
+		defer tree.Close()
+
+		s := New(io.Discard)
+
+		err = s.LoadDGUTADBs(path)
+		So(err, ShouldBeNil)
+
+		defer s.stop()
+
+		s.treeMutex.RLock()
+		defer s.treeMutex.RUnlock()
+
+		Convey("typeBreakdown gives the same usage as looking up every type", func() {
+			for _, gids := range [][]uint32{nil, {1}, {2}, {3}} {
+				expected := make(map[string]*TypeUsage)
+
+				for _, ft := range allFileTypes {
+					di, errd := tree.DirInfo("/t", &dguta.Filter{GIDs: gids, FTs: []summary.DirGUTAFileType{ft}})
+					So(errd, ShouldBeNil)
+
+					if di != nil && di.Current.Count > 0 {
+						expected[ft.String()] = &TypeUsage{Count: di.Current.Count, Size: di.Current.Size}
+					}
+				}
+
+				breakdown, err := s.typeBreakdown(context.Background(), "/t", gids)
+				So(err, ShouldBeNil)
+				So(breakdown, ShouldResemble, expected)
+			}
+
+			breakdown, err := s.typeBreakdown(context.Background(), "/t", nil)
+			So(err, ShouldBeNil)
+			So(breakdown["cram"], ShouldResemble, &TypeUsage{Count: 3, Size: 60})
+			So(breakdown["temp"], ShouldNotBeNil)
+
+			_, err = s.typeBreakdown(context.Background(), "/missing", nil)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestSlowQueries(t *testing.T) {
+	Convey("Given a server with a database of thousands of directories", t, func() {
+		var files []internaldata.TestFile
+
+		for i := range 50 {
+			for j := range 50 {
+				files = append(files, internaldata.TestFile{
+					Path:     fmt.Sprintf("/slow/%d/%d/file.bam", i, j),
+					NumFiles: 1, SizeOfEachFile: 10, GID: 1, UID: 1, ATime: 1, MTime: 1,
+				})
+			}
+		}
+
+		tree, path, err := internaldb.CreateDGUTADBFromFakeFiles(t, files)
+		So(err, ShouldBeNil)
+
+		tree.Close()
+
+		s := New(io.Discard)
+
+		err = s.LoadDGUTADBs(path)
+		So(err, ShouldBeNil)
+
+		defer s.stop()
+
+		Convey("A where query that times out doesn't block other readers of the tree", func() {
+			s.SetQueryTimeout(time.Millisecond)
+
+			response, err := queryWhere(s, "?splits=100")
+			So(err, ShouldBeNil)
+			So(response.Code, ShouldEqual, http.StatusGatewayTimeout)
+
+			So(s.treeMutex.TryRLock(), ShouldBeTrue)
+			s.treeMutex.RUnlock()
+
+			response, err = query(s, EndPointHealth, "")
+			So(err, ShouldBeNil)
+			So(response.Code, ShouldEqual, http.StatusOK)
+
+			s.treeMutex.Lock()
+			s.treeMutex.Unlock() //nolint:staticcheck
+		})
+
+		Convey("Queries stop with the context's error once it is done", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			s.treeMutex.RLock()
+			defer s.treeMutex.RUnlock()
+
+			for _, collapse := range []bool{true, false} {
+				_, err = s.where(ctx, "/slow", &dguta.Filter{}, "100", "", collapse)
+				So(err, ShouldEqual, context.Canceled)
+			}
+
+			_, err = s.where(ctx, "/slow", &dguta.Filter{}, "", GroupByUser, true)
+			So(err, ShouldEqual, context.Canceled)
+
+			_, err = s.ancestors(ctx, "/slow/1/1", &dguta.Filter{})
+			So(err, ShouldEqual, context.Canceled)
+
+			_, err = s.topN(ctx, "/slow", &dguta.Filter{}, 10, SortBySize)
+			So(err, ShouldEqual, context.Canceled)
+
+			_, err = s.typeBreakdown(ctx, "/slow", nil)
+			So(err, ShouldEqual, context.Canceled)
+		})
+
+		Convey("A query stops soon after it times out, releasing the tree", func() {
+			start := time.Now()
+
+			s.treeMutex.RLock()
+			_, err = s.where(context.Background(), "/", &dguta.Filter{}, "100", "", false)
+			s.treeMutex.RUnlock()
+			So(err, ShouldBeNil)
+
+			full := time.Since(start)
+
+			s.SetQueryTimeout(full / 10)
+
+			response, err := queryWhere(s, "?splits=100&collapse=false")
+			So(err, ShouldBeNil)
+			So(response.Code, ShouldEqual, http.StatusGatewayTimeout)
+
+			start = time.Now()
+
+			s.treeMutex.Lock()
+			s.treeMutex.Unlock() //nolint:staticcheck
+
+			So(time.Since(start), ShouldBeLessThan, full/2)
+		})
+	})
+}
+
+func TestQueryLogging(t *testing.T) {
+	Convey("Given a server with a database", t, func() {
+		logWriter := gas.NewStringLogger()
+		s := New(logWriter)
+
+		err := s.LoadDGUTADBs(createExampleDgutaDirs(t, 1)[0])
+		So(err, ShouldBeNil)
+
+		defer s.stop()
+
+		const secret = "secret.jwt.value"
+
+		queryWhere := func() {
+			req, errr := http.NewRequest(http.MethodGet, EndPointWhere+"?splits=0&dir=/lustre", nil)
+			So(errr, ShouldBeNil)
+
+			req.Header.Set("Authorization", "Bearer "+secret)
+			req.AddCookie(&http.Cookie{Name: "jwt", Value: secret})
+
+			response := httptest.NewRecorder()
+			s.Router().ServeHTTP(response, req)
+			So(response.Code, ShouldEqual, http.StatusOK)
+		}
+
+		Convey("Fast where queries are logged at INFO with their parameters and row count", func() {
+			s.SetSlowQueryThreshold(time.Hour)
+			logWriter.Reset()
+
+			queryWhere()
+
+			log := logWriter.String()
+			So(log, ShouldContainSubstring, "INFO query ID=")
+			So(log, ShouldContainSubstring, "USER=- ENDPOINT="+EndPointWhere)
+			So(log, ShouldContainSubstring, `PARAMS="dir=%2Flustre&splits=0"`)
+			So(log, ShouldContainSubstring, "STATUS=200 ROWS=1 DURATION=")
+			So(log, ShouldNotContainSubstring, "WARN query")
+			So(log, ShouldNotContainSubstring, secret)
+		})
+
+		Convey("Slow where queries are logged at WARN", func() {
+			s.SetSlowQueryThreshold(time.Nanosecond)
+			logWriter.Reset()
+
+			queryWhere()
+
+			log := logWriter.String()
+			So(log, ShouldContainSubstring, "WARN query ID=")
+			So(log, ShouldContainSubstring, "ROWS=1")
+			So(log, ShouldNotContainSubstring, secret)
+		})
+
+		Convey("Other endpoints aren't logged as queries", func() {
+			logWriter.Reset()
+
+			_, err = gas.QueryREST(s.Router(), EndPointHealth, "")
+			So(err, ShouldBeNil)
+			So(logWriter.String(), ShouldNotContainSubstring, " query ID=")
+		})
+	})
+}
+
+func TestAncestors(t *testing.T) {
+	Convey("Given a server with a database", t, func() {
+		s := New(io.Discard)
+
+		err := s.LoadDGUTADBs(createExampleDgutaDirs(t, 1)[0])
+		So(err, ShouldBeNil)
+
+		defer s.stop()
+
+		filter := &dguta.Filter{}
+
+		Convey("You can get summaries of a directory and all its parents, root first", func() {
+			dir := "/lustre/scratch0/dir/a"
+
+			dcss, err := s.ancestors(context.Background(), dir, filter)
+			So(err, ShouldBeNil)
+			So(len(dcss), ShouldEqual, 5)
+
+			dirs := make([]string, len(dcss))
+			for i, dcs := range dcss {
+				dirs[i] = dcs.Dir
+			}
+
+			So(dirs, ShouldResemble, []string{"/", "/lustre", "/lustre/scratch0", "/lustre/scratch0/dir", dir})
+
+			di, err := s.tree.DirInfo(dir, filter)
+			So(err, ShouldBeNil)
+			So(dcss[len(dcss)-1], ShouldResemble, di.Current)
+
+			di, err = s.tree.DirInfo("/", filter)
+			So(err, ShouldBeNil)
+			So(dcss[0], ShouldResemble, di.Current)
+		})
+
+		Convey("Trailing slashes are ignored", func() {
+			dcss, err := s.ancestors(context.Background(), "/lustre/", filter)
+			So(err, ShouldBeNil)
+			So(len(dcss), ShouldEqual, 2)
+			So(dcss[1].Dir, ShouldEqual, "/lustre")
+		})
+
+		Convey("Directories not in the database give an error", func() {
+			_, err := s.ancestors(context.Background(), "/foo", filter)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Relative paths give an error", func() {
+			_, err := s.ancestors(context.Background(), "lustre/scratch0", filter)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestLoadDGUTADBsAgain(t *testing.T) {
+	Convey("Given a server that has loaded a database", t, func() {
+		s := New(io.Discard)
+
+		metrics, err := query(s, EndPointMetrics, "")
+		So(err, ShouldBeNil)
+		So(metrics.Body.String(), ShouldContainSubstring, "wrstat_ui_oldest_dataset_age_seconds 0\n")
+
+		paths := createExampleDgutaDirs(t, 2)
+
+		err = s.LoadDGUTADBs(paths[0])
+		So(err, ShouldBeNil)
+
+		defer s.stop()
+
+		metrics, err = query(s, EndPointMetrics, "")
+		So(err, ShouldBeNil)
+		So(metrics.Body.String(), ShouldNotContainSubstring, "wrstat_ui_oldest_dataset_age_seconds 0\n")
+
+		response, err := queryWhere(s, "?dir=/lustre/scratch1")
+		So(err, ShouldBeNil)
+		So(response.Code, ShouldEqual, http.StatusBadRequest)
+
+		Convey("You can load different databases in its place", func() {
+			So(func() { err = s.LoadDGUTADBs(paths[1]) }, ShouldNotPanic)
+			So(err, ShouldBeNil)
+
+			response, err = queryWhere(s, "?dir=/lustre/scratch1")
+			So(err, ShouldBeNil)
+			So(response.Code, ShouldEqual, http.StatusOK)
+
+			response, err = queryWhere(s, "?dir=/lustre/scratch0")
+			So(err, ShouldBeNil)
+			So(response.Code, ShouldEqual, http.StatusBadRequest)
+		})
+	})
+}
+
+func TestDiffUsage(t *testing.T) {
+	Convey("DiffUsage reports added, removed and changed all-age usage", t, func() {
+		oldUsage := []*basedirs.Usage{
+			{GID: 1, Name: "a", BaseDir: "/m/a", UsageSize: 100, UsageInodes: 10},
+			{GID: 1, Name: "a", BaseDir: "/m/a", UsageSize: 5, UsageInodes: 1, Age: summary.DGUTAgeA1Y},
+			{GID: 2, Name: "b", BaseDir: "/m/b", UsageSize: 50, UsageInodes: 5},
+			{GID: 3, Name: "c", BaseDir: "/m/c", UsageSize: 30, UsageInodes: 3},
+			{GID: 4, Name: "d", BaseDir: "/m/d", UsageSize: 10, UsageInodes: 1},
+		}
+
+		newUsage := []*basedirs.Usage{
+			{GID: 1, Name: "a", BaseDir: "/m/a", UsageSize: 100, UsageInodes: 10},
+			{GID: 1, Name: "a", BaseDir: "/m/a", UsageSize: 50, UsageInodes: 1, Age: summary.DGUTAgeA1Y},
+			{GID: 2, Name: "b", BaseDir: "/m/b", UsageSize: 20, UsageInodes: 6},
+			{GID: 4, Name: "d", BaseDir: "/m/d", UsageSize: 11, UsageInodes: 1},
+			{GID: 5, Name: "e", BaseDir: "/m/e", UsageSize: 200, UsageInodes: 20},
+		}
+
+		diffs := DiffUsage(oldUsage, newUsage, 0)
+		So(len(diffs), ShouldEqual, 4)
+
+		So(diffs[0], ShouldResemble, &UsageDiff{
+			Change: UsageAdded, GID: 5, Name: "e", BaseDir: "/m/e",
+			NewUsageSize: 200, SizeDelta: 200, NewUsageInodes: 20, InodesDelta: 20,
+		})
+		So(diffs[1], ShouldResemble, &UsageDiff{
+			Change: UsageChanged, GID: 2, Name: "b", BaseDir: "/m/b",
+			OldUsageSize: 50, NewUsageSize: 20, SizeDelta: -30,
+			OldUsageInodes: 5, NewUsageInodes: 6, InodesDelta: 1,
+		})
+		So(diffs[2], ShouldResemble, &UsageDiff{
+			Change: UsageRemoved, GID: 3, Name: "c", BaseDir: "/m/c",
+			OldUsageSize: 30, SizeDelta: -30, OldUsageInodes: 3, InodesDelta: -3,
+		})
+		So(diffs[3].GID, ShouldEqual, 4)
+		So(diffs[3].SizeDelta, ShouldEqual, 1)
+
+		diffs = DiffUsage(oldUsage, newUsage, 30)
+		So(len(diffs), ShouldEqual, 3)
+		So(diffs[2].GID, ShouldEqual, 3)
+
+		So(len(DiffUsage(oldUsage, oldUsage, 0)), ShouldEqual, 0)
+	})
+
+	Convey("DiffBasedirsDBs finds no changes between a basedirs database and itself", t, func() {
+		tree, _, err := internaldb.CreateExampleDGUTADBForBasedirs(t)
+		So(err, ShouldBeNil)
+
+		dbPath, ownersPath, err := createExampleBasedirsDB(t, tree)
+		So(err, ShouldBeNil)
+
+		groups, users, err := DiffBasedirsDBs(dbPath, dbPath, ownersPath, 0)
+		So(err, ShouldBeNil)
+		So(len(groups), ShouldEqual, 0)
+		So(len(users), ShouldEqual, 0)
+
+		_, _, err = DiffBasedirsDBs(dbPath, filepath.Join(t.TempDir(), "missing"), ownersPath, 0)
+		So(err, ShouldNotBeNil)
+	})
+}
+
 func TestServer(t *testing.T) {
 	username, uid, gids := internaldb.GetUserAndGroups(t)
 	exampleGIDs := getExampleGIDs(gids)
@@ -115,6 +1778,39 @@ func TestServer(t *testing.T) {
 			So(err, ShouldNotBeNil)
 		})
 
+		Convey("Queries that take too long get a timeout response", func() {
+			gin.SetMode(gin.TestMode)
+
+			response := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(response)
+			c.Request = httptest.NewRequest(http.MethodGet, EndPointWhere, nil)
+
+			s.SetQueryTimeout(500 * time.Millisecond)
+
+			start := time.Now()
+			ok := s.runQuery(c, func(context.Context) {
+				<-time.After(2 * time.Second)
+			})
+
+			So(ok, ShouldBeFalse)
+			So(time.Since(start), ShouldBeLessThan, 2*time.Second)
+			So(response.Code, ShouldEqual, http.StatusGatewayTimeout)
+			So(response.Body.String(), ShouldEqual, `{"error":"query timeout"}`)
+
+			response = httptest.NewRecorder()
+			c, _ = gin.CreateTestContext(response)
+			c.Request = httptest.NewRequest(http.MethodGet, EndPointWhere, nil)
+
+			ran := false
+			ok = s.runQuery(c, func(context.Context) {
+				ran = true
+			})
+
+			So(ok, ShouldBeTrue)
+			So(ran, ShouldBeTrue)
+			So(response.Code, ShouldEqual, http.StatusOK)
+		})
+
 		Convey("You can Start the Server", func() {
 			certPath, keyPath, err := gas.CreateTestCert(t)
 			So(err, ShouldBeNil)
@@ -126,6 +1822,11 @@ func TestServer(t *testing.T) {
 				So(errd, ShouldBeNil)
 			}()
 
+			// Start() adds middleware in its own goroutine; a round trip to the
+			// server orders that before we add any routes below.
+			_, err = gas.NewClientRequest(addr, certPath).Get(EndPointHealth)
+			So(err, ShouldBeNil)
+
 			Convey("The jwt endpoint works after enabling it", func() {
 				err = s.EnableAuth(certPath, keyPath, func(u, p string) (bool, string) {
 					returnUID := uid
@@ -156,6 +1857,73 @@ func TestServer(t *testing.T) {
 				testRestrictedGroups(t, gids, s, exampleGIDs, addr, certPath, token, tokenBadUID)
 			})
 
+			Convey("GetWhereDataIsCtx can be cancelled and retries server errors", func() {
+				var calls, failures atomic.Int32
+
+				var delay atomic.Int64
+
+				ws := New(io.Discard)
+
+				err = ws.EnableAuth(certPath, keyPath, func(u, p string) (bool, string) {
+					return true, uid
+				})
+				So(err, ShouldBeNil)
+
+				ws.AuthRouter().GET(wherePath, func(c *gin.Context) {
+					if calls.Add(1) <= failures.Load() {
+						c.AbortWithStatus(http.StatusServiceUnavailable)
+
+						return
+					}
+
+					<-time.After(time.Duration(delay.Load()))
+
+					c.JSON(http.StatusOK, []*DirSummary{{Dir: "/a", Count: 1}})
+				})
+
+				waddr, wdfunc, err := gas.StartTestServer(ws, certPath, keyPath)
+				So(err, ShouldBeNil)
+				defer func() {
+					errd := wdfunc()
+					So(errd, ShouldBeNil)
+				}()
+
+				c, err := gas.NewClientCLI(".wrstat.test.ctx.jwt", ".wrstat.test.ctx.servertoken", waddr, certPath, false)
+				So(err, ShouldBeNil)
+
+				err = c.Login(username, "pass")
+				So(err, ShouldBeNil)
+
+				slow := 2 * time.Second
+				delay.Store(int64(slow))
+
+				ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+				defer cancel()
+
+				start := time.Now()
+				_, _, err = GetWhereDataIsCtx(ctx, c, "/", "", "", "", summary.DGUTAgeAll, "0", WhereOptions{})
+				So(errors.Is(err, context.DeadlineExceeded), ShouldBeTrue)
+				So(time.Since(start), ShouldBeLessThan, slow)
+
+				calls.Store(0)
+				failures.Store(2)
+				delay.Store(0)
+
+				_, _, err = GetWhereDataIsCtx(context.Background(), c, "/", "", "", "", summary.DGUTAgeAll, "0",
+					WhereOptions{Retries: 1, Backoff: time.Millisecond})
+				So(err, ShouldEqual, ErrBadQuery)
+				So(calls.Load(), ShouldEqual, 2)
+
+				calls.Store(0)
+
+				_, dss, err := GetWhereDataIsCtx(context.Background(), c, "/", "", "", "", summary.DGUTAgeAll, "0",
+					WhereOptions{Retries: 2, Backoff: time.Millisecond})
+				So(err, ShouldBeNil)
+				So(calls.Load(), ShouldEqual, 3)
+				So(len(dss), ShouldEqual, 1)
+				So(dss[0].Dir, ShouldEqual, "/a")
+			})
+
 			testClientsOnRealServer(t, username, uid, gids, s, addr, certPath, keyPath)
 		})
 
@@ -181,6 +1949,10 @@ func TestServer(t *testing.T) {
 			So(logWriter.String(), ShouldContainSubstring, "STATUS=404")
 			logWriter.Reset()
 
+			response, err = query(s, EndPointHealth, "")
+			So(err, ShouldBeNil)
+			So(response.Code, ShouldEqual, http.StatusServiceUnavailable)
+
 			Convey("And given a dguta database", func() {
 				path, err := internaldb.CreateExampleDGUTADBCustomIDs(t, uid, gids[0], gids[1], int(refTime))
 				So(err, ShouldBeNil)
@@ -207,15 +1979,160 @@ func TestServer(t *testing.T) {
 					err = s.LoadDGUTADBs(path)
 					So(err, ShouldBeNil)
 
-					response, err := queryWhere(s, "")
-					So(err, ShouldBeNil)
-					So(response.Code, ShouldEqual, http.StatusOK)
-					So(logWriter.String(), ShouldContainSubstring, "[GET /rest/v1/where")
-					So(logWriter.String(), ShouldContainSubstring, "STATUS=200")
+					response, err := queryWhere(s, "")
+					So(err, ShouldBeNil)
+					So(response.Code, ShouldEqual, http.StatusOK)
+					So(logWriter.String(), ShouldContainSubstring, "[GET /rest/v1/where")
+					So(logWriter.String(), ShouldContainSubstring, "STATUS=200")
+
+					health, err := query(s, EndPointHealth, "")
+					So(err, ShouldBeNil)
+					So(health.Code, ShouldEqual, http.StatusOK)
+					So(health.Body.String(), ShouldContainSubstring, `"status":"ok"`)
+
+					result, err := decodeWhereResult(response)
+					So(err, ShouldBeNil)
+					So(result, ShouldResemble, expected)
+
+					Convey("And requests are given IDs that are logged and returned", func() {
+						logWriter.Reset()
+
+						response, err := queryWithHeaders(s, EndPointWhere, map[string]string{RequestIDHeader: "proxy-id-123"})
+						So(err, ShouldBeNil)
+						So(response.Code, ShouldEqual, http.StatusOK)
+						So(response.Header().Get(RequestIDHeader), ShouldEqual, "proxy-id-123")
+						So(logWriter.String(), ShouldContainSubstring, "[GET /rest/v1/where")
+						So(logWriter.String(), ShouldContainSubstring, "ID=proxy-id-123 STATUS=200")
+						So(logWriter.String(), ShouldContainSubstring, `""] STATUS=200`)
+
+						logWriter.Reset()
+
+						response, err = queryWhere(s, "")
+						So(err, ShouldBeNil)
+						So(response.Code, ShouldEqual, http.StatusOK)
+
+						id := response.Header().Get(RequestIDHeader)
+						So(id, ShouldHaveLength, 36)
+						So(id, ShouldNotEqual, newRequestID())
+						So(logWriter.String(), ShouldContainSubstring, "ID="+id+" STATUS=200")
+
+						req := httptest.NewRequest(http.MethodGet, EndPointWhere, nil)
+						So(RequestID(req.Context()), ShouldBeEmpty)
+					})
+
+					Convey("And metrics about requests, queries and reloads can be scraped", func() {
+						_, err = queryWhere(s, "?age=99")
+						So(err, ShouldBeNil)
+
+						s.reloadDGUTADBs("/nonexistent", ".dguta.dbs", time.Now())
+						So(s.LastReloadError(), ShouldNotBeNil)
+
+						metrics, err := query(s, EndPointMetrics, "")
+						So(err, ShouldBeNil)
+						So(metrics.Code, ShouldEqual, http.StatusOK)
+						So(metrics.Header().Get("Content-Type"), ShouldStartWith, "text/plain")
+
+						body := metrics.Body.String()
+						So(body, ShouldContainSubstring, "# TYPE wrstat_ui_http_requests_total counter\n")
+						So(body, ShouldContainSubstring,
+							`wrstat_ui_http_requests_total{endpoint="unmatched",method="GET",status="404"} 1`+"\n")
+						So(body, ShouldContainSubstring,
+							`wrstat_ui_http_requests_total{endpoint="/rest/v1/where",method="GET",status="200"} 1`+"\n")
+						So(body, ShouldContainSubstring,
+							`wrstat_ui_http_requests_total{endpoint="/rest/v1/where",method="GET",status="400"} 1`+"\n")
+						So(body, ShouldContainSubstring,
+							`wrstat_ui_http_requests_total{endpoint="/health",method="GET",status="503"} 1`+"\n")
+						So(body, ShouldContainSubstring,
+							`wrstat_ui_http_requests_total{endpoint="/health",method="GET",status="200"} 1`+"\n")
+						So(body, ShouldContainSubstring, `wrstat_ui_query_duration_seconds_count{query="where"} 1`+"\n")
+						So(body, ShouldContainSubstring, `wrstat_ui_query_duration_seconds_bucket{query="where",le="+Inf"} 1`)
+						So(body, ShouldContainSubstring, `wrstat_ui_reload_duration_seconds_count{kind="dguta dbs"} 1`)
+						So(body, ShouldContainSubstring, `wrstat_ui_reloads_total{kind="dguta dbs",result="failure"} 1`)
+						So(body, ShouldContainSubstring, "wrstat_ui_oldest_dataset_age_seconds ")
+						So(body, ShouldNotContainSubstring, "wrstat_ui_oldest_dataset_age_seconds 0\n")
+
+						_, err = queryWhere(s, "")
+						So(err, ShouldBeNil)
+
+						metrics, err = query(s, EndPointMetrics, "")
+						So(err, ShouldBeNil)
+
+						body = metrics.Body.String()
+						So(body, ShouldContainSubstring,
+							`wrstat_ui_http_requests_total{endpoint="/rest/v1/where",method="GET",status="200"} 2`+"\n")
+						So(body, ShouldContainSubstring, `wrstat_ui_query_duration_seconds_count{query="where"} 2`+"\n")
+						So(body, ShouldContainSubstring, `wrstat_ui_http_requests_total{endpoint="/metrics",method="GET",status="200"} 1`)
+					})
+
+					Convey("And get the same results from version 2 of the API", func() {
+						response, err := query(s, EndPointV2Where, "")
+						So(err, ShouldBeNil)
+						So(response.Code, ShouldEqual, http.StatusOK)
+						So(response.Body.String(), ShouldNotContainSubstring, "\n")
+
+						result, err := decodeWhereResult(response)
+						So(err, ShouldBeNil)
+						So(result, ShouldResemble, expected)
+					})
+
+					Convey("And get them as newline-delimited JSON", func() {
+						response, err := queryWithHeaders(s, EndPointWhere, map[string]string{
+							"Accept":          "application/x-ndjson",
+							"Accept-Encoding": "gzip",
+						})
+						So(err, ShouldBeNil)
+						So(response.Code, ShouldEqual, http.StatusOK)
+						So(response.Header().Get("Content-Type"), ShouldEqual, "application/x-ndjson")
+						So(response.Header().Get("Content-Encoding"), ShouldBeBlank)
+
+						lines := strings.Split(strings.TrimSuffix(response.Body.String(), "\n"), "\n")
+						So(len(lines), ShouldEqual, len(expected))
+
+						for i, line := range lines {
+							var ds *DirSummary
+
+							err = json.Unmarshal([]byte(line), &ds)
+							So(err, ShouldBeNil)
+
+							fixDirSummaryTimes([]*DirSummary{ds})
+							So(ds, ShouldResemble, expected[i])
+						}
+					})
+
+					Convey("And get them gzip compressed if you accept that", func() {
+						response, err := queryWithHeaders(s, EndPointWhere, map[string]string{
+							"Accept-Encoding": "deflate, gzip;q=0.8",
+						})
+						So(err, ShouldBeNil)
+						So(response.Code, ShouldEqual, http.StatusOK)
+						So(response.Header().Get("Content-Encoding"), ShouldEqual, "gzip")
+
+						gz, err := gzip.NewReader(response.Body)
+						So(err, ShouldBeNil)
+
+						decompressed, err := io.ReadAll(gz)
+						So(err, ShouldBeNil)
+
+						plain, err := queryWhere(s, "")
+						So(err, ShouldBeNil)
+						So(plain.Header().Get("Content-Encoding"), ShouldBeBlank)
+						So(string(decompressed), ShouldEqual, plain.Body.String())
+
+						response, err = queryWithHeaders(s, EndPointWhere, map[string]string{
+							"Accept-Encoding": "gzip;q=0",
+						})
+						So(err, ShouldBeNil)
+						So(response.Header().Get("Content-Encoding"), ShouldBeBlank)
+						So(response.Body.String(), ShouldEqual, plain.Body.String())
 
-					result, err := decodeWhereResult(response)
-					So(err, ShouldBeNil)
-					So(result, ShouldResemble, expected)
+						response, err = queryWithHeaders(s, EndPointWhere+"?dir=/a/b/d/g", map[string]string{
+							"Accept-Encoding": "gzip",
+						})
+						So(err, ShouldBeNil)
+						So(response.Code, ShouldEqual, http.StatusOK)
+						So(response.Body.Len(), ShouldBeLessThan, 1024)
+						So(response.Header().Get("Content-Encoding"), ShouldBeBlank)
+					})
 
 					Convey("And you can filter results", func() {
 						groups := gidsToGroups(t, gids...)
@@ -407,6 +2324,70 @@ func TestServer(t *testing.T) {
 						So(logWriter.String(), ShouldContainSubstring, "Error #01: directory not found")
 					})
 
+					Convey("You can get results grouped by group or user", func() {
+						di, err := s.tree.DirInfo("/a", &dguta.Filter{FTs: summary.AllTypesExceptDirectories})
+						So(err, ShouldBeNil)
+
+						for _, groupBy := range []string{GroupByGroup, GroupByUser} {
+							response, err = queryWhere(s, "?dir=/a&groupBy="+groupBy)
+							So(err, ShouldBeNil)
+							So(response.Code, ShouldEqual, http.StatusOK)
+
+							result, err = decodeWhereResult(response)
+							So(err, ShouldBeNil)
+							So(len(result), ShouldBeGreaterThan, 1)
+
+							var count, size uint64
+
+							for _, ds := range result {
+								So(ds.Dir, ShouldEqual, "/a")
+
+								if groupBy == GroupByGroup {
+									So(len(ds.Groups), ShouldEqual, 1)
+								} else {
+									So(len(ds.Users), ShouldEqual, 1)
+								}
+
+								count += ds.Count
+								size += ds.Size
+							}
+
+							So(count, ShouldEqual, di.Current.Count)
+							So(size, ShouldEqual, di.Current.Size)
+
+							dcss, errp := s.pivotWhere(context.Background(), "/a", &dguta.Filter{}, groupBy)
+							So(errp, ShouldBeNil)
+							So(len(dcss), ShouldEqual, len(result))
+
+							for _, dcs := range dcss {
+								idFilter := &dguta.Filter{FTs: summary.AllTypesExceptDirectories}
+
+								if groupBy == GroupByGroup {
+									idFilter.GIDs = dcs.GIDs
+								} else {
+									idFilter.UIDs = dcs.UIDs
+								}
+
+								idDI, errd := s.tree.DirInfo("/a", idFilter)
+								So(errd, ShouldBeNil)
+								So(dcs, ShouldResemble, idDI.Current)
+							}
+						}
+
+						response, err = queryWhere(s, "?dir=/a&groupBy=group&groups="+groupA)
+						So(err, ShouldBeNil)
+						So(response.Code, ShouldEqual, http.StatusOK)
+
+						result, err = decodeWhereResult(response)
+						So(err, ShouldBeNil)
+						So(len(result), ShouldEqual, 1)
+						So(result[0].Groups, ShouldResemble, []string{groupA})
+
+						response, err = queryWhere(s, "?groupBy=foo")
+						So(err, ShouldBeNil)
+						So(response.Code, ShouldEqual, http.StatusBadRequest)
+					})
+
 					Convey("And you can auto-reload a new database", func() {
 						pathNew, errc := internaldb.CreateExampleDGUTADBCustomIDs(t, uid, gids[1], gids[0], int(refTime))
 						So(errc, ShouldBeNil)
@@ -450,6 +2431,7 @@ func TestServer(t *testing.T) {
 						s.treeMutex.RLock()
 						So(s.dataTimeStamp.IsZero(), ShouldBeFalse)
 						previous := s.dataTimeStamp
+						previousDatasets := s.datasets
 						s.treeMutex.RUnlock()
 
 						response, err = queryWhere(s, "")
@@ -470,6 +2452,8 @@ func TestServer(t *testing.T) {
 
 						s.treeMutex.RLock()
 						So(s.dataTimeStamp.After(previous), ShouldBeTrue)
+						So(len(s.datasets), ShouldEqual, len(s.dgutaPaths))
+						So(s.datasets, ShouldNotEqual, previousDatasets)
 						s.treeMutex.RUnlock()
 
 						_, err = os.Stat(path)
@@ -571,6 +2555,36 @@ func TestServer(t *testing.T) {
 							testReloadFail(grandparentDir, "database doesn't exist")
 						})
 
+						Convey("when one of the new database paths is invalid, keeping the old databases", func() {
+							So(s.LastReloadError(), ShouldBeNil)
+
+							tpath := makeTestPath()
+
+							cmd := exec.Command("cp", "--recursive", path, filepath.Join(tpath, "0"))
+							err = cmd.Run()
+							So(err, ShouldBeNil)
+
+							err = os.Mkdir(filepath.Join(tpath, "1"), internaldb.DirPerms)
+							So(err, ShouldBeNil)
+
+							testReloadFail(grandparentDir, "database doesn't exist")
+
+							So(s.LastReloadError(), ShouldNotBeNil)
+							So(s.LastReloadError().Error(), ShouldContainSubstring, "reloading dguta dbs failed")
+							So(s.ReloadErrors(), ShouldEqual, 1)
+
+							response, err := queryWhere(s, "")
+							So(err, ShouldBeNil)
+							So(response.Code, ShouldEqual, http.StatusOK)
+
+							result, err := decodeWhereResult(response)
+							So(err, ShouldBeNil)
+							So(result, ShouldResemble, expected)
+
+							_, err = os.Stat(path)
+							So(err, ShouldBeNil)
+						})
+
 						Convey("when the old path can't be deleted", func() {
 							s.dgutaPaths = []string{"."}
 							tpath := makeTestPath()
@@ -604,6 +2618,31 @@ func TestServer(t *testing.T) {
 			So(logWriter.String(), ShouldContainSubstring, "STATUS=404")
 			logWriter.Reset()
 
+			Convey("Or without a basedirs database, you can disable them but still use where", func() {
+				path, err := internaldb.CreateExampleDGUTADBCustomIDs(t, uid, gids[0], gids[1], int(refTime))
+				So(err, ShouldBeNil)
+
+				err = s.LoadDGUTADBs(path)
+				So(err, ShouldBeNil)
+
+				s.DisableBasedirs()
+
+				response, err := queryWhere(s, "")
+				So(err, ShouldBeNil)
+				So(response.Code, ShouldEqual, http.StatusOK)
+
+				for _, endpoint := range []string{
+					EndPointBasedirUsageGroup, EndPointBasedirUsageUser, EndPointBasedirUsageOwner,
+					EndPointBasedirSubdirGroup, EndPointBasedirSubdirUser, EndPointBasedirHistory,
+					EndPointCompare,
+				} {
+					response, err = query(s, endpoint, "")
+					So(err, ShouldBeNil)
+					So(response.Code, ShouldEqual, http.StatusNotFound)
+					So(response.Body.String(), ShouldContainSubstring, string(ErrBasedirsDisabled))
+				}
+			})
+
 			Convey("And given a basedirs database", func() {
 				tree, _, err := internaldb.CreateExampleDGUTADBForBasedirs(t)
 				So(err, ShouldBeNil)
@@ -652,6 +2691,39 @@ func TestServer(t *testing.T) {
 					So(usageUser[0].Owner, ShouldBeBlank)
 					So(usageUser[0].BaseDir, ShouldNotBeBlank)
 
+					countsByAge := func(usage []*basedirs.Usage) map[summary.DirGUTAge]int {
+						counts := make(map[summary.DirGUTAge]int)
+
+						for _, u := range usage {
+							counts[u.Age]++
+						}
+
+						return counts
+					}
+
+					for endpoint, all := range map[string][]*basedirs.Usage{
+						EndPointBasedirUsageGroup: usageGroup,
+						EndPointBasedirUsageUser:  usageUser,
+					} {
+						expectedCounts := countsByAge(all)
+
+						for _, age := range []summary.DirGUTAge{summary.DGUTAgeAll, summary.DGUTAgeA7Y} {
+							response, err = query(s, endpoint, fmt.Sprintf("?age=%d", age))
+							So(err, ShouldBeNil)
+							So(response.Code, ShouldEqual, http.StatusOK)
+
+							usageAge, errd := decodeUsageResult(response)
+							So(errd, ShouldBeNil)
+							So(len(usageAge), ShouldEqual, expectedCounts[age])
+							So(len(usageAge), ShouldBeLessThan, len(all))
+							So(countsByAge(usageAge)[age], ShouldEqual, expectedCounts[age])
+						}
+
+						response, err = query(s, endpoint, "?age=99")
+						So(err, ShouldBeNil)
+						So(response.Code, ShouldEqual, http.StatusBadRequest)
+					}
+
 					response, err = query(s, EndPointBasedirSubdirGroup,
 						fmt.Sprintf("?id=%d&basedir=%s", usageGroup[0].GID, usageGroup[0].BaseDir))
 					So(err, ShouldBeNil)
@@ -688,6 +2760,25 @@ func TestServer(t *testing.T) {
 					So(len(history), ShouldEqual, 1)
 					So(history[0].UsageInodes, ShouldEqual, 2)
 
+					response, err = query(s, EndPointBasedirAlerts, "?days=36500")
+					So(err, ShouldBeNil)
+					So(response.Code, ShouldEqual, http.StatusOK)
+
+					var alerts []*QuotaAlert
+					err = json.NewDecoder(response.Body).Decode(&alerts)
+					So(err, ShouldBeNil)
+					So(alerts, ShouldNotBeNil)
+
+					response, err = query(s, EndPointBasedirAlerts, "?days=soon")
+					So(err, ShouldBeNil)
+					So(response.Code, ShouldEqual, http.StatusBadRequest)
+
+					var export bytes.Buffer
+
+					err = ExportBasedirs(&export, s.basedirs, ExportFormatJSON)
+					So(err, ShouldBeNil)
+					So(strings.Count(export.String(), "\n"), ShouldBeGreaterThanOrEqualTo, len(usageGroup)+len(usageUser))
+
 					response, err = query(s, EndPointBasedirSubdirUser,
 						fmt.Sprintf("?id=%d&basedir=%s&age=%d", usageUser[0].UID, usageUser[0].BaseDir, summary.DGUTAgeA3Y))
 					So(err, ShouldBeNil)
@@ -699,6 +2790,281 @@ func TestServer(t *testing.T) {
 					So(err, ShouldBeNil)
 					So(len(subdirs), ShouldEqual, 1)
 
+					Convey("You can get the usage of groups by owner", func() {
+						var expected []*basedirs.Usage
+
+						for _, u := range usageGroup {
+							if u.Owner == "Barbara" {
+								expected = append(expected, u)
+							}
+						}
+
+						So(len(expected), ShouldBeGreaterThan, 0)
+
+						response, err := query(s, EndPointBasedirUsageOwner, "?owner=Barbara")
+						So(err, ShouldBeNil)
+						So(response.Code, ShouldEqual, http.StatusOK)
+
+						usageOwner, err := decodeUsageResult(response)
+						So(err, ShouldBeNil)
+						So(len(usageOwner), ShouldEqual, len(expected))
+
+						for _, u := range usageOwner {
+							So(u.GID, ShouldEqual, 2)
+							So(u.Owner, ShouldEqual, "Barbara")
+						}
+
+						response, err = query(s, EndPointBasedirUsageOwner, "?owner=Nobody")
+						So(err, ShouldBeNil)
+						So(response.Code, ShouldEqual, http.StatusOK)
+
+						usageOwner, err = decodeUsageResult(response)
+						So(err, ShouldBeNil)
+						So(usageOwner, ShouldNotBeNil)
+						So(len(usageOwner), ShouldEqual, 0)
+
+						response, err = query(s, EndPointBasedirUsageOwner, "")
+						So(err, ShouldBeNil)
+						So(response.Code, ShouldEqual, http.StatusBadRequest)
+
+						direct, err := s.GroupsByOwner("Barbara")
+						So(err, ShouldBeNil)
+						So(len(direct), ShouldEqual, len(expected))
+
+						var expectedA3Y []*basedirs.Usage
+
+						for _, u := range expected {
+							if u.Age == summary.DGUTAgeA3Y {
+								expectedA3Y = append(expectedA3Y, u)
+							}
+						}
+
+						So(len(expectedA3Y), ShouldBeGreaterThan, 0)
+						So(len(expectedA3Y), ShouldBeLessThan, len(expected))
+
+						response, err = query(s, EndPointBasedirUsageOwner,
+							fmt.Sprintf("?owner=Barbara&age=%d", summary.DGUTAgeA3Y))
+						So(err, ShouldBeNil)
+						So(response.Code, ShouldEqual, http.StatusOK)
+
+						usageOwner, err = decodeUsageResult(response)
+						So(err, ShouldBeNil)
+						So(usageOwner, ShouldResemble, expectedA3Y)
+
+						direct, err = s.GroupsByOwner("Barbara", summary.DGUTAgeA3Y)
+						So(err, ShouldBeNil)
+						So(direct, ShouldResemble, expectedA3Y)
+
+						response, err = query(s, EndPointBasedirUsageOwner, "?owner=Barbara&age=foo")
+						So(err, ShouldBeNil)
+						So(response.Code, ShouldEqual, http.StatusBadRequest)
+
+						_, err = New(io.Discard).GroupsByOwner("Barbara")
+						So(err, ShouldEqual, ErrBasedirsDisabled)
+					})
+
+					Convey("You can compare the profiles of groups on a mount", func() {
+						mount := "/lustre/scratch125"
+
+						expected := make(map[uint32]*GroupProfile)
+
+						var names []string
+
+						for _, u := range usageGroup {
+							if !strings.HasPrefix(u.BaseDir, mount+"/") {
+								continue
+							}
+
+							gidStr, errl := groupNameToGID(u.Name)
+							if errl != nil || gidStr != strconv.Itoa(int(u.GID)) {
+								continue
+							}
+
+							p, ok := expected[u.GID]
+							if !ok {
+								if len(expected) == 2 {
+									continue
+								}
+
+								p = &GroupProfile{Group: u.Name, GID: u.GID, AgeSizes: make(map[summary.DirGUTAge]uint64)}
+								expected[u.GID] = p
+								names = append(names, u.Name)
+							}
+
+							p.AgeSizes[u.Age] += u.UsageSize
+
+							if u.Age == summary.DGUTAgeAll {
+								p.UsageSize += u.UsageSize
+								p.UsageInodes += u.UsageInodes
+								p.QuotaSize = u.QuotaSize
+								p.QuotaInodes = u.QuotaInodes
+								p.TopBaseDirs = append(p.TopBaseDirs, u)
+							}
+						}
+
+						if len(expected) < 2 {
+							SkipConvey("Can't test compare without 2 resolvable groups", func() {})
+
+							return
+						}
+
+						response, err := query(s, EndPointCompare,
+							"?mount="+mount+"/&groups="+strings.Join(names, ","))
+						So(err, ShouldBeNil)
+						So(response.Code, ShouldEqual, http.StatusOK)
+
+						var profiles []*GroupProfile
+						err = json.NewDecoder(response.Body).Decode(&profiles)
+						So(err, ShouldBeNil)
+						So(len(profiles), ShouldEqual, 2)
+
+						for i, p := range profiles {
+							e := expected[p.GID]
+							So(e, ShouldNotBeNil)
+							So(p.Group, ShouldEqual, names[i])
+							So(p.UsageSize, ShouldEqual, e.UsageSize)
+							So(p.UsageInodes, ShouldEqual, e.UsageInodes)
+							So(p.QuotaSize, ShouldEqual, e.QuotaSize)
+							So(p.QuotaInodes, ShouldEqual, e.QuotaInodes)
+							So(len(p.TopBaseDirs), ShouldEqual, len(e.TopBaseDirs))
+
+							for age, size := range e.AgeSizes {
+								So(p.AgeSizes[age], ShouldEqual, size)
+							}
+
+							response, err = query(s, EndPointBasedirHistory,
+								fmt.Sprintf("?id=%d&basedir=%s/", p.GID, mount))
+							So(err, ShouldBeNil)
+
+							history, errd := decodeHistoryResult(response)
+							So(errd, ShouldBeNil)
+							So(p.Growth6Months, ShouldEqual, growthSince(history, 6))
+							So(p.Growth12Months, ShouldEqual, growthSince(history, 12))
+
+							di, errd := s.tree.DirInfo(mount, &dguta.Filter{
+								GIDs: []uint32{p.GID},
+								FTs:  summary.AllTypesExceptDirectories,
+							})
+							So(errd, ShouldBeNil)
+
+							var ftTotal uint64
+
+							for _, size := range p.FileTypeSizes {
+								ftTotal += size
+							}
+
+							So(ftTotal, ShouldEqual, di.Current.Size)
+						}
+
+						response, err = query(s, EndPointCompare, "?groups="+names[0])
+						So(err, ShouldBeNil)
+						So(response.Code, ShouldEqual, http.StatusBadRequest)
+
+						response, err = query(s, EndPointCompare, "?mount="+mount)
+						So(err, ShouldBeNil)
+						So(response.Code, ShouldEqual, http.StatusBadRequest)
+					})
+
+					Convey("Usage responses can be cached by clients until a reload", func() {
+						response, err := queryWithHeaders(s, EndPointBasedirUsageGroup, nil)
+						So(err, ShouldBeNil)
+						So(response.Code, ShouldEqual, http.StatusOK)
+
+						etag := response.Header().Get("ETag")
+						So(etag, ShouldNotBeBlank)
+
+						lastModified := response.Header().Get("Last-Modified")
+						So(lastModified, ShouldNotBeBlank)
+
+						response, err = queryWithHeaders(s, EndPointBasedirUsageGroup, map[string]string{
+							"If-None-Match": etag,
+						})
+						So(err, ShouldBeNil)
+						So(response.Code, ShouldEqual, http.StatusNotModified)
+						So(response.Body.Len(), ShouldEqual, 0)
+
+						response, err = queryWithHeaders(s, EndPointBasedirUsageUser, map[string]string{
+							"If-Modified-Since": lastModified,
+						})
+						So(err, ShouldBeNil)
+						So(response.Code, ShouldEqual, http.StatusNotModified)
+
+						response, err = queryWithHeaders(s, EndPointBasedirUsageUser, map[string]string{
+							"If-Modified-Since": time.Unix(0, 0).UTC().Format(http.TimeFormat),
+						})
+						So(err, ShouldBeNil)
+						So(response.Code, ShouldEqual, http.StatusOK)
+
+						later := time.Now().Add(time.Minute)
+						err = os.Chtimes(ownersPath, later, later)
+						So(err, ShouldBeNil)
+
+						s.reloadOwners(ownersPath)
+
+						response, err = queryWithHeaders(s, EndPointBasedirUsageGroup, map[string]string{
+							"If-None-Match": etag,
+						})
+						So(err, ShouldBeNil)
+						So(response.Code, ShouldEqual, http.StatusOK)
+						So(response.Header().Get("ETag"), ShouldNotEqual, etag)
+
+						So(len(s.reloadHistory), ShouldEqual, 1)
+						So(s.reloadHistory[0].Key, ShouldEqual, "owners")
+						So(s.reloadHistory[0].RecordCount, ShouldEqual, len(s.ownerGIDs))
+						So(s.reloadHistory[0].Error, ShouldBeBlank)
+						So(s.LastReloadError(), ShouldBeNil)
+
+						s.reloadOwners(filepath.Join(t.TempDir(), "missing"))
+
+						So(len(s.reloadHistory), ShouldEqual, 2)
+						So(s.reloadHistory[1].Key, ShouldEqual, "owners")
+						So(s.reloadHistory[1].Error, ShouldNotBeBlank)
+						So(s.LastReloadError(), ShouldNotBeNil)
+						So(s.ReloadErrors(), ShouldEqual, 1)
+						So(s.ownersPath, ShouldEqual, ownersPath)
+
+						var metrics strings.Builder
+
+						s.metrics.write(&metrics)
+						So(metrics.String(), ShouldContainSubstring,
+							`wrstat_ui_reloads_total{kind="owners",result="success"} 1`)
+						So(metrics.String(), ShouldContainSubstring,
+							`wrstat_ui_reloads_total{kind="owners",result="failure"} 1`)
+						So(metrics.String(), ShouldContainSubstring,
+							`wrstat_ui_reload_duration_seconds_count{kind="owners"} 2`)
+					})
+
+					Convey("Which reflect changes to the owners file after WatchOwnersFile", func() {
+						pollFrequency := 10 * time.Millisecond
+
+						err = s.WatchOwnersFile(ownersPath, pollFrequency)
+						So(err, ShouldBeNil)
+
+						err = os.WriteFile(ownersPath, []byte("1,Alan\n2,Zoe\n4,Dellilah"), 0600)
+						So(err, ShouldBeNil)
+
+						later := time.Now().Add(time.Minute)
+						err = os.Chtimes(ownersPath, later, later)
+						So(err, ShouldBeNil)
+
+						So(waitForOwnerOfGID(s, 2, "Zoe"), ShouldBeTrue)
+
+						response, err := query(s, EndPointBasedirUsageOwner, "?owner=Zoe")
+						So(err, ShouldBeNil)
+						So(response.Code, ShouldEqual, http.StatusOK)
+
+						usageOwner, err := decodeUsageResult(response)
+						So(err, ShouldBeNil)
+						So(len(usageOwner), ShouldBeGreaterThan, 0)
+
+						response, err = query(s, EndPointBasedirUsageOwner, "?owner=Barbara")
+						So(err, ShouldBeNil)
+
+						usageOwner, err = decodeUsageResult(response)
+						So(err, ShouldBeNil)
+						So(len(usageOwner), ShouldEqual, 0)
+					})
+
 					Convey("Which get updated by an auto-reload when the sentinal file changes", func() {
 						parentDir := filepath.Dir(filepath.Dir(dbPath))
 						sentinel := filepath.Join(parentDir, ".sentinel")
@@ -753,6 +3119,65 @@ func TestServer(t *testing.T) {
 						So(err, ShouldBeNil)
 						So(len(usageGroup), ShouldEqual, 17)
 					})
+
+					Convey("Which keep being served while a reload prepares the new database", func() {
+						parentDir := filepath.Dir(filepath.Dir(dbPath))
+
+						gid, uid, _, _, err := internaldata.RealGIDAndUID()
+						So(err, ShouldBeNil)
+
+						_, files := internaldata.FakeFilesForDGUTADBForBasedirsTesting(gid, uid)
+						tree, _, err = internaldb.CreateDGUTADBFromFakeFiles(t, files[:1])
+						So(err, ShouldBeNil)
+
+						pathNew, _, err := createExampleBasedirsDB(t, tree)
+						So(err, ShouldBeNil)
+
+						newerPath := filepath.Join(parentDir, "newer.basedir.db")
+						err = os.Rename(pathNew, newerPath)
+						So(err, ShouldBeNil)
+
+						later := time.Now().Local().Add(1 * time.Second)
+						err = os.Chtimes(newerPath, later, later)
+						So(err, ShouldBeNil)
+
+						prepared := make(chan bool)
+						release := make(chan bool)
+						s.basedirsPrepared = func() {
+							close(prepared)
+							<-release
+						}
+
+						reloaded := make(chan bool)
+
+						go func() {
+							s.reloadBasedirsDB(parentDir, filepath.Base(dbPath))
+							close(reloaded)
+						}()
+
+						<-prepared
+
+						response, err := query(s, EndPointBasedirUsageGroup, "")
+						So(err, ShouldBeNil)
+						So(response.Code, ShouldEqual, http.StatusOK)
+
+						usageGroup, err := decodeUsageResult(response)
+						So(err, ShouldBeNil)
+						So(len(usageGroup), ShouldEqual, 102)
+
+						close(release)
+						<-reloaded
+
+						response, err = query(s, EndPointBasedirUsageGroup, "")
+						So(err, ShouldBeNil)
+						So(response.Code, ShouldEqual, http.StatusOK)
+
+						usageGroup, err = decodeUsageResult(response)
+						So(err, ShouldBeNil)
+						So(len(usageGroup), ShouldEqual, 17)
+
+						So(logWriter.String(), ShouldContainSubstring, "prepared basedirs db "+newerPath+" in ")
+					})
 				})
 			})
 		})
@@ -865,6 +3290,14 @@ func testClientsOnRealServer(t *testing.T, username, uid string, gids []string,
 			So(string(json), ShouldNotBeBlank)
 			So(len(dcss), ShouldEqual, 1)
 			So(dcss[0].Count, ShouldEqual, 19)
+
+			results, errg := GetWhereDataIsForDirs(c, []string{"/a/b/d/i", "/k"}, "", "", "", summary.DGUTAgeAll, "0")
+			So(errg, ShouldBeNil)
+			So(len(results), ShouldEqual, 2)
+			So(len(results["/a/b/d/i"].Summaries), ShouldEqual, 1)
+			So(results["/a/b/d/i"].Summaries[0].Count, ShouldEqual, 1)
+			So(len(results["/k"].Summaries), ShouldEqual, 1)
+			So(results["/k"].Summaries[0].Count, ShouldEqual, 5)
 		})
 
 		Convey("Normal users have access restricted only by group", func() {
@@ -896,6 +3329,29 @@ func testClientsOnRealServer(t *testing.T, username, uid string, gids []string,
 			So(string(json), ShouldNotBeBlank)
 			So(len(dcss), ShouldEqual, 1)
 			So(dcss[0].Count, ShouldEqual, 13)
+
+			results, errg := GetWhereDataIsForDirs(c, []string{"/a/b/e/h", "/a/b/d/i", "/foo"},
+				"", "", "", summary.DGUTAgeAll, "0")
+			So(errg, ShouldBeNil)
+			So(len(results), ShouldEqual, 3)
+
+			So(results["/a/b/e/h"].Error, ShouldBeBlank)
+			So(len(results["/a/b/e/h"].Summaries), ShouldEqual, 1)
+			So(results["/a/b/e/h"].Summaries[0].Count, ShouldEqual, 2)
+
+			So(results["/a/b/d/i"].Error, ShouldBeBlank)
+			So(results["/a/b/d/i"].Summaries, ShouldBeEmpty)
+
+			So(results["/foo"].Error, ShouldEqual, dguta.ErrDirNotFound.Error())
+			So(results["/foo"].Summaries, ShouldBeEmpty)
+
+			results, errg = GetWhereDataIsForDirs(c, []string{"/foo"}, "", "", "", summary.DGUTAgeAll, "0")
+			So(errg, ShouldBeNil)
+			So(results["/foo"].Error, ShouldEqual, ErrBadQuery.Error())
+
+			results, errg = GetWhereDataIsForDirs(c, []string{"/a/b/e/h", "/k"}, "fo#€o", "", "", summary.DGUTAgeAll, "0")
+			So(errg, ShouldEqual, ErrBadQuery)
+			So(results, ShouldBeNil)
 		})
 
 		Convey("Once you add the tree page", func() {
@@ -938,6 +3394,282 @@ func testClientsOnRealServer(t *testing.T, username, uid string, gids []string,
 				So(strings.ToUpper(string(resp.Body())), ShouldStartWith, "<!DOCTYPE HTML>")
 			})
 
+			Convey("You can get the UI config without auth", func() {
+				r := gas.NewClientRequest(addr, cert)
+
+				getConfig := func() *UIConfig {
+					resp, errg := r.Get(EndPointUIConfig)
+					So(errg, ShouldBeNil)
+					So(resp.StatusCode(), ShouldEqual, http.StatusOK)
+
+					var cfg *UIConfig
+
+					errg = json.Unmarshal(resp.Body(), &cfg)
+					So(errg, ShouldBeNil)
+
+					return cfg
+				}
+
+				cfg := getConfig()
+				So(cfg.DefaultSplits, ShouldEqual, defaultSplits)
+				So(len(cfg.AgeLabels), ShouldEqual, len(summary.DirGUTAges))
+				So(cfg.AgeLabels[0], ShouldEqual, "0")
+				So(cfg.AgeLabels[16], ShouldEqual, "16")
+				So(cfg.BannerMessage, ShouldBeBlank)
+				So(cfg.GroupAreasEnabled, ShouldBeFalse)
+
+				expected := UIConfig{
+					DefaultSplits:     4,
+					AgeLabels:         []string{"0", "9"},
+					BannerMessage:     "maintenance tonight",
+					ContactEmail:      "help@example.com",
+					GroupAreasEnabled: true,
+				}
+
+				s.SetUIConfig(expected)
+				So(*getConfig(), ShouldResemble, expected)
+
+				expected = UIConfig{AgeLabels: []string{}}
+
+				s.SetUIConfig(expected)
+				So(*getConfig(), ShouldResemble, expected)
+			})
+
+			Convey("You can get the status of each loaded dataset", func() {
+				mc, err := gas.NewClientCLI(".wrstat.test.mounts.jwt", ".wrstat.test.mounts.servertoken", addr, cert, false)
+				So(err, ShouldBeNil)
+
+				_, err = GetMounts(mc)
+				So(err, ShouldNotBeNil)
+
+				err = mc.Login("user", "pass")
+				So(err, ShouldBeNil)
+
+				mounts, err := GetMounts(mc)
+				So(err, ShouldBeNil)
+				So(len(mounts), ShouldEqual, 1)
+				So(mounts[0].Key, ShouldEqual, s.datasets[0].key)
+				So(mounts[0].Mount, ShouldEqual, s.datasets[0].mount)
+				So(mounts[0].Timestamp, ShouldEqual, s.datasets[0].mtime.Unix())
+
+				resp, err := gas.NewClientRequest(addr, cert).Get(EndPointMounts)
+				So(err, ShouldBeNil)
+				So(resp.StatusCode(), ShouldEqual, http.StatusNotFound)
+			})
+
+			Convey("You can get a file type breakdown of a directory", func() {
+				tc, err := gas.NewClientCLI(".wrstat.test.types.jwt", ".wrstat.test.types.servertoken", addr, cert, false)
+				So(err, ShouldBeNil)
+
+				_, err = GetTypeBreakdown(tc, "/", "")
+				So(err, ShouldNotBeNil)
+
+				err = tc.Login("user", "pass")
+				So(err, ShouldBeNil)
+
+				sumWithoutTemp := func(breakdown map[string]*TypeUsage) (uint64, uint64) {
+					var count, size uint64
+
+					for ft, tu := range breakdown {
+						if ft == summary.DGUTAFileTypeTemp.String() {
+							continue
+						}
+
+						count += tu.Count
+						size += tu.Size
+					}
+
+					return count, size
+				}
+
+				for _, groups := range []string{"", g.Name} {
+					breakdown, err := GetTypeBreakdown(tc, "/a", groups)
+					So(err, ShouldBeNil)
+					So(breakdown["cram"], ShouldNotBeNil)
+					So(breakdown["dir"], ShouldNotBeNil)
+
+					wantGIDs := gids
+					if groups != "" {
+						wantGIDs = []string{g.Gid}
+					}
+
+					filter := &dguta.Filter{}
+
+					for _, gidStr := range wantGIDs {
+						gid, errc := strconv.ParseUint(gidStr, 10, 32)
+						So(errc, ShouldBeNil)
+
+						filter.GIDs = append(filter.GIDs, uint32(gid))
+					}
+
+					di, err := s.tree.DirInfo("/a", filter)
+					So(err, ShouldBeNil)
+
+					count, size := sumWithoutTemp(breakdown)
+					So(count, ShouldEqual, di.Current.Count)
+					So(size, ShouldEqual, di.Current.Size)
+				}
+
+				_, err = GetTypeBreakdown(tc, "/missing", "")
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("You can access version 2 of the where API with auth", func() {
+				r := gas.NewAuthenticatedClientRequest(addr, cert, token)
+				resp, err := r.Get(EndPointAuthV2Where)
+				So(err, ShouldBeNil)
+				So(resp.StatusCode(), ShouldEqual, http.StatusOK)
+
+				var v2 []*DirSummary
+				err = json.Unmarshal(resp.Body(), &v2)
+				So(err, ShouldBeNil)
+
+				resp, err = r.Get(EndPointAuthWhere)
+				So(err, ShouldBeNil)
+				So(resp.StatusCode(), ShouldEqual, http.StatusOK)
+
+				var v1 []*DirSummary
+				err = json.Unmarshal(resp.Body(), &v1)
+				So(err, ShouldBeNil)
+				So(v2, ShouldResemble, v1)
+
+				resp, err = gas.NewClientRequest(addr, cert).Get(EndPointAuthV2Where)
+				So(err, ShouldBeNil)
+				So(resp.StatusCode(), ShouldEqual, http.StatusUnauthorized)
+			})
+
+			Convey("You can get a forecast for a mount", func() {
+				s.SetMountPoints([]string{"/lustre/scratch123/", "/lustre/scratch125/"})
+
+				r := gas.NewAuthenticatedClientRequest(addr, cert, token)
+				resp, err := r.SetResult(&Forecast{}).
+					ForceContentType("application/json").
+					SetQueryParams(map[string]string{"mount": "/lustre/scratch125/", "capacity": "1000000000"}).
+					Get(EndPointAuthForecast)
+				So(err, ShouldBeNil)
+				So(resp.StatusCode(), ShouldEqual, http.StatusOK)
+
+				f := resp.Result().(*Forecast) //nolint:forcetypeassert
+				So(f.Mount, ShouldEqual, "/lustre/scratch125/")
+				So(f.Capacity, ShouldEqual, 1000000000)
+				So(f.UsageSize, ShouldBeGreaterThan, 0)
+				So(f.DateFull.IsZero(), ShouldBeTrue)
+
+				resp, err = gas.NewAuthenticatedClientRequest(addr, cert, token).
+					SetQueryParams(map[string]string{"mount": "/lustre/scratch125/", "window": "0"}).
+					Get(EndPointAuthForecast)
+				So(err, ShouldBeNil)
+				So(resp.StatusCode(), ShouldEqual, http.StatusBadRequest)
+
+				for _, params := range []map[string]string{
+					{"mount": "/tmp"},
+					{"mount": "/lustre/scratch125/", "capacity": "0"},
+				} {
+					resp, err = gas.NewAuthenticatedClientRequest(addr, cert, token).
+						SetQueryParams(params).
+						Get(EndPointAuthForecast)
+					So(err, ShouldBeNil)
+					So(resp.StatusCode(), ShouldEqual, http.StatusBadRequest)
+				}
+
+				s.SetMountPoints([]string{"/"})
+
+				resp, err = gas.NewAuthenticatedClientRequest(addr, cert, token).
+					SetResult(&Forecast{}).
+					ForceContentType("application/json").
+					SetQueryParams(map[string]string{"mount": "/"}).
+					Get(EndPointAuthForecast)
+				So(err, ShouldBeNil)
+				So(resp.StatusCode(), ShouldEqual, http.StatusOK)
+
+				f = resp.Result().(*Forecast) //nolint:forcetypeassert
+				So(f.Capacity, ShouldBeGreaterThan, 0)
+			})
+
+			Convey("You can get the largest directories", func() {
+				topN := func(params map[string]string) ([]*DirSummary, int) {
+					resp, errg := gas.NewAuthenticatedClientRequest(addr, cert, token).
+						SetQueryParams(params).
+						Get(EndPointAuthTreeTopN)
+					So(errg, ShouldBeNil)
+
+					var top []*DirSummary
+
+					if resp.StatusCode() == http.StatusOK {
+						errg = json.Unmarshal(resp.Body(), &top)
+						So(errg, ShouldBeNil)
+					}
+
+					return top, resp.StatusCode()
+				}
+
+				dirsOf := func(top []*DirSummary) []string {
+					dirs := make([]string, len(top))
+					for i, ds := range top {
+						dirs[i] = ds.Dir
+					}
+
+					return dirs
+				}
+
+				top, code := topN(map[string]string{"n": "4"})
+				So(code, ShouldEqual, http.StatusOK)
+				So(dirsOf(top), ShouldResemble, []string{"/a", "/a/b", "/a/b/d", "/a/b/e"})
+				So(top[0].Size, ShouldEqual, 10365)
+
+				top, code = topN(map[string]string{"n": "4", "sortby": "count", "dir": "/a/b"})
+				So(code, ShouldEqual, http.StatusOK)
+				So(dirsOf(top), ShouldResemble, []string{"/a/b/d", "/a/b/d/g", "/a/b/e", "/a/b/e/h"})
+				So(top[0].Count, ShouldEqual, 14)
+
+				top, code = topN(map[string]string{"n": "1", "sortby": "mtime", "dir": "/a/b"})
+				So(code, ShouldEqual, http.StatusOK)
+				So(len(top), ShouldEqual, 1)
+				So(top[0].Mtime.Unix(), ShouldEqual, 80)
+
+				_, code = topN(map[string]string{"sortby": "name"})
+				So(code, ShouldEqual, http.StatusBadRequest)
+
+				_, code = topN(map[string]string{"n": "0"})
+				So(code, ShouldEqual, http.StatusBadRequest)
+			})
+
+			Convey("You can get summaries of a directory's ancestors", func() {
+				resp, err := gas.NewAuthenticatedClientRequest(addr, cert, token).
+					SetQueryParams(map[string]string{"path": "/a/b/d", "types": "cram"}).
+					Get(EndPointAuthTreeAncestors)
+				So(err, ShouldBeNil)
+				So(resp.StatusCode(), ShouldEqual, http.StatusOK)
+
+				var ancestors []*DirSummary
+
+				err = json.Unmarshal(resp.Body(), &ancestors)
+				So(err, ShouldBeNil)
+				So(len(ancestors), ShouldEqual, 4)
+				So(ancestors[0].Dir, ShouldEqual, "/")
+
+				last := ancestors[len(ancestors)-1]
+				So(last.Dir, ShouldEqual, "/a/b/d")
+
+				resp, err = gas.NewAuthenticatedClientRequest(addr, cert, token).
+					SetQueryParams(map[string]string{"dir": "/a/b/d", "splits": "0", "types": "cram"}).
+					Get(EndPointAuthWhere)
+				So(err, ShouldBeNil)
+
+				var where []*DirSummary
+
+				err = json.Unmarshal(resp.Body(), &where)
+				So(err, ShouldBeNil)
+				So(len(where), ShouldEqual, 1)
+				So(last, ShouldResemble, where[0])
+
+				resp, err = gas.NewAuthenticatedClientRequest(addr, cert, token).
+					SetQueryParams(map[string]string{"path": "/foo"}).
+					Get(EndPointAuthTreeAncestors)
+				So(err, ShouldBeNil)
+				So(resp.StatusCode(), ShouldEqual, http.StatusBadRequest)
+			})
+
 			Convey("You can access the tree API", func() {
 				r := gas.NewAuthenticatedClientRequest(addr, cert, token)
 				resp, err := r.SetResult(&TreeElement{}).
@@ -1271,6 +4003,151 @@ func testClientsOnRealServer(t *testing.T, username, uid string, gids []string,
 				areas, err := GetGroupAreas(c)
 				So(err, ShouldBeNil)
 				So(areas, ShouldResemble, expectedAreas)
+
+				tree, err := GetGroupAreaTree(c)
+				So(err, ShouldBeNil)
+				So(len(tree.Children), ShouldEqual, 2)
+				So(tree.Children[0].Name, ShouldEqual, "a")
+
+				expectedTree := &GroupAreaTree{
+					Name:     "a",
+					Groups:   []string{"1"},
+					Children: []*GroupAreaTree{{Name: "b", Groups: []string{"2"}}},
+				}
+
+				s.AddGroupAreaTree(expectedTree)
+
+				tree, err = GetGroupAreaTree(c)
+				So(err, ShouldBeNil)
+				So(tree, ShouldResemble, expectedTree)
+
+				areas, err = GetGroupAreas(c)
+				So(err, ShouldBeNil)
+				So(areas, ShouldResemble, map[string][]string{"a": {"1", "2"}, "b": {"2"}})
+			})
+
+			Convey("You can replace the group areas with a PUT if you're on the whitelist", func() {
+				areasPath := filepath.Join(t.TempDir(), "areas.csv")
+
+				err = os.WriteFile(areasPath, []byte("1,a\n"), 0600)
+				So(err, ShouldBeNil)
+
+				err = s.LoadGroupAreasFile(areasPath)
+				So(err, ShouldBeNil)
+
+				newAreas := map[string][]string{
+					"b": {"2", "3"},
+					"c": {"4"},
+				}
+
+				r := gas.NewAuthenticatedClientRequest(addr, cert, token)
+
+				resp, err := r.SetBody(newAreas).Put(EndPointAuthGroupAreas)
+				So(err, ShouldBeNil)
+				So(resp.StatusCode(), ShouldEqual, http.StatusForbidden)
+
+				s.WhiteListGroups(func(_ string) bool {
+					return true
+				})
+
+				s.userToGIDs = make(map[string][]string)
+
+				for _, bad := range []string{`not json`, `null`, `{"b":[]}`, `{"":["1"]}`, `{"b":[""]}`} {
+					resp, err = r.SetBody(bad).Put(EndPointAuthGroupAreas)
+					So(err, ShouldBeNil)
+					So(resp.StatusCode(), ShouldEqual, http.StatusBadRequest)
+				}
+
+				So(s.groupAreas(), ShouldResemble, map[string][]string{"a": {"1"}})
+
+				var areas map[string][]string
+
+				resp, err = r.SetBody(newAreas).
+					SetResult(&areas).
+					ForceContentType("application/json").
+					Put(EndPointAuthGroupAreas)
+				So(err, ShouldBeNil)
+				So(resp.StatusCode(), ShouldEqual, http.StatusOK)
+				So(areas, ShouldResemble, newAreas)
+
+				c, err = gas.NewClientCLI(jwtBasename, serverTokenBasename, addr, cert, false)
+				So(err, ShouldBeNil)
+
+				err = c.Login("user", "pass")
+				So(err, ShouldBeNil)
+
+				areas, err = GetGroupAreas(c)
+				So(err, ShouldBeNil)
+				So(areas, ShouldResemble, newAreas)
+
+				content, err := os.ReadFile(areasPath)
+				So(err, ShouldBeNil)
+				So(string(content), ShouldEqual, "2,b\n3,b\n4,c\n")
+			})
+
+			Convey("You can get the reload history after EnableDGUTADBReloading() if you're on the whitelist", func() {
+				sentinel := path + ".sentinel"
+
+				file, err := os.Create(sentinel)
+				So(err, ShouldBeNil)
+				err = file.Close()
+				So(err, ShouldBeNil)
+
+				err = s.EnableDGUTADBReloading(sentinel, filepath.Dir(filepath.Dir(path)),
+					internaldb.ExampleDgutaDirParentSuffix, 10*time.Millisecond)
+				So(err, ShouldBeNil)
+
+				r := gas.NewAuthenticatedClientRequest(addr, cert, token)
+
+				resp, err := r.Get(EndPointAuthReloadHistory)
+				So(err, ShouldBeNil)
+				So(resp.StatusCode(), ShouldEqual, http.StatusForbidden)
+
+				s.WhiteListGroups(func(_ string) bool {
+					return true
+				})
+
+				s.userToGIDs = make(map[string][]string)
+
+				s.recordReload("dguta dbs", time.Now(), 1, nil)
+
+				var events []*ReloadEvent
+
+				resp, err = r.SetResult(&events).
+					ForceContentType("application/json").
+					Get(EndPointAuthReloadHistory)
+				So(err, ShouldBeNil)
+				So(resp.StatusCode(), ShouldEqual, http.StatusOK)
+				So(len(events), ShouldEqual, 1)
+				So(events[0].Key, ShouldEqual, "dguta dbs")
+				So(events[0].RecordCount, ShouldEqual, 1)
+			})
+
+			Convey("You can get database info if you're on the whitelist", func() {
+				r := gas.NewAuthenticatedClientRequest(addr, cert, token)
+
+				resp, err := r.Get(EndPointAuthDBInfo)
+				So(err, ShouldBeNil)
+				So(resp.StatusCode(), ShouldEqual, http.StatusForbidden)
+
+				s.WhiteListGroups(func(_ string) bool {
+					return true
+				})
+
+				s.userToGIDs = make(map[string][]string)
+
+				var infos map[string]*dguta.DBInfo
+
+				resp, err = r.SetResult(&infos).
+					ForceContentType("application/json").
+					Get(EndPointAuthDBInfo)
+				So(err, ShouldBeNil)
+				So(resp.StatusCode(), ShouldEqual, http.StatusOK)
+
+				expected, err := dguta.NewDB(path).Info()
+				So(err, ShouldBeNil)
+				So(expected.NumDirs, ShouldBeGreaterThan, 0)
+				So(infos, ShouldResemble, map[string]*dguta.DBInfo{filepath.Base(path): expected})
 			})
 
 			Convey("You can access the secure basedirs endpoints after LoadBasedirsDB()", func() {
@@ -1286,6 +4163,23 @@ func testClientsOnRealServer(t *testing.T, username, uid string, gids []string,
 				So(len(usage), ShouldEqual, 102)
 				So(usage[0].UID, ShouldNotEqual, 0)
 
+				var ageUsage []*basedirs.Usage
+
+				resp, err = r.SetResult(&ageUsage).
+					ForceContentType("application/json").
+					SetQueryParam("age", "0").
+					Get(EndPointAuthBasedirUsageUser)
+				So(err, ShouldBeNil)
+				So(resp.StatusCode(), ShouldEqual, http.StatusOK)
+				So(len(ageUsage), ShouldBeGreaterThan, 0)
+				So(len(ageUsage), ShouldBeLessThan, len(usage))
+
+				r.QueryParam.Del("age")
+
+				for _, u := range ageUsage {
+					So(u.Age, ShouldEqual, summary.DGUTAgeAll)
+				}
+
 				userUsageUID := usage[0].UID
 				userUsageBasedir := usage[0].BaseDir
 
@@ -1362,6 +4256,115 @@ func testClientsOnRealServer(t *testing.T, username, uid string, gids []string,
 					So(resp.Result(), ShouldNotBeNil)
 					So(len(subdirs), ShouldEqual, 2)
 				})
+
+				Convey("and can override a group's quotas if you're on the whitelist", func() {
+					gid := usage[0].GID
+					basedir := usage[0].BaseDir
+					origInodes := usage[0].QuotaInodes
+					overrideURL := EndPointAuthBasedirQuotaOverride + strconv.Itoa(int(gid))
+
+					resp, err = gas.NewAuthenticatedClientRequest(addr, cert, token).SetBody(`{"quota_size":123}`).
+						SetQueryParam("basedir", basedir).
+						Patch(overrideURL)
+					So(err, ShouldBeNil)
+					So(resp.StatusCode(), ShouldEqual, http.StatusForbidden)
+
+					s.WhiteListGroups(func(_ string) bool {
+						return true
+					})
+
+					s.userToGIDs = make(map[string][]string)
+
+					overridesPath := filepath.Join(t.TempDir(), "overrides.json")
+					err = s.SetQuotaOverridesFile(overridesPath)
+					So(err, ShouldBeNil)
+
+					resp, err = gas.NewAuthenticatedClientRequest(addr, cert, token).SetBody(`{}`).
+						SetQueryParam("basedir", basedir).
+						Patch(overrideURL)
+					So(err, ShouldBeNil)
+					So(resp.StatusCode(), ShouldEqual, http.StatusBadRequest)
+
+					var override QuotaOverride
+
+					resp, err = gas.NewAuthenticatedClientRequest(addr, cert, token).SetBody(`{"quota_size":123}`).
+						SetQueryParam("basedir", basedir).
+						SetResult(&override).
+						Patch(overrideURL)
+					So(err, ShouldBeNil)
+					So(resp.StatusCode(), ShouldEqual, http.StatusOK)
+					So(override.GID, ShouldEqual, gid)
+					So(override.BaseDir, ShouldEqual, basedir)
+					So(*override.QuotaSize, ShouldEqual, 123)
+					So(override.QuotaInodes, ShouldBeNil)
+
+					getQuotas := func() (uint64, uint64) {
+						var fresh []*basedirs.Usage
+
+						_, errg := gas.NewAuthenticatedClientRequest(addr, cert, token).SetResult(&fresh).
+							ForceContentType("application/json").
+							Get(EndPointAuthBasedirUsageGroup)
+						So(errg, ShouldBeNil)
+
+						for _, u := range fresh {
+							if u.GID == gid && u.BaseDir == basedir && u.Age == summary.DGUTAgeAll {
+								return u.QuotaSize, u.QuotaInodes
+							}
+						}
+
+						return 0, 0
+					}
+
+					size, inodes := getQuotas()
+					So(size, ShouldEqual, 123)
+					So(inodes, ShouldEqual, origInodes)
+
+					resp, err = gas.NewAuthenticatedClientRequest(addr, cert, token).SetBody(`{"quota_inodes":45}`).
+						SetQueryParam("basedir", basedir).
+						SetResult(&override).
+						Patch(overrideURL)
+					So(err, ShouldBeNil)
+					So(resp.StatusCode(), ShouldEqual, http.StatusOK)
+					So(*override.QuotaSize, ShouldEqual, 123)
+					So(*override.QuotaInodes, ShouldEqual, 45)
+
+					size, inodes = getQuotas()
+					So(size, ShouldEqual, 123)
+					So(inodes, ShouldEqual, 45)
+
+					Convey("which persist across reloads if saved to a file", func() {
+						s.basedirsMutex.Lock()
+						s.resetQuotaOverrides()
+						s.basedirsMutex.Unlock()
+
+						size, inodes = getQuotas()
+						So(size, ShouldEqual, 123)
+						So(inodes, ShouldEqual, 45)
+
+						s.basedirsMutex.Lock()
+						s.overridesPath = ""
+						s.resetQuotaOverrides()
+						s.basedirsMutex.Unlock()
+
+						size, inodes = getQuotas()
+						So(size, ShouldEqual, usage[0].QuotaSize)
+						So(inodes, ShouldEqual, origInodes)
+					})
+
+					Convey("which can be cleared", func() {
+						resp, err = gas.NewAuthenticatedClientRequest(addr, cert, token).SetQueryParam("basedir", basedir).Delete(overrideURL)
+						So(err, ShouldBeNil)
+						So(resp.StatusCode(), ShouldEqual, http.StatusNoContent)
+
+						size, inodes = getQuotas()
+						So(size, ShouldEqual, usage[0].QuotaSize)
+						So(inodes, ShouldEqual, origInodes)
+
+						data, errr := os.ReadFile(overridesPath)
+						So(errr, ShouldBeNil)
+						So(string(data), ShouldEqual, "[]")
+					})
+				})
 			})
 		})
 	})
@@ -1377,6 +4380,25 @@ func query(s *Server, endpoint, extra string) (*httptest.ResponseRecorder, error
 	return gas.QueryREST(s.Router(), endpoint, extra)
 }
 
+// queryWithHeaders does a GET on the given endpoint of our Server with the
+// given request headers.
+func queryWithHeaders(s *Server, endpoint string, headers map[string]string) (*httptest.ResponseRecorder, error) {
+	response := httptest.NewRecorder()
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	s.Router().ServeHTTP(response, req)
+
+	return response, nil
+}
+
 // decodeWhereResult decodes the result of a Where query.
 func decodeWhereResult(response *httptest.ResponseRecorder) ([]*DirSummary, error) {
 	var result []*DirSummary
@@ -1710,6 +4732,46 @@ func createExampleBasedirsDB(t *testing.T, tree *dguta.Tree) (string, string, er
 	return dbPath, ownersPath, err
 }
 
+// waitForOwnerOfGID queries group usage until the given gid is reported with
+// the given owner, returning false if that doesn't happen within a second.
+// waitForGroupAreas waits for the given server's group areas to become the
+// expected ones, returning false if they don't within a second.
+func waitForGroupAreas(s *Server, expected map[string][]string) bool {
+	for i := 0; i < 100; i++ {
+		if reflect.DeepEqual(s.groupAreas(), expected) {
+			return true
+		}
+
+		<-time.After(10 * time.Millisecond)
+	}
+
+	return false
+}
+
+func waitForOwnerOfGID(s *Server, gid uint32, owner string) bool {
+	for i := 0; i < 100; i++ {
+		response, err := query(s, EndPointBasedirUsageGroup, "")
+		if err != nil {
+			return false
+		}
+
+		usage, err := decodeUsageResult(response)
+		if err != nil {
+			return false
+		}
+
+		for _, u := range usage {
+			if u.GID == gid && u.Owner == owner {
+				return true
+			}
+		}
+
+		<-time.After(10 * time.Millisecond)
+	}
+
+	return false
+}
+
 // decodeUsageResult decodes the result of a basedirs usage query.
 func decodeUsageResult(response *httptest.ResponseRecorder) ([]*basedirs.Usage, error) {
 	var result []*basedirs.Usage
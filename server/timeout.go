@@ -0,0 +1,96 @@
+/*******************************************************************************
+ * Copyright (c) 2024 Genome Research Ltd.
+ *
+ * Author: Sendu Bala <sb10@sanger.ac.uk>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining
+ * a copy of this software and associated documentation files (the
+ * "Software"), to deal in the Software without restriction, including
+ * without limitation the rights to use, copy, modify, merge, publish,
+ * distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so, subject to
+ * the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included
+ * in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+ * CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+ * TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ ******************************************************************************/
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	gas "github.com/wtsi-hgi/go-authserver"
+)
+
+const (
+	// DefaultQueryTimeout is the QueryTimeout used by new Servers.
+	DefaultQueryTimeout = 30 * time.Second
+
+	ErrQueryTimeout = gas.Error("query timeout")
+)
+
+// SetQueryTimeout sets the maximum time the tree and where endpoints will wait
+// for a database query before giving up and responding with a 504. A timeout of
+// 0 means queries never time out. Defaults to DefaultQueryTimeout.
+func (s *Server) SetQueryTimeout(timeout time.Duration) {
+	s.queryTimeout = timeout
+}
+
+// runQuery calls the given query func, waiting at most our queryTimeout for it
+// to complete. If it doesn't complete in time, responds with a 504 and returns
+// false, in which case you must not make use of anything the query func sets.
+//
+// The query func is given a context that is done once the timeout passes (or
+// the client goes away), and it should check that between its database lookups
+// and stop early, so that it doesn't hold the tree read lock any longer than
+// necessary: while it does, reloading databases has to wait, and so then do
+// any new readers. The query continues in the background until it notices, so
+// it must do its own locking of any shared state. How long it took is recorded
+// in our metrics once it completes.
+func (s *Server) runQuery(c *gin.Context, query func(ctx context.Context)) bool {
+	name := queryName(c)
+	start := time.Now()
+
+	if s.queryTimeout <= 0 {
+		query(c.Request.Context())
+		s.metrics.observeQuery(name, time.Since(start))
+
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), s.queryTimeout)
+	defer cancel()
+
+	done := make(chan struct{})
+
+	go func() {
+		query(ctx)
+		s.metrics.observeQuery(name, time.Since(start))
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+
+	if ctx.Err() != nil {
+		c.AbortWithStatusJSON(http.StatusGatewayTimeout, gin.H{"error": ErrQueryTimeout.Error()})
+
+		return false
+	}
+
+	return true
+}
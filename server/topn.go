@@ -0,0 +1,216 @@
+/*******************************************************************************
+ * Copyright (c) 2024 Genome Research Ltd.
+ *
+ * Author: Sendu Bala <sb10@sanger.ac.uk>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining
+ * a copy of this software and associated documentation files (the
+ * "Software"), to deal in the Software without restriction, including
+ * without limitation the rights to use, copy, modify, merge, publish,
+ * distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so, subject to
+ * the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included
+ * in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+ * CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+ * TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ ******************************************************************************/
+
+package server
+
+import (
+	"container/heap"
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	gas "github.com/wtsi-hgi/go-authserver"
+	"github.com/wtsi-ssg/wrstat/v5/dguta"
+)
+
+const (
+	// SortBy* are the values that the top-n endpoint's sortby parameter
+	// accepts.
+	SortBySize  = "size"
+	SortByCount = "count"
+	SortByMtime = "mtime"
+
+	defaultTopN = 10
+
+	// DefaultTopNMaxDirs is the TopNMaxDirs used by new Servers.
+	DefaultTopNMaxDirs = 100000
+
+	ErrBadTopNQuery    = gas.Error("bad query; n must be a positive number and sortby one of size, count or mtime")
+	ErrTopNTooManyDirs = gas.Error("too many directories to search; try a deeper dir")
+)
+
+// SetTopNMaxDirs sets the most directories a top-n query will look up before
+// giving up with ErrTopNTooManyDirs. Defaults to DefaultTopNMaxDirs.
+func (s *Server) SetTopNMaxDirs(n int) {
+	s.topNMaxDirs = n
+}
+
+// dcsLess returns true if a sorts lower than b by the given sortBy.
+func dcsLess(a, b *dguta.DirSummary, sortBy string) bool {
+	switch sortBy {
+	case SortByCount:
+		return a.Count < b.Count
+	case SortByMtime:
+		return a.Mtime.Before(b.Mtime)
+	default:
+		return a.Size < b.Size
+	}
+}
+
+// dcsMinHeap is a container/heap of DirSummarys with the lowest (by sortBy) on
+// top.
+type dcsMinHeap struct {
+	dcss   dguta.DCSs
+	sortBy string
+}
+
+func (h *dcsMinHeap) Len() int           { return len(h.dcss) }
+func (h *dcsMinHeap) Less(i, j int) bool { return dcsLess(h.dcss[i], h.dcss[j], h.sortBy) }
+func (h *dcsMinHeap) Swap(i, j int)      { h.dcss[i], h.dcss[j] = h.dcss[j], h.dcss[i] }
+
+func (h *dcsMinHeap) Push(x any) {
+	h.dcss = append(h.dcss, x.(*dguta.DirSummary)) //nolint:forcetypeassert
+}
+
+func (h *dcsMinHeap) Pop() any {
+	old := h.dcss
+	last := old[len(old)-1]
+	h.dcss = old[:len(old)-1]
+
+	return last
+}
+
+// getTopN responds with the n largest (by the sortby parameter) directories
+// nested under dir that have files passing the usual where filter parameters.
+// LoadDGUTADB() must already have been called. This is called when there is a
+// GET on /rest/v1/auth/tree/topn.
+func (s *Server) getTopN(c *gin.Context) {
+	dir := c.DefaultQuery("dir", defaultDir)
+	sortBy := c.DefaultQuery("sortby", SortBySize)
+
+	n, err := strconv.Atoi(c.DefaultQuery("n", strconv.Itoa(defaultTopN)))
+	if err != nil || n < 1 || (sortBy != SortBySize && sortBy != SortByCount && sortBy != SortByMtime) {
+		c.AbortWithError(http.StatusBadRequest, ErrBadTopNQuery) //nolint:errcheck
+
+		return
+	}
+
+	filter, err := s.makeRestrictedFilterFromContext(c)
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, err) //nolint:errcheck
+
+		return
+	}
+
+	var dcss dguta.DCSs
+
+	if !s.runQuery(c, func(ctx context.Context) {
+		s.treeMutex.RLock()
+		defer s.treeMutex.RUnlock()
+
+		dcss, err = s.topN(ctx, dir, filter, n, sortBy)
+	}) {
+		return
+	}
+
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, err) //nolint:errcheck
+
+		return
+	}
+
+	setQueryRows(c, len(dcss))
+	respond(c, http.StatusOK, s.dcssToSummaries(dcss))
+}
+
+// topN walks the directories nested under dir that have files passing the
+// filter, returning the n largest by sortBy, largest first. dir itself is not
+// included.
+//
+// A directory's size, count and mtime are never less than those of anything
+// nested under it, so once we have n results, a directory that can't beat the
+// smallest of them is skipped along with everything under it. Children are
+// visited largest first, so that happens as soon as possible.
+//
+// If more than our topNMaxDirs directories would need to be looked up, it
+// gives up with ErrTopNTooManyDirs. It gives up with the context's error once
+// ctx is done.
+func (s *Server) topN(ctx context.Context, dir string, filter *dguta.Filter, n int,
+	sortBy string) (dguta.DCSs, error) {
+	h := &dcsMinHeap{sortBy: sortBy}
+	toVisit := []*dguta.DirSummary{{Dir: dir}}
+	canBeat := func(ds *dguta.DirSummary) bool {
+		return h.Len() < n || dcsLess(h.dcss[0], ds, sortBy)
+	}
+
+	lookups := 0
+
+	for len(toVisit) > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		ds := toVisit[len(toVisit)-1]
+		toVisit = toVisit[:len(toVisit)-1]
+
+		if !canBeat(ds) {
+			continue
+		}
+
+		if lookups >= s.topNMaxDirs {
+			return nil, ErrTopNTooManyDirs
+		}
+
+		lookups++
+
+		di, err := s.tree.DirInfo(ds.Dir, filter)
+		if err != nil {
+			return nil, err
+		}
+
+		if di == nil {
+			continue
+		}
+
+		sort.Slice(di.Children, func(i, j int) bool {
+			return dcsLess(di.Children[i], di.Children[j], sortBy)
+		})
+
+		for _, child := range di.Children {
+			if !canBeat(child) {
+				continue
+			}
+
+			toVisit = append(toVisit, child)
+
+			if h.Len() < n {
+				heap.Push(h, child)
+			} else {
+				h.dcss[0] = child
+				heap.Fix(h, 0)
+			}
+		}
+	}
+
+	dcss := make(dguta.DCSs, h.Len())
+
+	for i := len(dcss) - 1; i >= 0; i-- {
+		dcss[i] = heap.Pop(h).(*dguta.DirSummary) //nolint:forcetypeassert
+	}
+
+	return dcss, nil
+}
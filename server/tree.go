@@ -26,6 +26,7 @@
 package server
 
 import (
+	"context"
 	"io/fs"
 	"net/http"
 	"os"
@@ -44,8 +45,10 @@ import (
 const javascriptToJSONFormat = "2006-01-02T15:04:05.999Z"
 
 // AddTreePage adds the /tree static web page to the server, along with the
-// /rest/v1/auth/tree endpoint. It only works if EnableAuth() has been called
-// first.
+// /rest/v1/auth/tree endpoint (which gzip compresses large responses for
+// clients that accept that) and the /rest/v1/auth/tree/topn,
+// /rest/v1/auth/tree/types and /rest/v1/auth/tree/ancestors endpoints. It only
+// works if EnableAuth() has been called first.
 func (s *Server) AddTreePage() error {
 	authGroup := s.AuthRouter()
 	if authGroup == nil {
@@ -65,7 +68,12 @@ func (s *Server) AddTreePage() error {
 		staticServer.ServeHTTP(c.Writer, c.Request)
 	})
 
-	authGroup.GET(TreePath, s.getTree)
+	s.Router().GET(EndPointUIConfig, s.getUIConfig)
+
+	authGroup.GET(TreePath, gzipResponse, s.getTree)
+	authGroup.GET(topNPath, s.getTopN)
+	authGroup.GET(typesPath, s.getTypeBreakdown)
+	authGroup.GET(ancestorsPath, s.getAncestors)
 
 	return nil
 }
@@ -87,25 +95,6 @@ func getStaticFS() fs.FS {
 	return fsys
 }
 
-// AddGroupAreas takes a map of area keys and group slice values. Clients will
-// then receive this map on TreeElements in the "areas" field.
-//
-// If EnableAuth() has been called, also creates the /auth/group-areas endpoint
-// that returns the given value.
-func (s *Server) AddGroupAreas(areas map[string][]string) {
-	s.areas = areas
-
-	authGroup := s.AuthRouter()
-	if authGroup != nil {
-		authGroup.GET(groupAreasPaths, s.getGroupAreas)
-	}
-}
-
-// getGroupAreas serves up our areas hash as JSON.
-func (s *Server) getGroupAreas(c *gin.Context) {
-	c.IndentedJSON(http.StatusOK, s.areas)
-}
-
 // TreeElement holds tree.DirInfo type information in a form suited to passing
 // to the treemap web interface. It also includes the server's dataTimeStamp so
 // interfaces can report on how long ago the data forming the tree was
@@ -141,24 +130,37 @@ func (s *Server) getTree(c *gin.Context) {
 		return
 	}
 
-	s.treeMutex.RLock()
-	defer s.treeMutex.RUnlock()
-
-	di, err := s.tree.DirInfo(path, filter)
+	allowedGIDs, err := s.allowedGIDs(c)
 	if err != nil {
 		c.AbortWithError(http.StatusBadRequest, err) //nolint:errcheck
 
 		return
 	}
 
-	allowedGIDs, err := s.allowedGIDs(c)
+	var te *TreeElement
+
+	if !s.runQuery(c, func(context.Context) {
+		s.treeMutex.RLock()
+		defer s.treeMutex.RUnlock()
+
+		var di *dguta.DirInfo
+
+		di, err = s.tree.DirInfo(path, filter)
+		if err == nil {
+			te = s.diToTreeElement(di, filter, allowedGIDs, path)
+		}
+	}) {
+		return
+	}
+
 	if err != nil {
 		c.AbortWithError(http.StatusBadRequest, err) //nolint:errcheck
 
 		return
 	}
 
-	c.JSON(http.StatusOK, s.diToTreeElement(di, filter, allowedGIDs, path))
+	setQueryRows(c, 1+len(te.Children))
+	c.JSON(http.StatusOK, te)
 }
 
 // diToTreeElement converts the given dguta.DirInfo to our own TreeElement. It
@@ -171,7 +173,7 @@ func (s *Server) diToTreeElement(di *dguta.DirInfo, filter *dguta.Filter,
 		return &TreeElement{Path: path}
 	}
 	te := s.ddsToTreeElement(di.Current, allowedGIDs)
-	te.Areas = s.areas
+	te.Areas = s.groupAreas()
 	te.HasChildren = len(di.Children) > 0
 
 	if te.NoAuth {
@@ -0,0 +1,122 @@
+/*******************************************************************************
+ * Copyright (c) 2024 Genome Research Ltd.
+ *
+ * Author: Sendu Bala <sb10@sanger.ac.uk>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining
+ * a copy of this software and associated documentation files (the
+ * "Software"), to deal in the Software without restriction, including
+ * without limitation the rights to use, copy, modify, merge, publish,
+ * distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so, subject to
+ * the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included
+ * in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+ * CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+ * TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ ******************************************************************************/
+
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wtsi-ssg/wrstat/v5/dguta"
+	"github.com/wtsi-ssg/wrstat/v5/summary"
+)
+
+// allFileTypes are all the file types, including directories.
+var allFileTypes = append(append([]summary.DirGUTAFileType{}, //nolint:gochecknoglobals
+	summary.AllTypesExceptDirectories...), summary.DGUTAFileTypeDir)
+
+// TypeUsage is the number and total size of files of a particular type.
+type TypeUsage struct {
+	Count uint64
+	Size  uint64
+}
+
+// getTypeBreakdown responds with a map of file type name to the TypeUsage of
+// files of that type nested under the dir parameter, optionally restricted
+// to those belonging to the comma-separated groups parameter. Types with no
+// files are left out.
+//
+// Temporary files are counted under "temp" as well as under their actual
+// type, so the breakdown excluding "temp" sums to the total for dir.
+//
+// LoadDGUTADB() must already have been called. This is called when there is a
+// GET on /rest/v1/auth/tree/types.
+func (s *Server) getTypeBreakdown(c *gin.Context) {
+	dir := c.DefaultQuery("dir", defaultDir)
+
+	gids, err := s.getRestrictedGIDs(c, c.Query("groups"))
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, err) //nolint:errcheck
+
+		return
+	}
+
+	var breakdown map[string]*TypeUsage
+
+	if !s.runQuery(c, func(ctx context.Context) {
+		s.treeMutex.RLock()
+		defer s.treeMutex.RUnlock()
+
+		breakdown, err = s.typeBreakdown(ctx, dir, gids)
+	}) {
+		return
+	}
+
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, err) //nolint:errcheck
+
+		return
+	}
+
+	setQueryRows(c, len(breakdown))
+	respond(c, http.StatusOK, breakdown)
+}
+
+// typeBreakdown returns the TypeUsage of each file type nested under dir and
+// belonging to one of the given gids (or any group, if none are given). You
+// must hold the tree read lock. It gives up with the context's error once ctx
+// is done.
+//
+// dir is looked up once with all file types to find out which types it has,
+// and then once for each of those, since dguta can't total them up by type in
+// a single pass. Types it doesn't have aren't looked up at all.
+func (s *Server) typeBreakdown(ctx context.Context, dir string, gids []uint32) (map[string]*TypeUsage, error) {
+	breakdown := make(map[string]*TypeUsage)
+
+	di, err := s.tree.DirInfo(dir, &dguta.Filter{GIDs: gids, FTs: allFileTypes})
+	if err != nil || di == nil {
+		return breakdown, err
+	}
+
+	for _, ft := range di.Current.FTs {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		ftDI, err := s.tree.DirInfo(dir, &dguta.Filter{GIDs: gids, FTs: []summary.DirGUTAFileType{ft}})
+		if err != nil {
+			return nil, err
+		}
+
+		if ftDI == nil || ftDI.Current.Count == 0 {
+			continue
+		}
+
+		breakdown[ft.String()] = &TypeUsage{Count: ftDI.Current.Count, Size: ftDI.Current.Size}
+	}
+
+	return breakdown, nil
+}
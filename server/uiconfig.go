@@ -0,0 +1,93 @@
+/*******************************************************************************
+ * Copyright (c) 2024 Genome Research Ltd.
+ *
+ * Author: Sendu Bala <sb10@sanger.ac.uk>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining
+ * a copy of this software and associated documentation files (the
+ * "Software"), to deal in the Software without restriction, including
+ * without limitation the rights to use, copy, modify, merge, publish,
+ * distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so, subject to
+ * the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included
+ * in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+ * CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+ * TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ ******************************************************************************/
+
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	gas "github.com/wtsi-hgi/go-authserver"
+	"github.com/wtsi-ssg/wrstat/v5/summary"
+)
+
+const (
+	uiConfigPath = "/ui-config"
+
+	// EndPointUIConfig is the unauthenticated endpoint the tree page uses to
+	// get deployment-specific display options.
+	EndPointUIConfig = gas.EndPointREST + uiConfigPath
+)
+
+// UIConfig holds deployment-specific options for the tree page, so that they
+// can be changed without rebuilding the embedded static files.
+type UIConfig struct {
+	DefaultSplits     int      `json:"defaultSplits"`
+	AgeLabels         []string `json:"ageLabels"`
+	BannerMessage     string   `json:"bannerMessage"`
+	ContactEmail      string   `json:"contactEmail"`
+	GroupAreasEnabled bool     `json:"groupAreasEnabled"`
+}
+
+// SetUIConfig sets the config served by EndPointUIConfig once AddTreePage()
+// has been called. If never called, sane defaults are served instead.
+func (s *Server) SetUIConfig(cfg UIConfig) {
+	s.uiConfigMutex.Lock()
+	defer s.uiConfigMutex.Unlock()
+
+	s.uiConfig = &cfg
+}
+
+// getUIConfig serves up our UIConfig as JSON.
+func (s *Server) getUIConfig(c *gin.Context) {
+	s.uiConfigMutex.RLock()
+	defer s.uiConfigMutex.RUnlock()
+
+	if s.uiConfig == nil {
+		c.JSON(http.StatusOK, s.defaultUIConfig())
+
+		return
+	}
+
+	c.JSON(http.StatusOK, s.uiConfig)
+}
+
+// defaultUIConfig returns the UIConfig used when SetUIConfig() hasn't been
+// called: the default where splits, every age filter, and group areas enabled
+// if AddGroupAreas() was given some.
+func (s *Server) defaultUIConfig() *UIConfig {
+	labels := make([]string, len(summary.DirGUTAges))
+
+	for i, age := range summary.DirGUTAges {
+		labels[i] = strconv.Itoa(int(age))
+	}
+
+	return &UIConfig{
+		DefaultSplits:     defaultSplits,
+		AgeLabels:         labels,
+		GroupAreasEnabled: len(s.groupAreas()) > 0,
+	}
+}
@@ -26,43 +26,301 @@
 package server
 
 import (
+	"context"
+	"encoding/json"
 	"net/http"
+	"slices"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	gas "github.com/wtsi-hgi/go-authserver"
 	"github.com/wtsi-hgi/wrstat-ui/internal/split"
+	"github.com/wtsi-ssg/wrstat/v5/dguta"
+	"github.com/wtsi-ssg/wrstat/v5/summary"
 )
 
 const (
 	defaultSplits    = 2
 	defaultSplitsStr = "2"
+
+	// GroupByGroup and GroupByUser are the values that the where endpoint's
+	// groupBy parameter accepts.
+	GroupByGroup = "group"
+	GroupByUser  = "user"
+
+	ErrBadGroupBy  = gas.Error("bad query; groupBy must be group or user")
+	ErrBadCollapse = gas.Error("bad query; collapse must be true or false")
+
+	ndjsonContentType = "application/x-ndjson"
 )
 
 // getWhere responds with a list of directory stats describing where data is on
 // disks. LoadDGUTADB() must already have been called. This is called when there
-// is a GET on /rest/v1/where or /rest/v1/auth/where.
+// is a GET on /rest/v1/where or /rest/v1/auth/where (or their /rest/v2
+// equivalents).
+//
+// The splits parameter (default 2) controls how deep into dir the results go;
+// see the split package for exactly which directories are returned. Supply a
+// collapse parameter of false to stop chains of directories with a single
+// child being collapsed in to their deepest member.
+//
+// If the request's Accept header is application/x-ndjson, the summaries are
+// streamed one JSON object per line, instead of as a JSON array.
+//
+// If the groupBy parameter is supplied, the response instead has one entry per
+// group (or user) that owns filter-passing files nested under dir; see
+// pivotWhere().
+//
+// If the dir parameter is supplied more than once, the response is instead a
+// JSON object keyed on each dir, with values being WhereResults; see
+// getWhereDirs().
+//
+// Instead of an age, you can supply an atimeBefore or mtimeBefore parameter
+// with an RFC3339 time; the closest age bucket that doesn't include files newer
+// than that is used, and given in the AppliedAgeHeader of the response. See
+// ageBucketFor().
+//
+// Bad groups, users, types or age parameters get a 400 response with a JSON
+// body like {"error":"not a valid age: 99 (must be 0 to 16)"}.
 func (s *Server) getWhere(c *gin.Context) {
-	dir := c.DefaultQuery("dir", defaultDir)
+	dirs := c.QueryArray("dir")
 	splits := c.DefaultQuery("splits", defaultSplitsStr)
+	groupBy := c.Query("groupBy")
+
+	if groupBy != "" && groupBy != GroupByGroup && groupBy != GroupByUser {
+		c.AbortWithError(http.StatusBadRequest, ErrBadGroupBy) //nolint:errcheck
+
+		return
+	}
+
+	collapse, err := strconv.ParseBool(c.DefaultQuery("collapse", "true"))
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, ErrBadCollapse) //nolint:errcheck
+
+		return
+	}
 
 	filter, err := s.makeRestrictedFilterFromContext(c)
+	if err == nil {
+		err = s.addAgeCutoffToFilter(c, filter)
+	}
+
+	if err == nil {
+		err = validateFilter(filter)
+	}
+
 	if err != nil {
-		c.AbortWithError(http.StatusBadRequest, err) //nolint:errcheck
+		c.Error(err) //nolint:errcheck
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+		return
+	}
+
+	if len(dirs) > 1 {
+		s.getWhereDirs(c, dirs, filter, splits, groupBy, collapse)
 
 		return
 	}
 
-	s.treeMutex.Lock()
-	defer s.treeMutex.Unlock()
+	dir := defaultDir
+	if len(dirs) == 1 {
+		dir = dirs[0]
+	}
+
+	var dcss dguta.DCSs
+
+	if !s.runQuery(c, func(ctx context.Context) {
+		s.treeMutex.RLock()
+		defer s.treeMutex.RUnlock()
+
+		dcss, err = s.where(ctx, dir, filter, splits, groupBy, collapse)
+	}) {
+		return
+	}
 
-	dcss, err := s.tree.Where(dir, filter, convertSplitsValue(splits))
 	if err != nil {
 		c.AbortWithError(http.StatusBadRequest, err) //nolint:errcheck
 
 		return
 	}
 
-	c.IndentedJSON(http.StatusOK, s.dcssToSummaries(dcss))
+	summaries := s.dcssToSummaries(dcss)
+
+	setQueryRows(c, len(summaries))
+
+	if wantsNDJSON(c) {
+		streamNDJSON(c, summaries)
+
+		return
+	}
+
+	respond(c, http.StatusOK, summaries)
+}
+
+// WhereResult is the result of a where query on one of several dirs: either
+// the Summaries, or the Error that prevented them being found.
+type WhereResult struct {
+	Summaries []*DirSummary `json:"summaries,omitempty"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// getWhereDirs responds with a map of each of the given dirs to the
+// WhereResult of doing a where query on it with the given filter, splits and
+// groupBy. Errors for particular dirs (eg. "directory not found") are reported
+// in their WhereResult, and do not prevent the other dirs being queried.
+func (s *Server) getWhereDirs(c *gin.Context, dirs []string, filter *dguta.Filter, splits, groupBy string,
+	collapse bool) {
+	dirDCSs := make([]dguta.DCSs, len(dirs))
+	errs := make([]error, len(dirs))
+
+	if !s.runQuery(c, func(ctx context.Context) {
+		s.treeMutex.RLock()
+		defer s.treeMutex.RUnlock()
+
+		for i, dir := range dirs {
+			dirFilter := *filter
+
+			dirDCSs[i], errs[i] = s.where(ctx, dir, &dirFilter, splits, groupBy, collapse)
+		}
+	}) {
+		return
+	}
+
+	results := make(map[string]*WhereResult, len(dirs))
+	rows := 0
+
+	for i, dir := range dirs {
+		if errs[i] != nil {
+			results[dir] = &WhereResult{Error: errs[i].Error()}
+
+			continue
+		}
+
+		results[dir] = &WhereResult{Summaries: s.dcssToSummaries(dirDCSs[i])}
+		rows += len(dirDCSs[i])
+	}
+
+	setQueryRows(c, rows)
+
+	respond(c, http.StatusOK, results)
+}
+
+// where does a where query on the given dir, or a pivotWhere() if groupBy is
+// not blank. It gives up with the context's error once ctx is done. You must
+// hold the tree read lock.
+func (s *Server) where(ctx context.Context, dir string, filter *dguta.Filter, splits, groupBy string,
+	collapse bool) (dguta.DCSs, error) {
+	if groupBy == "" {
+		return s.whereSplits(ctx, dir, filter, convertSplitsValue(splits), collapse)
+	}
+
+	return s.pivotWhere(ctx, dir, filter, groupBy)
+}
+
+// whereSplits returns summaries of dir and its descendants down to the depth
+// the splitFn gives, following the contract described in the split package.
+// With collapse true, the results are the same as dguta.Tree.Where() would
+// give. With it false, chains of directories with a single child aren't
+// collapsed in to their deepest member. You must hold the tree read lock.
+func (s *Server) whereSplits(ctx context.Context, dir string, filter *dguta.Filter, splitFn split.SplitFn,
+	collapse bool) (dguta.DCSs, error) {
+	if filter.FTs == nil {
+		filter.FTs = summary.AllTypesExceptDirectories
+	}
+
+	dcss, err := s.recurseWhere(ctx, dir, filter, splitFn, collapse, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Sort(dcss)
+
+	return dcss, nil
+}
+
+// recurseWhere returns the summary of dir (or the directory its chain
+// collapses to), which is step levels below the queried directory, followed by
+// those of its descendants that splitFn says we should include. When not
+// collapsing, children that won't be recursed in to are taken from dir's
+// DirInfo(), rather than being looked up again.
+func (s *Server) recurseWhere(ctx context.Context, dir string, filter *dguta.Filter, splitFn split.SplitFn,
+	collapse bool, step int) (dguta.DCSs, error) {
+	di, err := s.whereDirInfo(ctx, dir, filter, collapse)
+	if err != nil || di == nil {
+		return nil, err
+	}
+
+	dcss := dguta.DCSs{di.Current}
+
+	if splitFn(dir) <= step {
+		return dcss, nil
+	}
+
+	for _, child := range di.Children {
+		if !collapse && splitFn(child.Dir) <= step+1 {
+			dcss = append(dcss, child)
+
+			continue
+		}
+
+		childDCSs, err := s.recurseWhere(ctx, child.Dir, filter, splitFn, collapse, step+1)
+		if err != nil {
+			return nil, err
+		}
+
+		dcss = append(dcss, childDCSs...)
+	}
+
+	return dcss, nil
+}
+
+// whereDirInfo returns the DirInfo() of dir. If collapse is true, it instead
+// returns that of the deepest directory in the chain under dir where each
+// member has a single child containing all the same files. It returns the
+// context's error instead of doing any more lookups once ctx is done.
+func (s *Server) whereDirInfo(ctx context.Context, dir string, filter *dguta.Filter,
+	collapse bool) (*dguta.DirInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	di, err := s.tree.DirInfo(dir, filter)
+
+	for err == nil && di != nil && collapse && di.IsSameAsChild() {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		di, err = s.tree.DirInfo(di.Children[0].Dir, filter)
+	}
+
+	return di, err
+}
+
+// wantsNDJSON returns true if the request's Accept header asks for
+// newline-delimited JSON.
+func wantsNDJSON(c *gin.Context) bool {
+	return strings.Contains(c.GetHeader("Accept"), ndjsonContentType)
+}
+
+// streamNDJSON responds with each of the given summaries as a JSON object on
+// its own line, flushing after each one so clients can process them as they
+// arrive.
+func streamNDJSON(c *gin.Context, summaries []*DirSummary) {
+	c.Header("Content-Type", ndjsonContentType)
+	c.Status(http.StatusOK)
+
+	enc := json.NewEncoder(c.Writer)
+
+	for _, ds := range summaries {
+		if err := enc.Encode(ds); err != nil {
+			return
+		}
+
+		c.Writer.Flush()
+	}
 }
 
 // convertSplitsValue returns a split.SplitFn that always returns the value
@@ -76,3 +334,63 @@ func convertSplitsValue(splits string) split.SplitFn {
 
 	return split.SplitsToSplitFn(int(splitsN))
 }
+
+// pivotWhere returns a DirSummary of dir for each group (if groupBy is
+// GroupByGroup) or user (if GroupByUser) that owns files nested under dir that
+// pass the filter. Each summary only covers that group's or user's files, so
+// the summaries' counts and sizes sum to those of dir as a whole.
+//
+// The tree is queried once for dir as a whole and then once per group or user,
+// since dguta has no way to look up dir's GUTAs in a single pass.
+//
+// The returned DirSummarys are sorted by Size, largest first, then by group or
+// user ID.
+func (s *Server) pivotWhere(ctx context.Context, dir string, filter *dguta.Filter,
+	groupBy string) (dguta.DCSs, error) {
+	if filter.FTs == nil {
+		filter.FTs = summary.AllTypesExceptDirectories
+	}
+
+	di, err := s.tree.DirInfo(dir, filter)
+	if err != nil || di == nil {
+		return nil, err
+	}
+
+	ids := slices.Clone(di.Current.GIDs)
+	if groupBy == GroupByUser {
+		ids = slices.Clone(di.Current.UIDs)
+	}
+
+	slices.Sort(ids)
+
+	dcss := make(dguta.DCSs, 0, len(ids))
+
+	for _, id := range ids {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		idFilter := *filter
+
+		if groupBy == GroupByUser {
+			idFilter.UIDs = []uint32{id}
+		} else {
+			idFilter.GIDs = []uint32{id}
+		}
+
+		idDI, err := s.tree.DirInfo(dir, &idFilter)
+		if err != nil {
+			return nil, err
+		}
+
+		if idDI == nil || idDI.Current.Count == 0 {
+			continue
+		}
+
+		dcss = append(dcss, idDI.Current)
+	}
+
+	sort.Stable(dcss)
+
+	return dcss, nil
+}